@@ -6,10 +6,14 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"strconv"
 
 	daprclient "github.com/dapr/go-sdk/client"
 	daprworkflow "github.com/dapr/go-sdk/workflow"
 	"github.com/rynowak/workflow-recipe/pkg/activities"
+	"github.com/rynowak/workflow-recipe/pkg/backup"
+	"github.com/rynowak/workflow-recipe/pkg/providers"
+	"github.com/rynowak/workflow-recipe/pkg/rabbitmq"
 	"github.com/rynowak/workflow-recipe/pkg/server"
 	"github.com/rynowak/workflow-recipe/pkg/workflows"
 )
@@ -75,6 +79,51 @@ func registerWorkflows(ctx context.Context, dapr daprclient.Client) error {
 		return fmt.Errorf("error creating Dapr workflow worker: %w", err)
 	}
 
+	storage, err := backup.NewStorageFromEnv()
+	if err != nil {
+		return fmt.Errorf("error configuring backup storage: %w", err)
+	}
+
+	databaseServer, err := providers.NewDatabaseServerFromEnv()
+	if err != nil {
+		return fmt.Errorf("error configuring database server provider: %w", err)
+	}
+
+	cluster, secrets, err := providers.NewClusterFromEnv()
+	if err != nil {
+		return fmt.Errorf("error configuring cluster provider: %w", err)
+	}
+
+	pool, err := providers.NewServerPoolFromEnv()
+	if err != nil {
+		return fmt.Errorf("error configuring server pool: %w", err)
+	}
+
+	// Deleting a resource keeps its data unless the operator allows it to be deleted.
+	if value := os.Getenv("ALLOW_DATA_DELETION"); value != "" {
+		workflows.AllowDataDeletion, err = strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("error configuring ALLOW_DATA_DELETION: %w", err)
+		}
+	}
+
+	activities.Initialize(activities.Options{
+		Dapr:           dapr,
+		StateStore:     server.StateStore,
+		BackupStorage:  storage,
+		Dumper:         backup.NewDumperFromEnv(),
+		MySQLDumper:    backup.NewMySQLDumperFromEnv(),
+		MongoDumper:    backup.NewMongoDumperFromEnv(),
+		Restorer:       backup.NewRestorerFromEnv(),
+		ConfigMaps:     activities.NewConfigMapReaderFromEnv(),
+		Verifier:       activities.NewVerifierFromEnv(),
+		RabbitMQ:       rabbitmq.NewClientFromEnv(),
+		DatabaseServer: databaseServer,
+		Cluster:        cluster,
+		Secrets:        secrets,
+		ServerPool:     pool,
+	})
+
 	// TODO: register workflows and activities.
 
 	err = worker.RegisterWorkflow(workflows.PostgresSQLDatabasesPut)
@@ -87,6 +136,76 @@ func registerWorkflows(ctx context.Context, dapr daprclient.Client) error {
 		return fmt.Errorf("error registering workflow: %w", err)
 	}
 
+	err = worker.RegisterWorkflow(workflows.PostgresSQLDatabasesRestore)
+	if err != nil {
+		return fmt.Errorf("error registering workflow: %w", err)
+	}
+
+	err = worker.RegisterWorkflow(workflows.PostgresSQLDatabasesBackupSchedule)
+	if err != nil {
+		return fmt.Errorf("error registering workflow: %w", err)
+	}
+
+	err = worker.RegisterWorkflow(workflows.PostgresSQLCredentialsRotate)
+	if err != nil {
+		return fmt.Errorf("error registering workflow: %w", err)
+	}
+
+	err = worker.RegisterWorkflow(workflows.PostgresSQLCredentialsRotationSchedule)
+	if err != nil {
+		return fmt.Errorf("error registering workflow: %w", err)
+	}
+
+	err = worker.RegisterWorkflow(workflows.PostgresSQLCredentialsLease)
+	if err != nil {
+		return fmt.Errorf("error registering workflow: %w", err)
+	}
+
+	err = worker.RegisterWorkflow(workflows.PostgresSQLCredentialsIssue)
+	if err != nil {
+		return fmt.Errorf("error registering workflow: %w", err)
+	}
+
+	err = worker.RegisterWorkflow(workflows.RedisCachesPut)
+	if err != nil {
+		return fmt.Errorf("error registering workflow: %w", err)
+	}
+
+	err = worker.RegisterWorkflow(workflows.RedisCachesDelete)
+	if err != nil {
+		return fmt.Errorf("error registering workflow: %w", err)
+	}
+
+	err = worker.RegisterWorkflow(workflows.MySQLDatabasesPut)
+	if err != nil {
+		return fmt.Errorf("error registering workflow: %w", err)
+	}
+
+	err = worker.RegisterWorkflow(workflows.MySQLDatabasesDelete)
+	if err != nil {
+		return fmt.Errorf("error registering workflow: %w", err)
+	}
+
+	err = worker.RegisterWorkflow(workflows.MongoDatabasesPut)
+	if err != nil {
+		return fmt.Errorf("error registering workflow: %w", err)
+	}
+
+	err = worker.RegisterWorkflow(workflows.MongoDatabasesDelete)
+	if err != nil {
+		return fmt.Errorf("error registering workflow: %w", err)
+	}
+
+	err = worker.RegisterWorkflow(workflows.RabbitMQQueuesPut)
+	if err != nil {
+		return fmt.Errorf("error registering workflow: %w", err)
+	}
+
+	err = worker.RegisterWorkflow(workflows.RabbitMQQueuesDelete)
+	if err != nil {
+		return fmt.Errorf("error registering workflow: %w", err)
+	}
+
 	err = worker.RegisterActivity(activities.DeployKubernetesResources)
 	if err != nil {
 		return fmt.Errorf("error registering activity: %w", err)
@@ -107,16 +226,191 @@ func registerWorkflows(ctx context.Context, dapr daprclient.Client) error {
 		return fmt.Errorf("error registering activity: %w", err)
 	}
 
+	err = worker.RegisterActivity(activities.RevokePostgresUserLogin)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.RestorePostgresUserLogin)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.WriteKubernetesSecret)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.GrantPostgresDatabaseAccess)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
 	err = worker.RegisterActivity(activities.CreatePostgresDatabase)
 	if err != nil {
 		return fmt.Errorf("error registering activity: %w", err)
 	}
 
+	err = worker.RegisterActivity(activities.EnablePostgresExtensions)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.ApplyPostgresMigrations)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.VerifyPostgresConnection)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
 	err = worker.RegisterActivity(activities.DeletePostgresDatabase)
 	if err != nil {
 		return fmt.Errorf("error registering activity: %w", err)
 	}
 
+	err = worker.RegisterActivity(activities.RestorePostgresDatabase)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.FindPostgresResources)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.AcquireResourceLock)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.ReleaseResourceLock)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.SaveInventoryRecord)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.GetInventoryRecord)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.DeleteInventoryRecord)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.GetBackup)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.CreateBackup)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.PruneBackups)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.ListInventoryRecords)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.CreateRedisUser)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.CreateMySQLUser)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.DeleteMySQLUser)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.CreateMySQLDatabase)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.DeleteMySQLDatabase)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.CreateMongoDatabase)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.DeleteMongoDatabase)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.CreateMongoUser)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.DeleteMongoUser)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.CreateRabbitMQQueue)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.DeleteRabbitMQQueue)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.AddSharedServerReference)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.RemoveSharedServerReference)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.PlacePostgresDatabase)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.GetPostgresDatabasePlacement)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.ReleasePostgresDatabasePlacement)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
+	err = worker.RegisterActivity(activities.GetPostgresDatabase)
+	if err != nil {
+		return fmt.Errorf("error registering activity: %w", err)
+	}
+
 	err = worker.Start()
 	if err != nil {
 		return fmt.Errorf("error starting Dapr workflow worker: %w", err)
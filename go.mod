@@ -2,20 +2,23 @@ module github.com/rynowak/workflow-recipe
 
 go 1.22.4
 
+require (
+	github.com/dapr/go-sdk v1.10.1
+	github.com/go-openapi/jsonpointer v0.21.0
+	github.com/google/uuid v1.6.0
+	github.com/microsoft/durabletask-go v0.4.1-0.20240122160106-fb5c4c05729d
+)
+
 require (
 	github.com/cenkalti/backoff/v4 v4.2.1 // indirect
 	github.com/dapr/dapr v1.13.0 // indirect
-	github.com/dapr/go-sdk v1.10.1 // indirect
 	github.com/go-logr/logr v1.4.1 // indirect
 	github.com/go-logr/stdr v1.2.2 // indirect
-	github.com/go-openapi/jsonpointer v0.21.0 // indirect
 	github.com/go-openapi/swag v0.23.0 // indirect
 	github.com/golang/protobuf v1.5.3 // indirect
-	github.com/google/uuid v1.6.0 // indirect
 	github.com/josharian/intern v1.0.0 // indirect
 	github.com/mailru/easyjson v0.7.7 // indirect
 	github.com/marusama/semaphore/v2 v2.5.0 // indirect
-	github.com/microsoft/durabletask-go v0.4.1-0.20240122160106-fb5c4c05729d // indirect
 	go.opentelemetry.io/otel v1.23.1 // indirect
 	go.opentelemetry.io/otel/metric v1.23.1 // indirect
 	go.opentelemetry.io/otel/trace v1.23.1 // indirect
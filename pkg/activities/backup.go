@@ -0,0 +1,163 @@
+package activities
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/rynowak/workflow-recipe/pkg/backup"
+)
+
+func CallGetBackup(ctx *daprworkflow.WorkflowContext, input GetBackupInput) (GetBackupOutput, error) {
+	task := ctx.CallActivity(GetBackup, daprworkflow.ActivityInput(input))
+
+	output := GetBackupOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return GetBackupOutput{}, err
+	}
+
+	return output, nil
+}
+
+type GetBackupInput struct {
+	ID string `json:"id"`
+}
+
+type GetBackupOutput struct {
+	Backup backup.Metadata `json:"backup"`
+}
+
+func GetBackup(ctx daprworkflow.ActivityContext) (any, error) {
+	input := GetBackupInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	if backupStorage == nil {
+		return nil, errors.New("activities have not been initialized")
+	}
+
+	metadata, err := backup.ReadMetadata(ctx.Context(), backupStorage, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default()
+	logger.Info("Found backup", slog.String("backup.id", metadata.ID), slog.String("location", metadata.Location))
+
+	return GetBackupOutput{
+		Backup: *metadata,
+	}, nil
+}
+
+func CallCreateBackup(ctx *daprworkflow.WorkflowContext, input CreateBackupInput) (CreateBackupOutput, error) {
+	task := ctx.CallActivity(CreateBackup, daprworkflow.ActivityInput(input))
+
+	output := CreateBackupOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return CreateBackupOutput{}, err
+	}
+
+	return output, nil
+}
+
+type CreateBackupInput struct {
+	ResourceID string    `json:"resourceId"`
+	Database   string    `json:"database"`
+	Reason     string    `json:"reason"`
+	Server     ServerRef `json:"server,omitempty"`
+}
+
+type CreateBackupOutput struct {
+	Backup backup.Metadata `json:"backup"`
+}
+
+func CreateBackup(ctx daprworkflow.ActivityContext) (any, error) {
+	input := CreateBackupInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	if backupStorage == nil {
+		return nil, errors.New("activities have not been initialized")
+	}
+
+	dumper, err := dumperFor(ctx.Context(), input.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default()
+	logger.Info("Creating a backup", slog.String("database", input.Database), slog.String("storage", backupStorage.Name()))
+
+	metadata, err := backup.Create(ctx.Context(), backupStorage, dumper, backup.Request{
+		ResourceID: input.ResourceID,
+		Database:   input.Database,
+		Reason:     input.Reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Backup created",
+		slog.String("database", input.Database),
+		slog.String("location", metadata.Location),
+		slog.Int64("size", metadata.Size),
+		slog.String("checksum", metadata.Checksum))
+
+	return CreateBackupOutput{
+		Backup: *metadata,
+	}, nil
+}
+
+func CallPruneBackups(ctx *daprworkflow.WorkflowContext, input PruneBackupsInput) (PruneBackupsOutput, error) {
+	task := ctx.CallActivity(PruneBackups, daprworkflow.ActivityInput(input))
+
+	output := PruneBackupsOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return PruneBackupsOutput{}, err
+	}
+
+	return output, nil
+}
+
+type PruneBackupsInput struct {
+	ResourceID string           `json:"resourceId"`
+	Retention  backup.Retention `json:"retention"`
+}
+
+type PruneBackupsOutput struct {
+	Pruned []string `json:"pruned"`
+}
+
+func PruneBackups(ctx daprworkflow.ActivityContext) (any, error) {
+	input := PruneBackupsInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	if backupStorage == nil {
+		return nil, errors.New("activities have not been initialized")
+	}
+
+	pruned, err := backup.Prune(ctx.Context(), backupStorage, input.ResourceID, input.Retention, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default()
+	output := PruneBackupsOutput{Pruned: []string{}}
+	for _, metadata := range pruned {
+		logger.Info("Pruned backup", slog.String("backup.id", metadata.ID), slog.Time("createdAt", metadata.CreatedAt))
+		output.Pruned = append(output.Pruned, metadata.ID)
+	}
+
+	return output, nil
+}
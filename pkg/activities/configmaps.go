@@ -0,0 +1,117 @@
+package activities
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/rynowak/workflow-recipe/pkg/providers"
+)
+
+var (
+	// configMapNamePattern matches valid Kubernetes object names and ConfigMap keys. This also keeps references from
+	// escaping the ConfigMap directory.
+	configMapNamePattern = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]{0,251}[A-Za-z0-9])?$`)
+)
+
+// ConfigMapKeyRef refers to a key in a Kubernetes ConfigMap.
+type ConfigMapKeyRef struct {
+	// Name is the name of the ConfigMap.
+	Name string `json:"name"`
+	// Key is the key of the value in the ConfigMap.
+	Key string `json:"key"`
+}
+
+// Validate returns an error if the reference is not a valid ConfigMap name and key.
+func (r ConfigMapKeyRef) Validate() error {
+	if !configMapNamePattern.MatchString(r.Name) {
+		return fmt.Errorf("invalid ConfigMap name %q", r.Name)
+	} else if !configMapNamePattern.MatchString(r.Key) {
+		return fmt.Errorf("invalid ConfigMap key %q", r.Key)
+	}
+
+	return nil
+}
+
+// ConfigMapReader reads values from Kubernetes ConfigMaps.
+type ConfigMapReader interface {
+	// Read returns the value of a key in a ConfigMap.
+	Read(ctx context.Context, namespace string, ref ConfigMapKeyRef) (string, error)
+}
+
+// DirectoryConfigMapReader reads ConfigMaps from a directory laid out as <root>/<namespace>/<name>/<key>. Each
+// namespace directory has the same layout as ConfigMaps mounted as volumes.
+type DirectoryConfigMapReader struct {
+	Root string
+}
+
+var _ ConfigMapReader = (*DirectoryConfigMapReader)(nil)
+
+func (r *DirectoryConfigMapReader) Read(ctx context.Context, namespace string, ref ConfigMapKeyRef) (string, error) {
+	err := ref.Validate()
+	if err != nil {
+		return "", err
+	} else if !configMapNamePattern.MatchString(namespace) {
+		return "", fmt.Errorf("invalid namespace %q", namespace)
+	}
+
+	bs, err := os.ReadFile(filepath.Join(r.Root, namespace, ref.Name, ref.Key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("key %q was not found in ConfigMap %q in namespace %q", ref.Key, ref.Name, namespace)
+	} else if err != nil {
+		return "", fmt.Errorf("error reading ConfigMap %q: %w", ref.Name, err)
+	}
+
+	return string(bs), nil
+}
+
+// KubernetesConfigMapReader reads ConfigMaps from a Kubernetes cluster with kubectl.
+type KubernetesConfigMapReader struct {
+	Cluster *providers.KubectlCluster
+}
+
+var _ ConfigMapReader = (*KubernetesConfigMapReader)(nil)
+
+func (r *KubernetesConfigMapReader) Read(ctx context.Context, namespace string, ref ConfigMapKeyRef) (string, error) {
+	err := ref.Validate()
+	if err != nil {
+		return "", err
+	} else if !configMapNamePattern.MatchString(namespace) {
+		return "", fmt.Errorf("invalid namespace %q", namespace)
+	}
+
+	data, found, err := r.Cluster.ReadConfigMap(ctx, namespace, ref.Name)
+	if err != nil {
+		return "", fmt.Errorf("error reading ConfigMap %q: %w", ref.Name, err)
+	} else if !found {
+		return "", fmt.Errorf("ConfigMap %q was not found in namespace %q", ref.Name, namespace)
+	}
+
+	value, ok := data[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("key %q was not found in ConfigMap %q in namespace %q", ref.Key, ref.Name, namespace)
+	}
+
+	return value, nil
+}
+
+// NewConfigMapReaderFromEnv creates the ConfigMapReader for the CLUSTER_PROVIDER environment variable. The kubernetes
+// provider reads ConfigMaps from the cluster with kubectl, like the cluster provider, and KUBECTL_PATH overrides the
+// location of kubectl. Otherwise ConfigMaps are read from the directory in the CONFIGMAP_ROOT environment variable,
+// which defaults to a directory in the system temp directory.
+func NewConfigMapReaderFromEnv() ConfigMapReader {
+	if os.Getenv("CLUSTER_PROVIDER") == providers.Kubernetes {
+		return &KubernetesConfigMapReader{Cluster: &providers.KubectlCluster{Path: os.Getenv("KUBECTL_PATH")}}
+	}
+
+	root := os.Getenv("CONFIGMAP_ROOT")
+	if root == "" {
+		root = filepath.Join(os.TempDir(), "workflow-recipe-configmaps")
+	}
+
+	return &DirectoryConfigMapReader{Root: root}
+}
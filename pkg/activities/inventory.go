@@ -0,0 +1,194 @@
+package activities
+
+import (
+	"errors"
+	"log/slog"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/rynowak/workflow-recipe/pkg/inventory"
+)
+
+func CallSaveInventoryRecord(ctx *daprworkflow.WorkflowContext, input SaveInventoryRecordInput) (SaveInventoryRecordOutput, error) {
+	task := ctx.CallActivity(SaveInventoryRecord, daprworkflow.ActivityInput(input))
+
+	output := SaveInventoryRecordOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return SaveInventoryRecordOutput{}, err
+	}
+
+	return output, nil
+}
+
+type SaveInventoryRecordInput struct {
+	Record inventory.Record `json:"record"`
+}
+
+type SaveInventoryRecordOutput struct {
+	Record inventory.Record `json:"record"`
+}
+
+func SaveInventoryRecord(ctx daprworkflow.ActivityContext) (any, error) {
+	input := SaveInventoryRecordInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	if inventoryStore == nil {
+		return nil, errors.New("activities have not been initialized")
+	}
+
+	record, err := inventoryStore.Save(ctx.Context(), input.Record)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default()
+	logger.Info("Saved resource to inventory", slog.String("resource.id", record.ID))
+
+	return SaveInventoryRecordOutput{
+		Record: *record,
+	}, nil
+}
+
+func CallGetInventoryRecord(ctx *daprworkflow.WorkflowContext, input GetInventoryRecordInput) (GetInventoryRecordOutput, error) {
+	task := ctx.CallActivity(GetInventoryRecord, daprworkflow.ActivityInput(input))
+
+	output := GetInventoryRecordOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return GetInventoryRecordOutput{}, err
+	}
+
+	return output, nil
+}
+
+type GetInventoryRecordInput struct {
+	ResourceID string `json:"resourceId"`
+}
+
+type GetInventoryRecordOutput struct {
+	Found  bool             `json:"found"`
+	Record inventory.Record `json:"record"`
+}
+
+func GetInventoryRecord(ctx daprworkflow.ActivityContext) (any, error) {
+	input := GetInventoryRecordInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	if inventoryStore == nil {
+		return nil, errors.New("activities have not been initialized")
+	}
+
+	record, err := inventoryStore.Get(ctx.Context(), input.ResourceID)
+	if errors.Is(err, inventory.ErrNotFound) {
+		return GetInventoryRecordOutput{Found: false}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return GetInventoryRecordOutput{
+		Found:  true,
+		Record: *record,
+	}, nil
+}
+
+func CallDeleteInventoryRecord(ctx *daprworkflow.WorkflowContext, input DeleteInventoryRecordInput) (DeleteInventoryRecordOutput, error) {
+	task := ctx.CallActivity(DeleteInventoryRecord, daprworkflow.ActivityInput(input))
+
+	output := DeleteInventoryRecordOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return DeleteInventoryRecordOutput{}, err
+	}
+
+	return output, nil
+}
+
+type DeleteInventoryRecordInput struct {
+	ResourceID string `json:"resourceId"`
+}
+
+type DeleteInventoryRecordOutput struct {
+}
+
+func DeleteInventoryRecord(ctx daprworkflow.ActivityContext) (any, error) {
+	input := DeleteInventoryRecordInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	if inventoryStore == nil {
+		return nil, errors.New("activities have not been initialized")
+	}
+
+	err = inventoryStore.Delete(ctx.Context(), input.ResourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default()
+	logger.Info("Removed resource from inventory", slog.String("resource.id", input.ResourceID))
+
+	return DeleteInventoryRecordOutput{}, nil
+}
+
+func CallListInventoryRecords(ctx *daprworkflow.WorkflowContext, input ListInventoryRecordsInput) (ListInventoryRecordsOutput, error) {
+	task := ctx.CallActivity(ListInventoryRecords, daprworkflow.ActivityInput(input))
+
+	output := ListInventoryRecordsOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return ListInventoryRecordsOutput{}, err
+	}
+
+	return output, nil
+}
+
+type ListInventoryRecordsInput struct {
+	// Recipe filters the records to resources provisioned by a recipe. Empty matches every recipe.
+	Recipe string `json:"recipe,omitempty"`
+	// EnvironmentID filters the records to resources in an environment. Empty matches every environment.
+	EnvironmentID string `json:"environmentId,omitempty"`
+}
+
+type ListInventoryRecordsOutput struct {
+	Records []inventory.Record `json:"records"`
+}
+
+func ListInventoryRecords(ctx daprworkflow.ActivityContext) (any, error) {
+	input := ListInventoryRecordsInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	if inventoryStore == nil {
+		return nil, errors.New("activities have not been initialized")
+	}
+
+	records, err := inventoryStore.List(ctx.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	output := ListInventoryRecordsOutput{Records: []inventory.Record{}}
+	for _, record := range records {
+		if input.Recipe != "" && record.Recipe != input.Recipe {
+			continue
+		} else if input.EnvironmentID != "" && record.EnvironmentID != input.EnvironmentID {
+			continue
+		}
+
+		// The recipe context can be large, and it ends up in the workflow history.
+		record.Context = nil
+		output.Records = append(output.Records, record)
+	}
+
+	return output, nil
+}
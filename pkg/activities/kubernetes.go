@@ -1,11 +1,26 @@
 package activities
 
 import (
-	"fmt"
+	"errors"
 	"log/slog"
-	"time"
+	"maps"
 
 	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/google/uuid"
+	"github.com/rynowak/workflow-recipe/pkg/providers"
+)
+
+const (
+	// DefaultServerImage is the image deployed when DeployKubernetesResourcesInput doesn't set one.
+	DefaultServerImage = "postgres:16"
+	// DefaultServerPort is the port used when DeployKubernetesResourcesInput doesn't set one.
+	DefaultServerPort = 5432
+	// DefaultServerDataPath is where the default image keeps its data.
+	DefaultServerDataPath = "/var/lib/postgresql/data"
+	// DefaultServerAdminUsername is the admin account of the default image.
+	DefaultServerAdminUsername = "postgres"
+	// DefaultServerAdminPasswordEnv is the environment variable the default image reads the admin password from.
+	DefaultServerAdminPasswordEnv = "POSTGRES_PASSWORD"
 )
 
 func CallDeployKubernetesResources(ctx *daprworkflow.WorkflowContext, input DeployKubernetesResourcesInput) (DeployKubernetesResourcesOutput, error) {
@@ -23,6 +38,25 @@ func CallDeployKubernetesResources(ctx *daprworkflow.WorkflowContext, input Depl
 type DeployKubernetesResourcesInput struct {
 	Namespace string `json:"namespace"`
 	Name      string `json:"name"`
+	// Image is the container image of the server. Defaults to DefaultServerImage.
+	Image string `json:"image,omitempty"`
+	// Command replaces the entrypoint of the image.
+	Command []string `json:"command,omitempty"`
+	// Port is the port the server listens on. Defaults to DefaultServerPort.
+	Port int `json:"port,omitempty"`
+	// AdminPort is the port of the server's management API, if it has one besides Port.
+	AdminPort int `json:"adminPort,omitempty"`
+	// DataPath is the directory the server keeps its data in. A volume is mounted there. Defaults to
+	// DefaultServerDataPath for the default image.
+	DataPath string `json:"dataPath,omitempty"`
+	// Env are environment variables of the server that aren't secret.
+	Env map[string]string `json:"env,omitempty"`
+	// AdminUsername is the admin account of the server. Defaults to DefaultServerAdminUsername for the default image.
+	AdminUsername string `json:"adminUsername,omitempty"`
+	// AdminPasswordEnv is the environment variable the server reads the admin password from. The password is
+	// generated when the server is first deployed. Defaults to DefaultServerAdminPasswordEnv for the default image, and
+	// no password is generated for other images that don't set it.
+	AdminPasswordEnv string `json:"adminPasswordEnv,omitempty"`
 }
 
 type DeployKubernetesResourcesOutput struct {
@@ -38,21 +72,73 @@ func DeployKubernetesResources(ctx daprworkflow.ActivityContext) (any, error) {
 		return nil, err
 	}
 
-	// Pretend we are deploying resources...
-	logger := slog.Default()
-	logger.Info("Deploying Kubernetes Deployment")
-	logger.Info("Deploying Kubernetes Service")
-	logger.Info("Waiting for pods to be ready")
-	time.Sleep(2 * time.Second)
-	logger.Info("Pods are ready")
+	spec := providers.ServerSpec{
+		Image:     input.Image,
+		Command:   input.Command,
+		Port:      input.Port,
+		AdminPort: input.AdminPort,
+		Env:       maps.Clone(input.Env),
+		DataPath:  input.DataPath,
+	}
+	if spec.Env == nil {
+		spec.Env = map[string]string{}
+	}
+	if spec.Image == "" {
+		spec.Image = DefaultServerImage
+		spec.DataPath = DefaultServerDataPath
+		// The volume has a lost+found directory, and postgres needs an empty one.
+		spec.Env["PGDATA"] = DefaultServerDataPath + "/pgdata"
+		input.AdminUsername = DefaultServerAdminUsername
+		input.AdminPasswordEnv = DefaultServerAdminPasswordEnv
+	}
+	if spec.Port == 0 {
+		spec.Port = DefaultServerPort
+	}
+
+	if cluster == nil {
+		return nil, errors.New("activities have not been initialized")
+	}
+
+	// The password is only read when the server is first started, so the server keeps the password it was first
+	// deployed with. It is saved before deploying, so a retry doesn't generate a different one.
+	admin := ServerAdmin{}
+	if input.AdminPasswordEnv != "" {
+		var found bool
+		admin, found, err = getServerAdmin(ctx.Context(), input.Namespace, input.Name)
+		if err != nil {
+			return nil, err
+		} else if !found {
+			admin = ServerAdmin{Username: input.AdminUsername, Password: uuid.NewString()}
+			err = saveState(ctx.Context(), serverAdminKey(input.Namespace, input.Name), admin, "", false, nil)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		spec.Env[input.AdminPasswordEnv] = admin.Password
+	}
+
+	deployment, err := cluster.Deploy(ctx.Context(), input.Namespace, input.Name, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.AdminPasswordEnv != "" {
+		admin.Host = deployment.Host
+		admin.Port = deployment.Port
+		err = saveState(ctx.Context(), serverAdminKey(input.Namespace, input.Name), admin, "", false, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		logger := slog.Default()
+		logger.Info("Saved server admin", slog.String("namespace", input.Namespace), slog.String("name", input.Name))
+	}
 
 	return DeployKubernetesResourcesOutput{
-		Host: fmt.Sprintf("%s.%s.svc.cluster.local", input.Namespace, input.Name),
-		Port: 5432,
-		Resources: []string{
-			"/planes/kubernetes/local/namespaces/" + input.Namespace + "/providers/core/Service/" + input.Name,
-			"/planes/kubernetes/local/namespaces/" + input.Namespace + "/providers/apps/Deployment/" + input.Name,
-		},
+		Host:      deployment.Host,
+		Port:      deployment.Port,
+		Resources: deployment.Resources,
 	}, nil
 }
 
@@ -83,10 +169,62 @@ func DeleteKubernetesResources(ctx daprworkflow.ActivityContext) (any, error) {
 		return nil, err
 	}
 
-	// Pretend we are deleting resources...
-	logger := slog.Default()
-	logger.Info("Deleting Kubernetes Deployment")
-	logger.Info("Deleting Kubernetes Service")
+	if cluster == nil {
+		return nil, errors.New("activities have not been initialized")
+	}
+
+	err = cluster.Delete(ctx.Context(), input.Namespace, input.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = deleteState(ctx.Context(), serverAdminKey(input.Namespace, input.Name), "")
+	if err != nil {
+		return nil, err
+	}
 
 	return DeleteKubernetesResourcesOutput{}, nil
 }
+
+func CallWriteKubernetesSecret(ctx *daprworkflow.WorkflowContext, input WriteKubernetesSecretInput) (WriteKubernetesSecretOutput, error) {
+	task := ctx.CallActivity(WriteKubernetesSecret, daprworkflow.ActivityInput(input))
+
+	output := WriteKubernetesSecretOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return WriteKubernetesSecretOutput{}, err
+	}
+
+	return output, nil
+}
+
+type WriteKubernetesSecretInput struct {
+	Namespace string            `json:"namespace"`
+	Name      string            `json:"name"`
+	Data      map[string]string `json:"data"`
+}
+
+type WriteKubernetesSecretOutput struct {
+	Resource string `json:"resource"`
+}
+
+func WriteKubernetesSecret(ctx daprworkflow.ActivityContext) (any, error) {
+	input := WriteKubernetesSecretInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	if secrets == nil {
+		return nil, errors.New("activities have not been initialized")
+	}
+
+	resource, err := secrets.WriteSecret(ctx.Context(), input.Namespace, input.Name, input.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return WriteKubernetesSecretOutput{
+		Resource: resource,
+	}, nil
+}
@@ -0,0 +1,148 @@
+package activities
+
+import (
+	"log/slog"
+	"strconv"
+	"time"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+)
+
+const (
+	// ResourceLockTTL is how long a resource lock is held before it expires. This releases locks held by workflows
+	// that were terminated before they could release them.
+	ResourceLockTTL = time.Hour
+)
+
+// ResourceLock records the workflow instance that is currently operating on a resource.
+type ResourceLock struct {
+	ResourceID string    `json:"resourceId"`
+	InstanceID string    `json:"instanceId"`
+	Workflow   string    `json:"workflow"`
+	AcquiredAt time.Time `json:"acquiredAt"`
+}
+
+func resourceLockKey(resourceID string) string {
+	return "locks||" + resourceID
+}
+
+func CallAcquireResourceLock(ctx *daprworkflow.WorkflowContext, input AcquireResourceLockInput) (AcquireResourceLockOutput, error) {
+	task := ctx.CallActivity(AcquireResourceLock, daprworkflow.ActivityInput(input))
+
+	output := AcquireResourceLockOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return AcquireResourceLockOutput{}, err
+	}
+
+	return output, nil
+}
+
+type AcquireResourceLockInput struct {
+	ResourceID string `json:"resourceId"`
+	InstanceID string `json:"instanceId"`
+	Workflow   string `json:"workflow"`
+}
+
+type AcquireResourceLockOutput struct {
+	Acquired bool         `json:"acquired"`
+	Holder   ResourceLock `json:"holder"`
+}
+
+func AcquireResourceLock(ctx daprworkflow.ActivityContext) (any, error) {
+	input := AcquireResourceLockInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default().With(slog.String("resource.id", input.ResourceID), slog.String("instance.id", input.InstanceID))
+
+	key := resourceLockKey(input.ResourceID)
+	holder := ResourceLock{}
+	_, ok, err := getState(ctx.Context(), key, &holder)
+	if err != nil {
+		return nil, err
+	}
+
+	// The lock might already be ours if this activity is being retried.
+	if ok && holder.InstanceID == input.InstanceID {
+		return AcquireResourceLockOutput{Acquired: true, Holder: holder}, nil
+	} else if ok {
+		logger.Info("Resource is locked by another workflow", slog.String("holder.id", holder.InstanceID), slog.String("holder.workflow", holder.Workflow))
+		return AcquireResourceLockOutput{Acquired: false, Holder: holder}, nil
+	}
+
+	lock := ResourceLock{
+		ResourceID: input.ResourceID,
+		InstanceID: input.InstanceID,
+		Workflow:   input.Workflow,
+		AcquiredAt: time.Now().UTC(),
+	}
+	metadata := map[string]string{"ttlInSeconds": strconv.Itoa(int(ResourceLockTTL.Seconds()))}
+	err = saveState(ctx.Context(), key, lock, "", true, metadata)
+	if err != nil {
+		// Someone else may have won the race to create the lock. Report them as the holder if so.
+		_, ok, readErr := getState(ctx.Context(), key, &holder)
+		if readErr == nil && ok && holder.InstanceID != input.InstanceID {
+			logger.Info("Resource was locked by another workflow", slog.String("holder.id", holder.InstanceID), slog.String("holder.workflow", holder.Workflow))
+			return AcquireResourceLockOutput{Acquired: false, Holder: holder}, nil
+		}
+
+		return nil, err
+	}
+
+	logger.Info("Acquired resource lock")
+	return AcquireResourceLockOutput{Acquired: true, Holder: lock}, nil
+}
+
+func CallReleaseResourceLock(ctx *daprworkflow.WorkflowContext, input ReleaseResourceLockInput) (ReleaseResourceLockOutput, error) {
+	task := ctx.CallActivity(ReleaseResourceLock, daprworkflow.ActivityInput(input))
+
+	output := ReleaseResourceLockOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return ReleaseResourceLockOutput{}, err
+	}
+
+	return output, nil
+}
+
+type ReleaseResourceLockInput struct {
+	ResourceID string `json:"resourceId"`
+	InstanceID string `json:"instanceId"`
+}
+
+type ReleaseResourceLockOutput struct {
+}
+
+func ReleaseResourceLock(ctx daprworkflow.ActivityContext) (any, error) {
+	input := ReleaseResourceLockInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default().With(slog.String("resource.id", input.ResourceID), slog.String("instance.id", input.InstanceID))
+
+	key := resourceLockKey(input.ResourceID)
+	holder := ResourceLock{}
+	etag, ok, err := getState(ctx.Context(), key, &holder)
+	if err != nil {
+		return nil, err
+	}
+
+	// Never release a lock that belongs to someone else. Ours may have expired and been taken over.
+	if !ok || holder.InstanceID != input.InstanceID {
+		logger.Warn("Resource lock is not held by this workflow")
+		return ReleaseResourceLockOutput{}, nil
+	}
+
+	err = deleteState(ctx.Context(), key, etag)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Released resource lock")
+	return ReleaseResourceLockOutput{}, nil
+}
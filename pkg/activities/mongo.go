@@ -0,0 +1,254 @@
+package activities
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/google/uuid"
+	"github.com/rynowak/workflow-recipe/pkg/backup"
+)
+
+const (
+	// MongoLabelsCollection is the collection that holds the labels of a database. Writing it also creates the
+	// database, because MongoDB only creates databases when they are first written to.
+	MongoLabelsCollection = "_labels"
+)
+
+var (
+	// MongoRoles are the built-in database roles that can be granted to a user.
+	MongoRoles = []string{"read", "readWrite", "dbAdmin", "dbOwner", "userAdmin"}
+)
+
+// ValidateMongoRoles returns an error if any of the roles is not a built-in database role.
+func ValidateMongoRoles(roles []string) error {
+	if len(roles) == 0 {
+		return errors.New("at least one role is required")
+	}
+
+	for _, role := range roles {
+		if !slices.Contains(MongoRoles, role) {
+			return fmt.Errorf("unsupported role %q: supported roles are %s", role, strings.Join(MongoRoles, ", "))
+		}
+	}
+
+	return nil
+}
+
+func CallCreateMongoDatabase(ctx *daprworkflow.WorkflowContext, input CreateMongoDatabaseInput) (CreateMongoDatabaseOutput, error) {
+	task := ctx.CallActivity(CreateMongoDatabase, daprworkflow.ActivityInput(input))
+
+	output := CreateMongoDatabaseOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return CreateMongoDatabaseOutput{}, err
+	}
+
+	return output, nil
+}
+
+type CreateMongoDatabaseInput struct {
+	DatabasePrefix string            `json:"databasePrefix"`
+	Labels         map[string]string `json:"labels,omitempty"`
+}
+
+type CreateMongoDatabaseOutput struct {
+	Database string `json:"database"`
+}
+
+func CreateMongoDatabase(ctx daprworkflow.ActivityContext) (any, error) {
+	input := CreateMongoDatabaseInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	// MongoDB database names are limited to 63 characters, so the prefix is shortened to make room for the suffix.
+	prefix := input.DatabasePrefix
+	if len(prefix) > 30 {
+		prefix = prefix[:30]
+	}
+	database := fmt.Sprintf("%s_%s", prefix, strings.ReplaceAll(uuid.NewString(), "-", ""))
+
+	labels, err := json.Marshal(input.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pretend we are using a real database server...
+	logger := slog.Default()
+	logger.Info("Creating new database", slog.String("database", database))
+	logger.Info("Executing MongoDB command", slog.String("database", database), slog.String("command", fmt.Sprintf("db.%s.insertOne({ labels: %s })", MongoLabelsCollection, labels)))
+
+	return CreateMongoDatabaseOutput{
+		Database: database,
+	}, nil
+}
+
+func CallDeleteMongoDatabase(ctx *daprworkflow.WorkflowContext, input DeleteMongoDatabaseInput) (DeleteMongoDatabaseOutput, error) {
+	task := ctx.CallActivity(DeleteMongoDatabase, daprworkflow.ActivityInput(input))
+
+	output := DeleteMongoDatabaseOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return DeleteMongoDatabaseOutput{}, err
+	}
+
+	return output, nil
+}
+
+type DeleteMongoDatabaseInput struct {
+	Database     string `json:"database"`
+	CreateBackup bool   `json:"createBackup"`
+	ResourceID   string `json:"resourceId"`
+}
+
+type DeleteMongoDatabaseOutput struct {
+	Backup *backup.Metadata `json:"backup,omitempty"`
+}
+
+func DeleteMongoDatabase(ctx daprworkflow.ActivityContext) (any, error) {
+	input := DeleteMongoDatabaseInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default()
+
+	output := DeleteMongoDatabaseOutput{}
+	if input.CreateBackup {
+		if backupStorage == nil || mongoDumper == nil {
+			return nil, errors.New("activities have not been initialized")
+		}
+
+		logger.Info("Creating a backup", slog.String("database", input.Database), slog.String("storage", backupStorage.Name()))
+		output.Backup, err = backup.Create(ctx.Context(), backupStorage, mongoDumper, backup.Request{
+			ResourceID: input.ResourceID,
+			Database:   input.Database,
+			Reason:     backup.ReasonDelete,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		logger.Info("Backup created",
+			slog.String("database", input.Database),
+			slog.String("location", output.Backup.Location),
+			slog.Int64("size", output.Backup.Size),
+			slog.String("checksum", output.Backup.Checksum))
+	}
+
+	// Pretend we are using a real database server...
+	logger.Info("Deleting database", slog.String("database", input.Database))
+	logger.Info("Executing MongoDB command", slog.String("database", input.Database), slog.String("command", "db.dropDatabase()"))
+
+	return output, nil
+}
+
+func CallCreateMongoUser(ctx *daprworkflow.WorkflowContext, input CreateMongoUserInput) (CreateMongoUserOutput, error) {
+	task := ctx.CallActivity(CreateMongoUser, daprworkflow.ActivityInput(input))
+
+	output := CreateMongoUserOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return CreateMongoUserOutput{}, err
+	}
+
+	return output, nil
+}
+
+type CreateMongoUserInput struct {
+	// Database is the database the user is created in. The user can only authenticate against this database.
+	Database string `json:"database"`
+	// Username is the name of the user to create. Defaults to mongouser.
+	Username string `json:"username,omitempty"`
+	// Roles are the built-in roles the user is granted on the database.
+	Roles []string `json:"roles"`
+}
+
+type CreateMongoUserOutput struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func CreateMongoUser(ctx daprworkflow.ActivityContext) (any, error) {
+	input := CreateMongoUserInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ValidateMongoRoles(input.Roles)
+	if err != nil {
+		return nil, err
+	}
+
+	username := input.Username
+	if username == "" {
+		username = "mongouser"
+	}
+	password := uuid.NewString()
+
+	type role struct {
+		Role string `json:"role"`
+		DB   string `json:"db"`
+	}
+	roles := []role{}
+	for _, name := range input.Roles {
+		roles = append(roles, role{Role: name, DB: input.Database})
+	}
+	bs, err := json.Marshal(roles)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pretend we are using a real database server...
+	logger := slog.Default()
+	logger.Info("Generating new mongo user", slog.String("database", input.Database), slog.String("username", username), slog.Any("roles", input.Roles))
+	logger.Info("Executing MongoDB command", slog.String("database", input.Database), slog.String("command", fmt.Sprintf("db.createUser({ user: %q, pwd: \"********\", roles: %s })", username, bs)))
+
+	return CreateMongoUserOutput{
+		Username: username,
+		Password: password,
+	}, nil
+}
+
+func CallDeleteMongoUser(ctx *daprworkflow.WorkflowContext, input DeleteMongoUserInput) (DeleteMongoUserOutput, error) {
+	task := ctx.CallActivity(DeleteMongoUser, daprworkflow.ActivityInput(input))
+
+	output := DeleteMongoUserOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return DeleteMongoUserOutput{}, err
+	}
+
+	return output, nil
+}
+
+type DeleteMongoUserInput struct {
+	Database string `json:"database"`
+	Username string `json:"username"`
+}
+
+type DeleteMongoUserOutput struct {
+}
+
+func DeleteMongoUser(ctx daprworkflow.ActivityContext) (any, error) {
+	input := DeleteMongoUserInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pretend we are using a real database server...
+	logger := slog.Default()
+	logger.Info("Deleting mongo user", slog.String("database", input.Database), slog.String("username", input.Username))
+	logger.Info("Executing MongoDB command", slog.String("database", input.Database), slog.String("command", fmt.Sprintf("db.dropUser(%q)", input.Username)))
+
+	return DeleteMongoUserOutput{}, nil
+}
@@ -0,0 +1,221 @@
+package activities
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/google/uuid"
+	"github.com/rynowak/workflow-recipe/pkg/backup"
+)
+
+func CallCreateMySQLUser(ctx *daprworkflow.WorkflowContext, input CreateMySQLUserInput) (CreateMySQLUserOutput, error) {
+	task := ctx.CallActivity(CreateMySQLUser, daprworkflow.ActivityInput(input))
+
+	output := CreateMySQLUserOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return CreateMySQLUserOutput{}, err
+	}
+
+	return output, nil
+}
+
+type CreateMySQLUserInput struct {
+	// Username is the name of the user to create. Defaults to mysqluser.
+	Username string            `json:"username,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+}
+
+type CreateMySQLUserOutput struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func CreateMySQLUser(ctx daprworkflow.ActivityContext) (any, error) {
+	input := CreateMySQLUserInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	username := input.Username
+	if username == "" {
+		username = "mysqluser"
+	}
+	password := uuid.NewString()
+
+	// MySQL keeps the labels in the user's attributes, where they can be searched for later.
+	attributes, err := json.Marshal(input.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pretend we are using a real database server...
+	logger := slog.Default()
+	logger.Info("Generating new mysql user", slog.String("username", username))
+	logger.Info("Executing SQL", slog.String("statement", fmt.Sprintf("CREATE USER IF NOT EXISTS %s@'%%' IDENTIFIED BY '********' ATTRIBUTE %s",
+		quoteMySQLString(username), quoteMySQLString(string(attributes)))))
+
+	return CreateMySQLUserOutput{
+		Username: username,
+		Password: password,
+	}, nil
+}
+
+func CallDeleteMySQLUser(ctx *daprworkflow.WorkflowContext, input DeleteMySQLUserInput) (DeleteMySQLUserOutput, error) {
+	task := ctx.CallActivity(DeleteMySQLUser, daprworkflow.ActivityInput(input))
+
+	output := DeleteMySQLUserOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return DeleteMySQLUserOutput{}, err
+	}
+
+	return output, nil
+}
+
+type DeleteMySQLUserInput struct {
+	Username string `json:"username"`
+}
+
+type DeleteMySQLUserOutput struct {
+}
+
+func DeleteMySQLUser(ctx daprworkflow.ActivityContext) (any, error) {
+	input := DeleteMySQLUserInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pretend we are using a real database server...
+	logger := slog.Default()
+	logger.Info("Deleting mysql user", slog.String("username", input.Username))
+	logger.Info("Executing SQL", slog.String("statement", fmt.Sprintf("DROP USER IF EXISTS %s@'%%'", quoteMySQLString(input.Username))))
+
+	return DeleteMySQLUserOutput{}, nil
+}
+
+func CallCreateMySQLDatabase(ctx *daprworkflow.WorkflowContext, input CreateMySQLDatabaseInput) (CreateMySQLDatabaseOutput, error) {
+	task := ctx.CallActivity(CreateMySQLDatabase, daprworkflow.ActivityInput(input))
+
+	output := CreateMySQLDatabaseOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return CreateMySQLDatabaseOutput{}, err
+	}
+
+	return output, nil
+}
+
+type CreateMySQLDatabaseInput struct {
+	// Username is the user that is granted all privileges on the database.
+	Username       string `json:"username"`
+	DatabasePrefix string `json:"databasePrefix"`
+}
+
+type CreateMySQLDatabaseOutput struct {
+	Database string `json:"database"`
+}
+
+func CreateMySQLDatabase(ctx daprworkflow.ActivityContext) (any, error) {
+	input := CreateMySQLDatabaseInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	// MySQL database names are limited to 64 characters, so the prefix is shortened to make room for the suffix.
+	prefix := input.DatabasePrefix
+	if len(prefix) > 31 {
+		prefix = prefix[:31]
+	}
+	database := fmt.Sprintf("%s_%s", prefix, strings.ReplaceAll(uuid.NewString(), "-", ""))
+
+	// Pretend we are using a real database server...
+	logger := slog.Default()
+	logger.Info("Creating new database", slog.String("database", database))
+	logger.Info("Executing SQL", slog.String("statement", fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", quoteMySQLIdentifier(database))))
+	if input.Username != "" {
+		logger.Info("Executing SQL", slog.String("statement", fmt.Sprintf("GRANT ALL PRIVILEGES ON %s.* TO %s@'%%'", quoteMySQLIdentifier(database), quoteMySQLString(input.Username))))
+	}
+
+	return CreateMySQLDatabaseOutput{
+		Database: database,
+	}, nil
+}
+
+func CallDeleteMySQLDatabase(ctx *daprworkflow.WorkflowContext, input DeleteMySQLDatabaseInput) (DeleteMySQLDatabaseOutput, error) {
+	task := ctx.CallActivity(DeleteMySQLDatabase, daprworkflow.ActivityInput(input))
+
+	output := DeleteMySQLDatabaseOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return DeleteMySQLDatabaseOutput{}, err
+	}
+
+	return output, nil
+}
+
+type DeleteMySQLDatabaseInput struct {
+	Database     string `json:"database"`
+	CreateBackup bool   `json:"createBackup"`
+	ResourceID   string `json:"resourceId"`
+}
+
+type DeleteMySQLDatabaseOutput struct {
+	Backup *backup.Metadata `json:"backup,omitempty"`
+}
+
+func DeleteMySQLDatabase(ctx daprworkflow.ActivityContext) (any, error) {
+	input := DeleteMySQLDatabaseInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default()
+
+	output := DeleteMySQLDatabaseOutput{}
+	if input.CreateBackup {
+		if backupStorage == nil || mysqlDumper == nil {
+			return nil, errors.New("activities have not been initialized")
+		}
+
+		logger.Info("Creating a backup", slog.String("database", input.Database), slog.String("storage", backupStorage.Name()))
+		output.Backup, err = backup.Create(ctx.Context(), backupStorage, mysqlDumper, backup.Request{
+			ResourceID: input.ResourceID,
+			Database:   input.Database,
+			Reason:     backup.ReasonDelete,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		logger.Info("Backup created",
+			slog.String("database", input.Database),
+			slog.String("location", output.Backup.Location),
+			slog.Int64("size", output.Backup.Size),
+			slog.String("checksum", output.Backup.Checksum))
+	}
+
+	// Pretend we are using a real database server...
+	logger.Info("Deleting database", slog.String("database", input.Database))
+	logger.Info("Executing SQL", slog.String("statement", fmt.Sprintf("DROP DATABASE IF EXISTS %s", quoteMySQLIdentifier(input.Database))))
+
+	return output, nil
+}
+
+// quoteMySQLIdentifier quotes a MySQL identifier, like a database name.
+func quoteMySQLIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// quoteMySQLString quotes a MySQL string literal, like a user name.
+func quoteMySQLString(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `''`).Replace(value) + "'"
+}
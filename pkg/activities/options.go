@@ -0,0 +1,78 @@
+package activities
+
+import (
+	daprclient "github.com/dapr/go-sdk/client"
+	"github.com/rynowak/workflow-recipe/pkg/backup"
+	"github.com/rynowak/workflow-recipe/pkg/inventory"
+	"github.com/rynowak/workflow-recipe/pkg/providers"
+	"github.com/rynowak/workflow-recipe/pkg/rabbitmq"
+)
+
+// Options are the dependencies of activities.
+type Options struct {
+	// Dapr is the client used by activities that persist state.
+	Dapr daprclient.Client
+	// StateStore is the name of the Dapr state store component used by activities.
+	StateStore string
+	// BackupStorage is where database backups are stored.
+	BackupStorage backup.Storage
+	// Dumper produces database backups.
+	Dumper backup.Dumper
+	// MySQLDumper produces backups of MySQL databases.
+	MySQLDumper backup.Dumper
+	// MongoDumper produces backups of MongoDB databases.
+	MongoDumper backup.Dumper
+	// Restorer restores database backups.
+	Restorer backup.Restorer
+	// ConfigMaps reads the ConfigMaps referenced by recipe parameters.
+	ConfigMaps ConfigMapReader
+	// Verifier checks that provisioned credentials can connect.
+	Verifier PostgresVerifier
+	// RabbitMQ is the client for the RabbitMQ management API. Nil if RabbitMQ is simulated.
+	RabbitMQ *rabbitmq.Client
+	// DatabaseServer manages the users and databases of the PostgreSQL server.
+	DatabaseServer providers.DatabaseServer
+	// Cluster deploys servers.
+	Cluster providers.ClusterDeployer
+	// Secrets writes the secrets applications read their credentials from.
+	Secrets providers.SecretWriter
+	// ServerPool is the registry of servers that databases can be placed on.
+	ServerPool *providers.ServerPool
+}
+
+var (
+	dapr           daprclient.Client
+	stateStore     string
+	inventoryStore *inventory.Store
+	backupStorage  backup.Storage
+	dumper         backup.Dumper
+	mysqlDumper    backup.Dumper
+	mongoDumper    backup.Dumper
+	restorer       backup.Restorer
+	configMaps     ConfigMapReader
+	verifier       PostgresVerifier
+	rabbitMQ       *rabbitmq.Client
+	databaseServer providers.DatabaseServer
+	cluster        providers.ClusterDeployer
+	secrets        providers.SecretWriter
+	serverPool     *providers.ServerPool
+)
+
+// Initialize configures the dependencies of activities. This must be called before the workflow worker is started.
+func Initialize(options Options) {
+	dapr = options.Dapr
+	stateStore = options.StateStore
+	inventoryStore = inventory.NewStore(options.Dapr, options.StateStore)
+	backupStorage = options.BackupStorage
+	dumper = options.Dumper
+	mysqlDumper = options.MySQLDumper
+	mongoDumper = options.MongoDumper
+	restorer = options.Restorer
+	configMaps = options.ConfigMaps
+	verifier = options.Verifier
+	rabbitMQ = options.RabbitMQ
+	databaseServer = options.DatabaseServer
+	cluster = options.Cluster
+	secrets = options.Secrets
+	serverPool = options.ServerPool
+}
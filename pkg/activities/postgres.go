@@ -1,12 +1,14 @@
 package activities
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
-	"time"
 
 	daprworkflow "github.com/dapr/go-sdk/workflow"
 	"github.com/google/uuid"
+	"github.com/rynowak/workflow-recipe/pkg/backup"
+	"github.com/rynowak/workflow-recipe/pkg/providers"
 )
 
 func CallCreatePostgresUser(ctx *daprworkflow.WorkflowContext, input CreatePostgresUserInput) (CreatePostgresUserOutput, error) {
@@ -22,6 +24,10 @@ func CallCreatePostgresUser(ctx *daprworkflow.WorkflowContext, input CreatePostg
 }
 
 type CreatePostgresUserInput struct {
+	// Username is the name of the user to create. Defaults to pguser.
+	Username string            `json:"username,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Server   ServerRef         `json:"server,omitempty"`
 }
 
 type CreatePostgresUserOutput struct {
@@ -36,13 +42,21 @@ func CreatePostgresUser(ctx daprworkflow.ActivityContext) (any, error) {
 		return nil, err
 	}
 
-	// Pretend we are very secure...
-	username := "pguser"
+	server, err := databaseServerFor(ctx.Context(), input.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	username := input.Username
+	if username == "" {
+		username = "pguser"
+	}
 	password := uuid.NewString()
 
-	logger := slog.Default()
-	logger.Info("Generating new postgres user", slog.String("username", "pguser"))
-	logger.Info("Generating really really secure password", slog.String("password", "********")) // Haha, just kidding
+	err = server.CreateUser(ctx.Context(), username, password, input.Labels)
+	if err != nil {
+		return nil, err
+	}
 
 	return CreatePostgresUserOutput{
 		Username: username,
@@ -64,6 +78,13 @@ func CallDeletePostgresUser(ctx *daprworkflow.WorkflowContext, input DeletePostg
 
 type DeletePostgresUserInput struct {
 	Username string `json:"username"`
+	// Database is a database the user has privileges in that is not being deleted, like an adopted database. The
+	// privileges are revoked, and anything the user owns is given to Successor, so the user can be deleted.
+	Database string `json:"database,omitempty"`
+	// Successor is the user that is given what the user owns in Database, like the user that replaces it when
+	// credentials are rotated. Empty to give it to the server admin.
+	Successor string    `json:"successor,omitempty"`
+	Server    ServerRef `json:"server,omitempty"`
 }
 
 type DeletePostgresUserOutput struct {
@@ -76,12 +97,198 @@ func DeletePostgresUser(ctx daprworkflow.ActivityContext) (any, error) {
 		return nil, err
 	}
 
-	logger := slog.Default()
-	logger.Info("Deleting postgres user", slog.String("username", input.Username))
+	server, err := databaseServerFor(ctx.Context(), input.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Database != "" {
+		user := providers.QuoteIdentifier(input.Username)
+		successor := "CURRENT_USER"
+		if input.Successor != "" {
+			successor = providers.QuoteIdentifier(input.Successor)
+		}
+
+		err = server.Exec(ctx.Context(), input.Database, []string{
+			fmt.Sprintf("REASSIGN OWNED BY %s TO %s", user, successor),
+			fmt.Sprintf("DROP OWNED BY %s", user),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = server.DeleteUser(ctx.Context(), input.Username)
+	if err != nil {
+		return nil, err
+	}
 
 	return DeletePostgresUserOutput{}, nil
 }
 
+func CallRevokePostgresUserLogin(ctx *daprworkflow.WorkflowContext, input RevokePostgresUserLoginInput) (RevokePostgresUserLoginOutput, error) {
+	task := ctx.CallActivity(RevokePostgresUserLogin, daprworkflow.ActivityInput(input))
+
+	output := RevokePostgresUserLoginOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return RevokePostgresUserLoginOutput{}, err
+	}
+
+	return output, nil
+}
+
+type RevokePostgresUserLoginInput struct {
+	Username string    `json:"username"`
+	Server   ServerRef `json:"server,omitempty"`
+}
+
+type RevokePostgresUserLoginOutput struct {
+}
+
+// RevokePostgresUserLogin stops a user from logging in, and ends its open sessions. The user is kept, so it still owns
+// its database and objects, and keeps its privileges.
+func RevokePostgresUserLogin(ctx daprworkflow.ActivityContext) (any, error) {
+	input := RevokePostgresUserLoginInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := databaseServerFor(ctx.Context(), input.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default()
+	logger.Info("Revoking postgres user login", slog.String("username", input.Username))
+
+	err = server.Exec(ctx.Context(), "postgres", []string{
+		fmt.Sprintf("ALTER ROLE %s NOLOGIN", providers.QuoteIdentifier(input.Username)),
+		fmt.Sprintf("SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE usename = %s", providers.QuoteLiteral(input.Username)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return RevokePostgresUserLoginOutput{}, nil
+}
+
+func CallRestorePostgresUserLogin(ctx *daprworkflow.WorkflowContext, input RestorePostgresUserLoginInput) (RestorePostgresUserLoginOutput, error) {
+	task := ctx.CallActivity(RestorePostgresUserLogin, daprworkflow.ActivityInput(input))
+
+	output := RestorePostgresUserLoginOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return RestorePostgresUserLoginOutput{}, err
+	}
+
+	return output, nil
+}
+
+type RestorePostgresUserLoginInput struct {
+	Username string    `json:"username"`
+	Server   ServerRef `json:"server,omitempty"`
+}
+
+type RestorePostgresUserLoginOutput struct {
+}
+
+// RestorePostgresUserLogin lets a user that was revoked with RevokePostgresUserLogin log in again, with the password
+// it had before.
+func RestorePostgresUserLogin(ctx daprworkflow.ActivityContext) (any, error) {
+	input := RestorePostgresUserLoginInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := databaseServerFor(ctx.Context(), input.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default()
+	logger.Info("Restoring postgres user login", slog.String("username", input.Username))
+
+	err = server.Exec(ctx.Context(), "postgres", []string{
+		fmt.Sprintf("ALTER ROLE %s LOGIN", providers.QuoteIdentifier(input.Username)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return RestorePostgresUserLoginOutput{}, nil
+}
+
+func CallGrantPostgresDatabaseAccess(ctx *daprworkflow.WorkflowContext, input GrantPostgresDatabaseAccessInput) (GrantPostgresDatabaseAccessOutput, error) {
+	task := ctx.CallActivity(GrantPostgresDatabaseAccess, daprworkflow.ActivityInput(input))
+
+	output := GrantPostgresDatabaseAccessOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return GrantPostgresDatabaseAccessOutput{}, err
+	}
+
+	return output, nil
+}
+
+type GrantPostgresDatabaseAccessInput struct {
+	Database string `json:"database"`
+	Username string `json:"username"`
+	// Role is the role profile of the user. Empty grants all privileges on the database.
+	Role PostgresRole `json:"role,omitempty"`
+	// Grants are the table privileges of a custom role.
+	Grants []string `json:"grants,omitempty"`
+	// Owner is the owner of the database. Tables it creates later are covered by the grants too. Empty if the database
+	// has no owner besides the server admin.
+	Owner string `json:"owner,omitempty"`
+	// Replaces is the user this user replaces when credentials are rotated. The user is made a member of it, so it can
+	// use everything the old user owns, like the tables created by migrations, until the old user is deleted.
+	Replaces string    `json:"replaces,omitempty"`
+	Server   ServerRef `json:"server,omitempty"`
+}
+
+type GrantPostgresDatabaseAccessOutput struct {
+}
+
+func GrantPostgresDatabaseAccess(ctx daprworkflow.ActivityContext) (any, error) {
+	input := GrantPostgresDatabaseAccessInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Role != "" && !input.Role.IsValid() {
+		return nil, fmt.Errorf("unsupported role %q", input.Role)
+	}
+
+	err = ValidatePostgresGrants(input.Role, input.Grants)
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := databaseServerFor(ctx.Context(), input.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	// The grants on the public schema only apply to the database they run in.
+	logger := slog.Default()
+	logger.Info("Granting user permission", slog.String("database", input.Database), slog.String("username", input.Username), slog.String("role", string(input.Role)))
+	statements := postgresGrantStatements(input.Database, input.Username, input.Role, input.Grants, input.Owner)
+	if input.Replaces != "" {
+		statements = append(statements, fmt.Sprintf("GRANT %s TO %s", providers.QuoteIdentifier(input.Replaces), providers.QuoteIdentifier(input.Username)))
+	}
+
+	err = server.Exec(ctx.Context(), input.Database, statements)
+	if err != nil {
+		return nil, err
+	}
+
+	return GrantPostgresDatabaseAccessOutput{}, nil
+}
+
 func CallCreatePostgresDatabase(ctx *daprworkflow.WorkflowContext, input CreatePostgresDatabaseInput) (CreatePostgresDatabaseOutput, error) {
 	task := ctx.CallActivity(CreatePostgresDatabase, daprworkflow.ActivityInput(input))
 
@@ -95,13 +302,21 @@ func CallCreatePostgresDatabase(ctx *daprworkflow.WorkflowContext, input CreateP
 }
 
 type CreatePostgresDatabaseInput struct {
-	Username       string `json:"username"`
-	Password       string `json:"password"`
-	DatabasePrefix string `json:"databasePrefix"`
+	// Username is the user the database is created for. Empty if the database has no owner besides the server admin.
+	Username       string            `json:"username"`
+	Password       string            `json:"password"`
+	DatabasePrefix string            `json:"databasePrefix"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	// Database is the database that was created for the resource before. It is kept if it exists, instead of creating
+	// a new one. Empty to create a new database named after DatabasePrefix.
+	Database string    `json:"database,omitempty"`
+	Server   ServerRef `json:"server,omitempty"`
 }
 
 type CreatePostgresDatabaseOutput struct {
 	Database string `json:"database"`
+	// Created is true if the database was created, and false if the database in the input already existed.
+	Created bool `json:"created,omitempty"`
 }
 
 func CreatePostgresDatabase(ctx daprworkflow.ActivityContext) (any, error) {
@@ -111,15 +326,41 @@ func CreatePostgresDatabase(ctx daprworkflow.ActivityContext) (any, error) {
 		return nil, err
 	}
 
-	// Pretend we are using a real database server...
-	database := fmt.Sprintf("%s_%s", input.DatabasePrefix, uuid.NewString())
+	server, err := databaseServerFor(ctx.Context(), input.Server)
+	if err != nil {
+		return nil, err
+	}
 
-	logger := slog.Default()
-	logger.Info("Creating new database", slog.String("database", database))
-	logger.Info("Granting user permission", slog.String("username", input.Username))
+	database := input.Database
+	if database != "" {
+		exists, err := server.DatabaseExists(ctx.Context(), database)
+		if err != nil {
+			return nil, err
+		}
+
+		if exists {
+			// The owner may have been created again since, so the database is given to it.
+			if input.Username != "" {
+				err = server.Exec(ctx.Context(), "postgres", []string{fmt.Sprintf("ALTER DATABASE %s OWNER TO %s", providers.QuoteIdentifier(database), providers.QuoteIdentifier(input.Username))})
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			return CreatePostgresDatabaseOutput{Database: database}, nil
+		}
+	} else {
+		database = fmt.Sprintf("%s_%s", input.DatabasePrefix, uuid.NewString())
+	}
+
+	err = server.CreateDatabase(ctx.Context(), database, input.Username, input.Labels)
+	if err != nil {
+		return nil, err
+	}
 
 	return CreatePostgresDatabaseOutput{
 		Database: database,
+		Created:  true,
 	}, nil
 }
 
@@ -136,11 +377,14 @@ func CallDeletePostgresDatabase(ctx *daprworkflow.WorkflowContext, input DeleteP
 }
 
 type DeletePostgresDatabaseInput struct {
-	Database     string `json:"database"`
-	CreateBackup bool   `json:"createBackup"`
+	Database     string    `json:"database"`
+	CreateBackup bool      `json:"createBackup"`
+	ResourceID   string    `json:"resourceId"`
+	Server       ServerRef `json:"server,omitempty"`
 }
 
 type DeletePostgresDatabaseOutput struct {
+	Backup *backup.Metadata `json:"backup,omitempty"`
 }
 
 func DeletePostgresDatabase(ctx daprworkflow.ActivityContext) (any, error) {
@@ -150,12 +394,206 @@ func DeletePostgresDatabase(ctx daprworkflow.ActivityContext) (any, error) {
 		return nil, err
 	}
 
-	// Pretend we are using a real database server...
+	logger := slog.Default()
+
+	output := DeletePostgresDatabaseOutput{}
+	if input.CreateBackup {
+		if backupStorage == nil {
+			return nil, errors.New("activities have not been initialized")
+		}
+
+		dumper, err := dumperFor(ctx.Context(), input.Server)
+		if err != nil {
+			return nil, err
+		}
+
+		logger.Info("Creating a backup", slog.String("database", input.Database), slog.String("storage", backupStorage.Name()))
+		output.Backup, err = backup.Create(ctx.Context(), backupStorage, dumper, backup.Request{
+			ResourceID: input.ResourceID,
+			Database:   input.Database,
+			Reason:     backup.ReasonDelete,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		logger.Info("Backup created",
+			slog.String("database", input.Database),
+			slog.String("location", output.Backup.Location),
+			slog.Int64("size", output.Backup.Size),
+			slog.String("checksum", output.Backup.Checksum))
+	}
+
+	server, err := databaseServerFor(ctx.Context(), input.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	err = server.DeleteDatabase(ctx.Context(), input.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+func CallFindPostgresResources(ctx *daprworkflow.WorkflowContext, input FindPostgresResourcesInput) (FindPostgresResourcesOutput, error) {
+	task := ctx.CallActivity(FindPostgresResources, daprworkflow.ActivityInput(input))
+
+	output := FindPostgresResourcesOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return FindPostgresResourcesOutput{}, err
+	}
+
+	return output, nil
+}
+
+type FindPostgresResourcesInput struct {
+	Labels map[string]string `json:"labels"`
+	Server ServerRef         `json:"server,omitempty"`
+}
+
+type FindPostgresResourcesOutput struct {
+	Databases []string `json:"databases"`
+	Users     []string `json:"users"`
+}
+
+func FindPostgresResources(ctx daprworkflow.ActivityContext) (any, error) {
+	input := FindPostgresResourcesInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := databaseServerFor(ctx.Context(), input.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	databases, users, err := server.FindByLabels(ctx.Context(), input.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	return FindPostgresResourcesOutput{
+		Databases: databases,
+		Users:     users,
+	}, nil
+}
+
+func CallGetPostgresDatabase(ctx *daprworkflow.WorkflowContext, input GetPostgresDatabaseInput) (GetPostgresDatabaseOutput, error) {
+	task := ctx.CallActivity(GetPostgresDatabase, daprworkflow.ActivityInput(input))
+
+	output := GetPostgresDatabaseOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return GetPostgresDatabaseOutput{}, err
+	}
+
+	return output, nil
+}
+
+type GetPostgresDatabaseInput struct {
+	Database string    `json:"database"`
+	Server   ServerRef `json:"server,omitempty"`
+}
+
+type GetPostgresDatabaseOutput struct {
+	Found bool `json:"found"`
+	// Host and Port are where applications connect to the server. Only set for servers in the pool.
+	Host string `json:"host,omitempty"`
+	Port int    `json:"port,omitempty"`
+}
+
+// GetPostgresDatabase looks up an existing database.
+func GetPostgresDatabase(ctx daprworkflow.ActivityContext) (any, error) {
+	input := GetPostgresDatabaseInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := databaseServerFor(ctx.Context(), input.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := server.DatabaseExists(ctx.Context(), input.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	output := GetPostgresDatabaseOutput{Found: found}
+	if input.Server != "" {
+		pooled, err := poolServer(string(input.Server))
+		if err != nil {
+			return nil, err
+		}
+
+		output.Host = pooled.Host
+		output.Port = pooled.Port
+	}
+
+	return output, nil
+}
+
+func CallRestorePostgresDatabase(ctx *daprworkflow.WorkflowContext, input RestorePostgresDatabaseInput) (RestorePostgresDatabaseOutput, error) {
+	task := ctx.CallActivity(RestorePostgresDatabase, daprworkflow.ActivityInput(input))
+
+	output := RestorePostgresDatabaseOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return RestorePostgresDatabaseOutput{}, err
+	}
+
+	return output, nil
+}
+
+type RestorePostgresDatabaseInput struct {
+	Database string          `json:"database"`
+	Backup   backup.Metadata `json:"backup"`
+	// Owner is the user that owns the restored tables. Empty for the server admin.
+	Owner  string    `json:"owner,omitempty"`
+	Server ServerRef `json:"server,omitempty"`
+}
+
+type RestorePostgresDatabaseOutput struct {
+	// Checksum is the verified checksum of the backup that was restored.
+	Checksum string `json:"checksum"`
+	// Size is the verified size of the backup that was restored.
+	Size int64 `json:"size"`
+}
+
+func RestorePostgresDatabase(ctx daprworkflow.ActivityContext) (any, error) {
+	input := RestorePostgresDatabaseInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	if backupStorage == nil {
+		return nil, errors.New("activities have not been initialized")
+	}
+
+	restorer, err := restorerFor(ctx.Context(), input.Server)
+	if err != nil {
+		return nil, err
+	}
 
 	logger := slog.Default()
-	logger.Info("Creating a backup", slog.String("database", input.Database))
-	time.Sleep(5 * time.Second)
-	logger.Info("Deleting database", slog.String("database", input.Database))
+	logger.Info("Restoring backup", slog.String("database", input.Database), slog.String("backup.id", input.Backup.ID))
 
-	return DeletePostgresDatabaseOutput{}, nil
+	// The backup's size and checksum are verified before anything is loaded into the database.
+	err = backup.Restore(ctx.Context(), backupStorage, restorer, input.Backup, input.Database, input.Owner)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Backup restored and verified", slog.String("database", input.Database), slog.String("checksum", input.Backup.Checksum))
+
+	return RestorePostgresDatabaseOutput{
+		Checksum: input.Backup.Checksum,
+		Size:     input.Backup.Size,
+	}, nil
 }
@@ -0,0 +1,142 @@
+package activities
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/rynowak/workflow-recipe/pkg/providers"
+)
+
+// PostgresRole is a role profile that determines what a user can do in a database.
+type PostgresRole string
+
+const (
+	// PostgresRoleOwner owns the database, and can change its schema.
+	PostgresRoleOwner PostgresRole = "owner"
+	// PostgresRoleReadWrite can read and write the data in every table, but cannot change the schema.
+	PostgresRoleReadWrite PostgresRole = "readWrite"
+	// PostgresRoleReadOnly can only read the data in every table.
+	PostgresRoleReadOnly PostgresRole = "readOnly"
+	// PostgresRoleCustom has the table privileges listed in its grants.
+	PostgresRoleCustom PostgresRole = "custom"
+)
+
+var (
+	// PostgresTablePrivileges are the privileges that can be granted to a custom role.
+	PostgresTablePrivileges = []string{"SELECT", "INSERT", "UPDATE", "DELETE", "TRUNCATE", "REFERENCES", "TRIGGER"}
+)
+
+// IsValid returns true if the role is a known role profile.
+func (r PostgresRole) IsValid() bool {
+	switch r {
+	case PostgresRoleOwner, PostgresRoleReadWrite, PostgresRoleReadOnly, PostgresRoleCustom:
+		return true
+	default:
+		return false
+	}
+}
+
+// ValidatePostgresGrants returns an error if the grants are not valid for the role. Only custom roles have grants.
+func ValidatePostgresGrants(role PostgresRole, grants []string) error {
+	if role != PostgresRoleCustom {
+		if len(grants) > 0 {
+			return fmt.Errorf("grants can only be set for the %s role", PostgresRoleCustom)
+		}
+		return nil
+	}
+
+	if len(grants) == 0 {
+		return fmt.Errorf("the %s role requires at least one grant", PostgresRoleCustom)
+	}
+
+	for _, grant := range grants {
+		if !slices.Contains(PostgresTablePrivileges, strings.ToUpper(grant)) {
+			return fmt.Errorf("unsupported grant %q: supported grants are %s", grant, strings.Join(PostgresTablePrivileges, ", "))
+		}
+	}
+
+	return nil
+}
+
+// postgresGrantStatements returns the SQL statements that give a user the privileges of a role in a database. An
+// empty role grants all privileges on the database, like the user created with the database. The privileges cover
+// tables created later by the server admin, and by owner if it is set, since default privileges only apply to the
+// tables created by the role they are defined for.
+func postgresGrantStatements(database string, username string, role PostgresRole, grants []string, owner string) []string {
+	db := providers.QuoteIdentifier(database)
+	user := providers.QuoteIdentifier(username)
+
+	tablePrivileges := ""
+	switch role {
+	case "":
+		return []string{fmt.Sprintf("GRANT ALL PRIVILEGES ON DATABASE %s TO %s", db, user)}
+
+	case PostgresRoleOwner:
+		return []string{
+			fmt.Sprintf("ALTER DATABASE %s OWNER TO %s", db, user),
+			fmt.Sprintf("GRANT ALL PRIVILEGES ON DATABASE %s TO %s", db, user),
+			fmt.Sprintf("ALTER SCHEMA public OWNER TO %s", user),
+		}
+
+	case PostgresRoleReadWrite:
+		tablePrivileges = "SELECT, INSERT, UPDATE, DELETE"
+
+	case PostgresRoleReadOnly:
+		tablePrivileges = "SELECT"
+
+	case PostgresRoleCustom:
+		normalized := []string{}
+		for _, grant := range grants {
+			normalized = append(normalized, strings.ToUpper(grant))
+		}
+		tablePrivileges = strings.Join(normalized, ", ")
+	}
+
+	// Default privileges make the grants apply to tables created later too.
+	creators := []string{""}
+	if owner != "" && owner != username {
+		creators = append(creators, fmt.Sprintf(" FOR ROLE %s", providers.QuoteIdentifier(owner)))
+	}
+
+	statements := []string{
+		fmt.Sprintf("GRANT CONNECT ON DATABASE %s TO %s", db, user),
+		fmt.Sprintf("GRANT USAGE ON SCHEMA public TO %s", user),
+		fmt.Sprintf("GRANT %s ON ALL TABLES IN SCHEMA public TO %s", tablePrivileges, user),
+	}
+	for _, creator := range creators {
+		statements = append(statements, fmt.Sprintf("ALTER DEFAULT PRIVILEGES%s IN SCHEMA public GRANT %s ON TABLES TO %s", creator, tablePrivileges, user))
+	}
+
+	if role == PostgresRoleReadWrite {
+		statements = append(statements, fmt.Sprintf("GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public TO %s", user))
+		for _, creator := range creators {
+			statements = append(statements, fmt.Sprintf("ALTER DEFAULT PRIVILEGES%s IN SCHEMA public GRANT USAGE, SELECT ON SEQUENCES TO %s", creator, user))
+		}
+	}
+
+	return statements
+}
+
+// postgresGrantChecks returns queries that return true if the current user has the privileges of a role in the
+// current database. Table privileges are not checked, because a new database might not have any tables yet.
+func postgresGrantChecks(role PostgresRole) []string {
+	checks := []string{
+		"SELECT has_database_privilege(current_database(), 'CONNECT')",
+	}
+
+	switch role {
+	case "":
+		checks = append(checks, "SELECT has_database_privilege(current_database(), 'CREATE')")
+
+	case PostgresRoleOwner:
+		checks = append(checks,
+			"SELECT has_database_privilege(current_database(), 'CREATE')",
+			"SELECT has_schema_privilege('public', 'CREATE')")
+
+	default:
+		checks = append(checks, "SELECT has_schema_privilege('public', 'USAGE')")
+	}
+
+	return checks
+}
@@ -0,0 +1,98 @@
+package activities
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPostgresGrantStatements(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		role     PostgresRole
+		grants   []string
+		owner    string
+		want     []string
+	}{
+		{
+			name:     "all privileges",
+			username: "app",
+			want:     []string{`GRANT ALL PRIVILEGES ON DATABASE "orders" TO "app"`},
+		},
+		{
+			name:     "owner",
+			username: "app",
+			role:     PostgresRoleOwner,
+			owner:    "app",
+			want: []string{
+				`ALTER DATABASE "orders" OWNER TO "app"`,
+				`GRANT ALL PRIVILEGES ON DATABASE "orders" TO "app"`,
+				`ALTER SCHEMA public OWNER TO "app"`,
+			},
+		},
+		{
+			name:     "read only covers tables the owner creates",
+			username: "reporting",
+			role:     PostgresRoleReadOnly,
+			owner:    "app",
+			want: []string{
+				`GRANT CONNECT ON DATABASE "orders" TO "reporting"`,
+				`GRANT USAGE ON SCHEMA public TO "reporting"`,
+				`GRANT SELECT ON ALL TABLES IN SCHEMA public TO "reporting"`,
+				`ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT ON TABLES TO "reporting"`,
+				`ALTER DEFAULT PRIVILEGES FOR ROLE "app" IN SCHEMA public GRANT SELECT ON TABLES TO "reporting"`,
+			},
+		},
+		{
+			name:     "read write covers sequences the owner creates",
+			username: "worker",
+			role:     PostgresRoleReadWrite,
+			owner:    "app",
+			want: []string{
+				`GRANT CONNECT ON DATABASE "orders" TO "worker"`,
+				`GRANT USAGE ON SCHEMA public TO "worker"`,
+				`GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO "worker"`,
+				`ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO "worker"`,
+				`ALTER DEFAULT PRIVILEGES FOR ROLE "app" IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO "worker"`,
+				`GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public TO "worker"`,
+				`ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT USAGE, SELECT ON SEQUENCES TO "worker"`,
+				`ALTER DEFAULT PRIVILEGES FOR ROLE "app" IN SCHEMA public GRANT USAGE, SELECT ON SEQUENCES TO "worker"`,
+			},
+		},
+		{
+			name:     "custom without an owner only covers the admin",
+			username: "auditor",
+			role:     PostgresRoleCustom,
+			grants:   []string{"select", "references"},
+			want: []string{
+				`GRANT CONNECT ON DATABASE "orders" TO "auditor"`,
+				`GRANT USAGE ON SCHEMA public TO "auditor"`,
+				`GRANT SELECT, REFERENCES ON ALL TABLES IN SCHEMA public TO "auditor"`,
+				`ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT, REFERENCES ON TABLES TO "auditor"`,
+			},
+		},
+		{
+			name:     "owner names are quoted",
+			username: "reporting",
+			role:     PostgresRoleReadOnly,
+			owner:    `app"; DROP TABLE x; --`,
+			want: []string{
+				`GRANT CONNECT ON DATABASE "orders" TO "reporting"`,
+				`GRANT USAGE ON SCHEMA public TO "reporting"`,
+				`GRANT SELECT ON ALL TABLES IN SCHEMA public TO "reporting"`,
+				`ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT ON TABLES TO "reporting"`,
+				`ALTER DEFAULT PRIVILEGES FOR ROLE "app""; DROP TABLE x; --" IN SCHEMA public GRANT SELECT ON TABLES TO "reporting"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := postgresGrantStatements("orders", tt.username, tt.role, tt.grants, tt.owner)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got statements\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package activities
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/rynowak/workflow-recipe/pkg/providers"
+)
+
+const (
+	// PostgresMigrationsTable is the table in each database that records the migrations that were applied.
+	PostgresMigrationsTable = providers.MigrationsTable
+)
+
+var (
+	// PostgresExtensions are the extensions that can be enabled in a database.
+	PostgresExtensions = []string{
+		"btree_gin", "btree_gist", "citext", "cube", "fuzzystrmatch", "hstore", "intarray", "ltree", "pg_stat_statements",
+		"pg_trgm", "pgcrypto", "postgis", "postgis_topology", "tablefunc", "unaccent", "uuid-ossp", "vector",
+	}
+
+	migrationIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,127}$`)
+)
+
+// ValidatePostgresExtension returns an error if the extension can't be enabled in a database.
+func ValidatePostgresExtension(extension string) error {
+	if !slices.Contains(PostgresExtensions, extension) {
+		return fmt.Errorf("unsupported extension %q: supported extensions are %s", extension, strings.Join(PostgresExtensions, ", "))
+	}
+
+	return nil
+}
+
+// PostgresMigration is a SQL script that is applied to a database once. The SQL is either inline, or read from a
+// ConfigMap in the namespace of the resource.
+type PostgresMigration struct {
+	// ID identifies the migration in the migrations table. Changing the ID of an applied migration applies it again.
+	ID string `json:"id"`
+	// SQL is the inline SQL of the migration.
+	SQL string `json:"sql,omitempty"`
+	// ConfigMap refers to the ConfigMap key that contains the SQL of the migration.
+	ConfigMap *ConfigMapKeyRef `json:"configMap,omitempty"`
+}
+
+// Validate returns an error if the migration doesn't have a valid ID and exactly one source of SQL.
+func (m PostgresMigration) Validate() error {
+	if !migrationIDPattern.MatchString(m.ID) {
+		return fmt.Errorf("invalid migration id %q: must start with a letter or digit and contain only letters, digits, '_', '.', and '-'", m.ID)
+	}
+
+	if m.SQL == "" && m.ConfigMap == nil {
+		return fmt.Errorf("migration %q must set one of sql or configMap", m.ID)
+	} else if m.SQL != "" && m.ConfigMap != nil {
+		return fmt.Errorf("migration %q can only set one of sql or configMap", m.ID)
+	} else if m.ConfigMap != nil {
+		err := m.ConfigMap.Validate()
+		if err != nil {
+			return fmt.Errorf("migration %q: %w", m.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func CallEnablePostgresExtensions(ctx *daprworkflow.WorkflowContext, input EnablePostgresExtensionsInput) (EnablePostgresExtensionsOutput, error) {
+	task := ctx.CallActivity(EnablePostgresExtensions, daprworkflow.ActivityInput(input))
+
+	output := EnablePostgresExtensionsOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return EnablePostgresExtensionsOutput{}, err
+	}
+
+	return output, nil
+}
+
+type EnablePostgresExtensionsInput struct {
+	Database   string    `json:"database"`
+	Extensions []string  `json:"extensions"`
+	Server     ServerRef `json:"server,omitempty"`
+}
+
+type EnablePostgresExtensionsOutput struct {
+}
+
+func EnablePostgresExtensions(ctx daprworkflow.ActivityContext) (any, error) {
+	input := EnablePostgresExtensionsInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, extension := range input.Extensions {
+		err = ValidatePostgresExtension(extension)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	server, err := databaseServerFor(ctx.Context(), input.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	// Extensions are enabled by the server admin, because most of them can only be created by a superuser.
+	logger := slog.Default()
+	statements := []string{}
+	for _, extension := range input.Extensions {
+		logger.Info("Enabling extension", slog.String("database", input.Database), slog.String("extension", extension))
+		statements = append(statements, fmt.Sprintf("CREATE EXTENSION IF NOT EXISTS %s", providers.QuoteIdentifier(extension)))
+	}
+
+	err = server.Exec(ctx.Context(), input.Database, statements)
+	if err != nil {
+		return nil, err
+	}
+
+	return EnablePostgresExtensionsOutput{}, nil
+}
+
+func CallApplyPostgresMigrations(ctx *daprworkflow.WorkflowContext, input ApplyPostgresMigrationsInput) (ApplyPostgresMigrationsOutput, error) {
+	task := ctx.CallActivity(ApplyPostgresMigrations, daprworkflow.ActivityInput(input))
+
+	output := ApplyPostgresMigrationsOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return ApplyPostgresMigrationsOutput{}, err
+	}
+
+	return output, nil
+}
+
+type ApplyPostgresMigrationsInput struct {
+	Database string `json:"database"`
+	// Namespace is the Kubernetes namespace of the ConfigMaps the migrations refer to.
+	Namespace string `json:"namespace"`
+	// Username is the user the migrations run as, so it owns the objects they create. Empty to run as the server admin.
+	Username   string              `json:"username,omitempty"`
+	Migrations []PostgresMigration `json:"migrations"`
+	Server     ServerRef           `json:"server,omitempty"`
+}
+
+type ApplyPostgresMigrationsOutput struct {
+	// Applied are the IDs of the migrations that were applied.
+	Applied []string `json:"applied"`
+	// Skipped are the IDs of the migrations that had already been applied.
+	Skipped []string `json:"skipped"`
+}
+
+func ApplyPostgresMigrations(ctx daprworkflow.ActivityContext) (any, error) {
+	input := ApplyPostgresMigrationsInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default().With(slog.String("database", input.Database))
+
+	// Resolve every migration before applying any of them, so a bad reference doesn't leave a partial schema.
+	scripts := make([]string, len(input.Migrations))
+	for i, migration := range input.Migrations {
+		err = migration.Validate()
+		if err != nil {
+			return nil, err
+		}
+
+		scripts[i] = migration.SQL
+		if migration.ConfigMap != nil {
+			if configMaps == nil {
+				return nil, errors.New("activities have not been initialized")
+			}
+
+			scripts[i], err = configMaps.Read(ctx.Context(), input.Namespace, *migration.ConfigMap)
+			if err != nil {
+				return nil, fmt.Errorf("error reading migration %q: %w", migration.ID, err)
+			}
+		}
+	}
+
+	server, err := databaseServerFor(ctx.Context(), input.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := server.AppliedMigrations(ctx.Context(), input.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	output := ApplyPostgresMigrationsOutput{Applied: []string{}, Skipped: []string{}}
+	for i, migration := range input.Migrations {
+		hash := sha256.Sum256([]byte(scripts[i]))
+		checksum := hex.EncodeToString(hash[:])
+
+		// Applied migrations can't be edited, because the change would never reach databases that already ran them.
+		if existing, ok := applied[migration.ID]; ok && existing != checksum {
+			return nil, fmt.Errorf("migration %q was changed after it was applied: add a new migration instead", migration.ID)
+		} else if ok {
+			logger.Info("Migration was already applied", slog.String("migration", migration.ID))
+			output.Skipped = append(output.Skipped, migration.ID)
+			continue
+		}
+
+		// Each migration runs in its own transaction with the row that records it.
+		logger.Info("Applying migration", slog.String("migration", migration.ID), slog.String("checksum", checksum))
+		err = server.ApplyMigration(ctx.Context(), input.Database, input.Username, providers.Migration{
+			ID:       migration.ID,
+			Checksum: checksum,
+			SQL:      scripts[i],
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error applying migration %q: %w", migration.ID, err)
+		}
+
+		output.Applied = append(output.Applied, migration.ID)
+	}
+
+	return output, nil
+}
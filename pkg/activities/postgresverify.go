@@ -0,0 +1,173 @@
+package activities
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/rynowak/workflow-recipe/pkg/providers"
+)
+
+const (
+	// PostgresVerifyTimeout is how long a single verification attempt can take.
+	PostgresVerifyTimeout = 15 * time.Second
+)
+
+// PostgresConnection is the information needed to connect to a database as a user.
+type PostgresConnection struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Database string `json:"database"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// PostgresVerifier checks that a user can connect to a database.
+type PostgresVerifier interface {
+	// Verify connects to the database, runs a probe query, and then runs each check. A check is a query that returns
+	// a single boolean. Returns an error if the connection fails or a check returns false.
+	Verify(ctx context.Context, connection PostgresConnection, checks []string) error
+}
+
+// PsqlVerifier verifies connections with psql.
+type PsqlVerifier struct {
+	// Path is the path of the psql binary. Defaults to psql on the PATH.
+	Path string
+}
+
+var _ PostgresVerifier = (*PsqlVerifier)(nil)
+
+func (v *PsqlVerifier) Verify(ctx context.Context, connection PostgresConnection, checks []string) error {
+	// Dial first, so DNS and Service endpoint problems are reported as such instead of as a psql failure.
+	address := net.JoinHostPort(connection.Host, strconv.Itoa(connection.Port))
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("error connecting to %s: %w", address, err)
+	}
+	_ = conn.Close()
+
+	server := url.URL{
+		Scheme: "postgresql",
+		User:   url.UserPassword(connection.Username, connection.Password),
+		Host:   address,
+	}
+	uri, env, err := providers.PostgresCommandEnv(server.String(), connection.Database)
+	if err != nil {
+		return err
+	}
+
+	path := v.Path
+	if path == "" {
+		path = "psql"
+	}
+
+	for _, query := range append([]string{"SELECT true"}, checks...) {
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+		cmd := exec.CommandContext(ctx, path, "--no-psqlrc", "--tuples-only", "--no-align", "--dbname", uri, "--command", query)
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		cmd.Env = env
+		err = cmd.Run()
+		if err != nil {
+			return fmt.Errorf("psql failed: %w: %s", err, stderr.String())
+		}
+
+		if result := strings.TrimSpace(stdout.String()); result != "t" {
+			return fmt.Errorf("check %q returned %q", query, result)
+		}
+	}
+
+	return nil
+}
+
+// SimulatedVerifier verifies connections for demos, where there is no real database to connect to.
+type SimulatedVerifier struct {
+}
+
+var _ PostgresVerifier = (*SimulatedVerifier)(nil)
+
+func (v *SimulatedVerifier) Verify(ctx context.Context, connection PostgresConnection, checks []string) error {
+	// Pretend we are connecting to the database...
+	logger := slog.Default()
+	logger.Info("Connecting to database", slog.String("host", connection.Host), slog.Int("port", connection.Port), slog.String("database", connection.Database), slog.String("username", connection.Username))
+	for _, query := range checks {
+		logger.Info("Executing SQL", slog.String("statement", query))
+	}
+
+	return nil
+}
+
+// NewVerifierFromEnv creates a PostgresVerifier that uses psql if the DATABASE_SERVER_PROVIDER environment variable
+// selects the postgres provider, and simulates verification otherwise. PSQL_PATH overrides the location of psql.
+func NewVerifierFromEnv() PostgresVerifier {
+	if os.Getenv("DATABASE_SERVER_PROVIDER") != providers.Postgres {
+		return &SimulatedVerifier{}
+	}
+
+	return &PsqlVerifier{Path: os.Getenv("PSQL_PATH")}
+}
+
+func CallVerifyPostgresConnection(ctx *daprworkflow.WorkflowContext, input VerifyPostgresConnectionInput) (VerifyPostgresConnectionOutput, error) {
+	task := ctx.CallActivity(VerifyPostgresConnection, daprworkflow.ActivityInput(input))
+
+	output := VerifyPostgresConnectionOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return VerifyPostgresConnectionOutput{}, err
+	}
+
+	return output, nil
+}
+
+type VerifyPostgresConnectionInput struct {
+	Connection PostgresConnection `json:"connection"`
+	// Role is the role profile of the user. The user's privileges are checked against it.
+	Role PostgresRole `json:"role,omitempty"`
+}
+
+type VerifyPostgresConnectionOutput struct {
+	// Verified is true if the user connected and has the privileges of its role.
+	Verified bool `json:"verified"`
+	// Error describes why verification failed.
+	Error string `json:"error,omitempty"`
+}
+
+// VerifyPostgresConnection reports a failed verification in its output instead of failing, so the workflow can
+// decide whether to retry.
+func VerifyPostgresConnection(ctx daprworkflow.ActivityContext) (any, error) {
+	input := VerifyPostgresConnectionInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	if verifier == nil {
+		return nil, errors.New("activities have not been initialized")
+	}
+
+	logger := slog.Default().With(slog.String("database", input.Connection.Database), slog.String("username", input.Connection.Username))
+
+	verifyCtx, cancel := context.WithTimeout(ctx.Context(), PostgresVerifyTimeout)
+	defer cancel()
+
+	err = verifier.Verify(verifyCtx, input.Connection, postgresGrantChecks(input.Role))
+	if err != nil {
+		logger.Warn("Connection verification failed", slog.Any("error", err))
+		return VerifyPostgresConnectionOutput{Verified: false, Error: err.Error()}, nil
+	}
+
+	logger.Info("Connection verified")
+	return VerifyPostgresConnectionOutput{Verified: true}, nil
+}
@@ -0,0 +1,228 @@
+package activities
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/google/uuid"
+	"github.com/rynowak/workflow-recipe/pkg/providers"
+	"github.com/rynowak/workflow-recipe/pkg/rabbitmq"
+)
+
+const (
+	// RabbitMQManagementPort is the port of the management API of a deployed RabbitMQ server.
+	RabbitMQManagementPort = 15672
+)
+
+func CallCreateRabbitMQQueue(ctx *daprworkflow.WorkflowContext, input CreateRabbitMQQueueInput) (CreateRabbitMQQueueOutput, error) {
+	task := ctx.CallActivity(CreateRabbitMQQueue, daprworkflow.ActivityInput(input))
+
+	output := CreateRabbitMQQueueOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return CreateRabbitMQQueueOutput{}, err
+	}
+
+	return output, nil
+}
+
+type CreateRabbitMQQueueInput struct {
+	VHost string `json:"vhost"`
+	Queue string `json:"queue"`
+	// Username is the name of the user that can use the vhost.
+	Username string `json:"username"`
+	// Server is the DeploymentID of the RabbitMQ server. Empty for the server at RABBITMQ_MANAGEMENT_URL.
+	Server string `json:"server,omitempty"`
+}
+
+type CreateRabbitMQQueueOutput struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// CreateRabbitMQQueue creates a vhost, a user that can only use that vhost, and a durable queue in it.
+func CreateRabbitMQQueue(ctx daprworkflow.ActivityContext) (any, error) {
+	input := CreateRabbitMQQueueInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	return createRabbitMQQueue(ctx.Context(), input)
+}
+
+func createRabbitMQQueue(ctx context.Context, input CreateRabbitMQQueueInput) (CreateRabbitMQQueueOutput, error) {
+	if input.Username == "" {
+		return CreateRabbitMQQueueOutput{}, errors.New("username is required")
+	}
+
+	client, found, err := rabbitMQFor(ctx, input.Server)
+	if err != nil {
+		return CreateRabbitMQQueueOutput{}, err
+	} else if !found {
+		return CreateRabbitMQQueueOutput{}, fmt.Errorf("server %q has no admin credentials: it must be deployed again", input.Server)
+	}
+
+	username := input.Username
+	password := uuid.NewString()
+
+	logger := slog.Default().With(slog.String("vhost", input.VHost), slog.String("queue", input.Queue), slog.String("username", username))
+
+	if client == nil {
+		// Pretend we are using a real RabbitMQ server...
+		logger.Info("Creating RabbitMQ vhost")
+		logger.Info("Creating RabbitMQ user")
+		logger.Info("Granting RabbitMQ user permission")
+		logger.Info("Declaring RabbitMQ queue")
+
+		return CreateRabbitMQQueueOutput{Username: username, Password: password}, nil
+	}
+
+	logger.Info("Creating RabbitMQ vhost")
+	err = client.PutVHost(ctx, input.VHost)
+	if err != nil {
+		return CreateRabbitMQQueueOutput{}, err
+	}
+
+	logger.Info("Creating RabbitMQ user")
+	err = client.PutUser(ctx, username, password)
+	if err != nil {
+		return CreateRabbitMQQueueOutput{}, err
+	}
+
+	logger.Info("Granting RabbitMQ user permission")
+	err = client.PutPermissions(ctx, input.VHost, username, rabbitmq.Permissions{Configure: ".*", Write: ".*", Read: ".*"})
+	if err != nil {
+		return CreateRabbitMQQueueOutput{}, err
+	}
+
+	logger.Info("Declaring RabbitMQ queue")
+	err = client.PutQueue(ctx, input.VHost, input.Queue, rabbitmq.Queue{Durable: true})
+	if err != nil {
+		return CreateRabbitMQQueueOutput{}, err
+	}
+
+	return CreateRabbitMQQueueOutput{Username: username, Password: password}, nil
+}
+
+func CallDeleteRabbitMQQueue(ctx *daprworkflow.WorkflowContext, input DeleteRabbitMQQueueInput) (DeleteRabbitMQQueueOutput, error) {
+	task := ctx.CallActivity(DeleteRabbitMQQueue, daprworkflow.ActivityInput(input))
+
+	output := DeleteRabbitMQQueueOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return DeleteRabbitMQQueueOutput{}, err
+	}
+
+	return output, nil
+}
+
+type DeleteRabbitMQQueueInput struct {
+	VHost    string `json:"vhost"`
+	Queue    string `json:"queue,omitempty"`
+	Username string `json:"username,omitempty"`
+	// Server is the DeploymentID of the RabbitMQ server. Empty for the server at RABBITMQ_MANAGEMENT_URL.
+	Server string `json:"server,omitempty"`
+}
+
+type DeleteRabbitMQQueueOutput struct {
+}
+
+// DeleteRabbitMQQueue deletes the queue, user, and vhost created by CreateRabbitMQQueue. Anything that is already
+// gone is skipped. Empty names are skipped too.
+func DeleteRabbitMQQueue(ctx daprworkflow.ActivityContext) (any, error) {
+	input := DeleteRabbitMQQueueInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	return deleteRabbitMQQueue(ctx.Context(), input)
+}
+
+func deleteRabbitMQQueue(ctx context.Context, input DeleteRabbitMQQueueInput) (DeleteRabbitMQQueueOutput, error) {
+	logger := slog.Default().With(slog.String("vhost", input.VHost), slog.String("queue", input.Queue), slog.String("username", input.Username))
+
+	client, found, err := rabbitMQFor(ctx, input.Server)
+	if err != nil {
+		return DeleteRabbitMQQueueOutput{}, err
+	} else if !found {
+		// The server was deleted, and everything on it with it.
+		logger.Info("Skipping RabbitMQ deletion because the server is gone", slog.String("server", input.Server))
+		return DeleteRabbitMQQueueOutput{}, nil
+	}
+
+	if client == nil {
+		// Pretend we are using a real RabbitMQ server...
+		logger.Info("Deleting RabbitMQ queue")
+		logger.Info("Deleting RabbitMQ user")
+		logger.Info("Deleting RabbitMQ vhost")
+
+		return DeleteRabbitMQQueueOutput{}, nil
+	}
+
+	if input.VHost != "" && input.Queue != "" {
+		logger.Info("Deleting RabbitMQ queue")
+		err = client.DeleteQueue(ctx, input.VHost, input.Queue)
+		if err != nil && !errors.Is(err, rabbitmq.ErrNotFound) {
+			return DeleteRabbitMQQueueOutput{}, err
+		}
+	}
+
+	if input.Username != "" {
+		logger.Info("Deleting RabbitMQ user")
+		err = client.DeleteUser(ctx, input.Username)
+		if err != nil && !errors.Is(err, rabbitmq.ErrNotFound) {
+			return DeleteRabbitMQQueueOutput{}, err
+		}
+	}
+
+	if input.VHost != "" {
+		logger.Info("Deleting RabbitMQ vhost")
+		err = client.DeleteVHost(ctx, input.VHost)
+		if err != nil && !errors.Is(err, rabbitmq.ErrNotFound) {
+			return DeleteRabbitMQQueueOutput{}, err
+		}
+	}
+
+	return DeleteRabbitMQQueueOutput{}, nil
+}
+
+// rabbitMQFor returns the client for the management API of a deployed server, or the client for
+// RABBITMQ_MANAGEMENT_URL if server is empty. The client is nil if RabbitMQ is simulated. Returns false if the server
+// has no admin credentials, because it was never deployed or was deleted.
+func rabbitMQFor(ctx context.Context, server string) (*rabbitmq.Client, bool, error) {
+	if server == "" {
+		return rabbitMQ, true, nil
+	}
+
+	namespace, name, ok := parseDeploymentID(server)
+	if !ok {
+		return nil, false, fmt.Errorf("server %q is not the ID of a deployed server", server)
+	}
+
+	// A simulated cluster doesn't deploy a server to connect to.
+	if cluster == nil {
+		return nil, false, errors.New("activities have not been initialized")
+	} else if cluster.Name() == providers.Simulated {
+		return rabbitMQ, true, nil
+	}
+
+	admin, found, err := getServerAdmin(ctx, namespace, name)
+	if err != nil {
+		return nil, false, err
+	} else if !found || admin.Host == "" {
+		return nil, false, nil
+	}
+
+	return &rabbitmq.Client{
+		URL:      "http://" + net.JoinHostPort(admin.Host, strconv.Itoa(RabbitMQManagementPort)),
+		Username: admin.Username,
+		Password: admin.Password,
+	}, true, nil
+}
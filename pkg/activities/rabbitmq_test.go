@@ -0,0 +1,147 @@
+package activities
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/rynowak/workflow-recipe/pkg/providers"
+	"github.com/rynowak/workflow-recipe/pkg/rabbitmq"
+)
+
+// useTestRabbitMQ points the activities at a management API that responds to each path with the status in statuses,
+// or 204 if the path is not in it. Returns the requests it receives, as "METHOD path".
+func useTestRabbitMQ(t *testing.T, statuses map[string]int) *[]string {
+	t.Helper()
+
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.EscapedPath())
+
+		status, ok := statuses[r.URL.EscapedPath()]
+		if !ok {
+			status = http.StatusNoContent
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	previousClient, previousCluster := rabbitMQ, cluster
+	rabbitMQ = &rabbitmq.Client{URL: server.URL, Username: "admin", Password: "secret"}
+	cluster = &providers.SimulatedCluster{}
+	t.Cleanup(func() {
+		rabbitMQ, cluster = previousClient, previousCluster
+	})
+
+	return &requests
+}
+
+func TestCreateRabbitMQQueue(t *testing.T) {
+	requests := useTestRabbitMQ(t, nil)
+
+	output, err := createRabbitMQQueue(context.Background(), CreateRabbitMQQueueInput{
+		VHost:    "orders",
+		Queue:    "incoming",
+		Username: "rabbitmquser-1234",
+		// A simulated cluster uses the default client.
+		Server: DeploymentID("default", "orders"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if output.Username != "rabbitmquser-1234" || output.Password == "" {
+		t.Errorf("got credentials %+v, want the username and a generated password", output)
+	}
+
+	want := []string{
+		"PUT /api/vhosts/orders",
+		"PUT /api/users/rabbitmquser-1234",
+		"PUT /api/permissions/orders/rabbitmquser-1234",
+		"PUT /api/queues/orders/incoming",
+	}
+	if !slices.Equal(*requests, want) {
+		t.Errorf("got requests %v, want %v", *requests, want)
+	}
+}
+
+func TestCreateRabbitMQQueue_Error(t *testing.T) {
+	requests := useTestRabbitMQ(t, map[string]int{"/api/users/rabbitmquser-1234": http.StatusBadRequest})
+
+	_, err := createRabbitMQQueue(context.Background(), CreateRabbitMQQueueInput{VHost: "orders", Queue: "incoming", Username: "rabbitmquser-1234"})
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Fatalf("got error %v, want a 400 error", err)
+	}
+
+	// Nothing is granted to a user that wasn't created.
+	if len(*requests) != 2 {
+		t.Errorf("got requests %v, want it to stop after the user", *requests)
+	}
+}
+
+func TestCreateRabbitMQQueue_InvalidServer(t *testing.T) {
+	useTestRabbitMQ(t, nil)
+
+	_, err := createRabbitMQQueue(context.Background(), CreateRabbitMQQueueInput{VHost: "orders", Queue: "incoming", Username: "app", Server: "not-a-deployment"})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestDeleteRabbitMQQueue(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    DeleteRabbitMQQueueInput
+		statuses map[string]int
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:  "deletes everything",
+			input: DeleteRabbitMQQueueInput{VHost: "orders", Queue: "incoming", Username: "app"},
+			want:  []string{"DELETE /api/queues/orders/incoming", "DELETE /api/users/app", "DELETE /api/vhosts/orders"},
+		},
+		{
+			name:  "skips what is already gone",
+			input: DeleteRabbitMQQueueInput{VHost: "orders", Queue: "incoming", Username: "app"},
+			statuses: map[string]int{
+				"/api/queues/orders/incoming": http.StatusNotFound,
+				"/api/users/app":              http.StatusNotFound,
+				"/api/vhosts/orders":          http.StatusNotFound,
+			},
+			want: []string{"DELETE /api/queues/orders/incoming", "DELETE /api/users/app", "DELETE /api/vhosts/orders"},
+		},
+		{
+			name:  "skips empty names",
+			input: DeleteRabbitMQQueueInput{VHost: "orders"},
+			want:  []string{"DELETE /api/vhosts/orders"},
+		},
+		{
+			name:     "fails on other errors",
+			input:    DeleteRabbitMQQueueInput{VHost: "orders", Queue: "incoming", Username: "app"},
+			statuses: map[string]int{"/api/users/app": http.StatusInternalServerError},
+			want:     []string{"DELETE /api/queues/orders/incoming", "DELETE /api/users/app"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := useTestRabbitMQ(t, tt.statuses)
+
+			_, err := deleteRabbitMQQueue(context.Background(), tt.input)
+			if tt.wantErr && err == nil {
+				t.Fatal("expected an error")
+			} else if !tt.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !slices.Equal(*requests, tt.want) {
+				t.Errorf("got requests %v, want %v", *requests, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package activities
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/google/uuid"
+	"github.com/rynowak/workflow-recipe/pkg/providers"
+)
+
+func CallCreateRedisUser(ctx *daprworkflow.WorkflowContext, input CreateRedisUserInput) (CreateRedisUserOutput, error) {
+	task := ctx.CallActivity(CreateRedisUser, daprworkflow.ActivityInput(input))
+
+	output := CreateRedisUserOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return CreateRedisUserOutput{}, err
+	}
+
+	return output, nil
+}
+
+type CreateRedisUserInput struct {
+	// Username is the name of the ACL user to create. Defaults to redisuser.
+	Username string `json:"username,omitempty"`
+	// Server is the DeploymentID of the Redis server.
+	Server string `json:"server"`
+}
+
+type CreateRedisUserOutput struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// CreateRedisUser creates an ACL user on a deployed Redis server, or resets the password of the user if it exists.
+// The user can use every key and channel, but not the commands that administer the server. The default user is
+// disabled so the server can't be used without credentials. The ACLs are saved, so they survive a restart.
+func CreateRedisUser(ctx daprworkflow.ActivityContext) (any, error) {
+	input := CreateRedisUserInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	username := input.Username
+	if username == "" {
+		username = "redisuser"
+	}
+	password := uuid.NewString()
+
+	namespace, name, ok := parseDeploymentID(input.Server)
+	if !ok {
+		return nil, fmt.Errorf("server %q is not the ID of a deployed server", input.Server)
+	}
+
+	commands := [][]string{
+		{"ACL", "SETUSER", username, "reset", "on", ">" + password, "~*", "&*", "+@all", "-@admin", "-@dangerous"},
+		{"ACL", "SETUSER", "default", "off"},
+		{"ACL", "SAVE"},
+	}
+
+	logger := slog.Default().With(slog.String("server", input.Server), slog.String("username", username))
+
+	if cluster == nil {
+		return nil, errors.New("activities have not been initialized")
+	} else if cluster.Name() == providers.Simulated {
+		// Pretend we are using a real Redis server...
+		logger.Info("Creating Redis ACL user")
+		for _, command := range commands {
+			logger.Info("Executing Redis command", slog.String("command", strings.Join(command[:min(len(command), 3)], " ")))
+		}
+
+		return CreateRedisUserOutput{Username: username, Password: password}, nil
+	}
+
+	admin, found, err := getServerAdmin(ctx.Context(), namespace, name)
+	if err != nil {
+		return nil, err
+	} else if !found || admin.Host == "" {
+		return nil, fmt.Errorf("server %q has no admin credentials: it must be deployed again", input.Server)
+	}
+
+	logger.Info("Creating Redis ACL user")
+	err = runRedisCommands(ctx.Context(), net.JoinHostPort(admin.Host, strconv.Itoa(admin.Port)), admin.Username, admin.Password, commands)
+	if err != nil {
+		return nil, err
+	}
+
+	return CreateRedisUserOutput{
+		Username: username,
+		Password: password,
+	}, nil
+}
+
+// runRedisCommands authenticates to a Redis server and runs commands, stopping at the first error. Every command
+// must reply with a simple string, like OK, which is true of AUTH and the ACL commands recipes use.
+func runRedisCommands(ctx context.Context, address string, username string, password string, commands [][]string) error {
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("error connecting to Redis at %s: %w", address, err)
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(30 * time.Second)
+	}
+	err = conn.SetDeadline(deadline)
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(conn)
+	for _, command := range append([][]string{{"AUTH", username, password}}, commands...) {
+		request := &bytes.Buffer{}
+		fmt.Fprintf(request, "*%d\r\n", len(command))
+		for _, arg := range command {
+			fmt.Fprintf(request, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+
+		_, err = conn.Write(request.Bytes())
+		if err != nil {
+			return fmt.Errorf("error sending Redis command %s: %w", command[0], err)
+		}
+
+		// The reply of an error or a simple string is a single line. The command is not included in errors, because
+		// it has passwords in it.
+		reply, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("error reading reply to Redis command %s: %w", command[0], err)
+		}
+
+		reply = strings.TrimRight(reply, "\r\n")
+		if strings.HasPrefix(reply, "-") {
+			return fmt.Errorf("redis command %s failed: %s", command[0], reply[1:])
+		} else if !strings.HasPrefix(reply, "+") {
+			return fmt.Errorf("unexpected reply to Redis command %s: %q", command[0], reply)
+		}
+	}
+
+	return nil
+}
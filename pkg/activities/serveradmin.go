@@ -0,0 +1,74 @@
+package activities
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	deploymentIDPrefix = "/planes/kubernetes/local/namespaces/"
+	deploymentIDType   = "/providers/apps/Deployment/"
+)
+
+// ServerAdmin is the admin account of a server deployed by DeployKubernetesResources. The password is generated when
+// the server is first deployed, and kept so the server is deployed again with the same password, and so activities
+// can manage it.
+type ServerAdmin struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Host and Port are where the server can be reached. Empty until the server is ready.
+	Host string `json:"host,omitempty"`
+	Port int    `json:"port,omitempty"`
+}
+
+func serverAdminKey(namespace string, name string) string {
+	return "server-admins||" + namespace + "||" + name
+}
+
+// DeploymentID returns the ID of the Deployment of a server deployed by DeployKubernetesResources. Activities that
+// accept a server use it to manage the deployed server.
+func DeploymentID(namespace string, name string) string {
+	return deploymentIDPrefix + namespace + deploymentIDType + name
+}
+
+// parseDeploymentID returns the namespace and name in an ID returned by DeploymentID. Returns false if id is not a
+// Deployment ID, like the name of a server in the pool.
+func parseDeploymentID(id string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(id, deploymentIDPrefix)
+	if !ok {
+		return "", "", false
+	}
+
+	namespace, name, ok := strings.Cut(rest, deploymentIDType)
+	if !ok || namespace == "" || name == "" {
+		return "", "", false
+	}
+
+	return namespace, name, true
+}
+
+// getServerAdmin returns the admin account of a deployed server. Returns false if the server was not deployed with
+// one.
+func getServerAdmin(ctx context.Context, namespace string, name string) (ServerAdmin, bool, error) {
+	admin := ServerAdmin{}
+	_, ok, err := getState(ctx, serverAdminKey(namespace, name), &admin)
+	if err != nil {
+		return ServerAdmin{}, false, err
+	}
+
+	return admin, ok, nil
+}
+
+// postgresURL returns the connection URL of the admin account for a database.
+func (a ServerAdmin) postgresURL(database string) string {
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(a.Username, a.Password),
+		Host:   net.JoinHostPort(a.Host, strconv.Itoa(a.Port)),
+		Path:   "/" + database,
+	}
+	return u.String()
+}
@@ -0,0 +1,437 @@
+package activities
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/rynowak/workflow-recipe/pkg/backup"
+	"github.com/rynowak/workflow-recipe/pkg/providers"
+)
+
+const (
+	// maxPlacementRetries is the number of times a placement is retried when there are concurrent placements on the
+	// same server.
+	maxPlacementRetries = 5
+)
+
+// PostgresPlacementPolicy decides which server in the pool a new database is placed on. Servers that are at capacity
+// are never chosen.
+type PostgresPlacementPolicy string
+
+const (
+	// PostgresPlacementLeastLoaded chooses the server with the fewest databases.
+	PostgresPlacementLeastLoaded PostgresPlacementPolicy = "leastLoaded"
+	// PostgresPlacementLabelAffinity chooses the least loaded of the servers that have every affinity label. Placement
+	// fails if no server has them.
+	PostgresPlacementLabelAffinity PostgresPlacementPolicy = "labelAffinity"
+	// PostgresPlacementSpread chooses the server with the fewest databases of the same application, so an outage of
+	// one server affects as few of an application's databases as possible. Ties go to the least loaded.
+	PostgresPlacementSpread PostgresPlacementPolicy = "spread"
+)
+
+// IsValid returns true if the policy is a known placement policy.
+func (p PostgresPlacementPolicy) IsValid() bool {
+	switch p {
+	case PostgresPlacementLeastLoaded, PostgresPlacementLabelAffinity, PostgresPlacementSpread:
+		return true
+	default:
+		return false
+	}
+}
+
+// PoolServerLoad is the current load of a server in the pool.
+type PoolServerLoad struct {
+	Server     string          `json:"server"`
+	Placements []PoolPlacement `json:"placements"`
+}
+
+// PoolPlacement is a database that was placed on a server in the pool.
+type PoolPlacement struct {
+	ResourceID    string `json:"resourceId"`
+	EnvironmentID string `json:"environmentId,omitempty"`
+	ApplicationID string `json:"applicationId,omitempty"`
+}
+
+func poolServerLoadKey(server string) string {
+	return "server-pool||" + server
+}
+
+// ServerRef identifies the PostgreSQL server an activity runs against: the name of a server in the pool, or the
+// DeploymentID of a deployed server. Empty for the default server.
+type ServerRef string
+
+// databaseServerFor returns the DatabaseServer that manages a server in the pool or a deployed server, or the default
+// server if name is empty.
+func databaseServerFor(ctx context.Context, name ServerRef) (providers.DatabaseServer, error) {
+	url, deployed, err := deployedServerURL(ctx, name)
+	if err != nil {
+		return nil, err
+	} else if deployed && url == "" {
+		return databaseServer, nil
+	} else if deployed {
+		return providers.NewDatabaseServerForURL(url), nil
+	}
+
+	if name == "" {
+		if databaseServer == nil {
+			return nil, errors.New("activities have not been initialized")
+		}
+		return databaseServer, nil
+	}
+
+	if serverPool == nil {
+		return nil, errors.New("activities have not been initialized")
+	}
+
+	server, ok := serverPool.DatabaseServer(string(name))
+	if !ok {
+		return nil, fmt.Errorf("server %q is not in the server pool", name)
+	}
+	return server, nil
+}
+
+// dumperFor returns the Dumper for a server in the pool or a deployed server, or the default Dumper if name is empty.
+func dumperFor(ctx context.Context, name ServerRef) (backup.Dumper, error) {
+	url, deployed, err := deployedServerURL(ctx, name)
+	if err != nil {
+		return nil, err
+	} else if deployed && url == "" {
+		return dumper, nil
+	} else if deployed {
+		return backup.NewDumperForURL(url), nil
+	}
+
+	if name == "" {
+		if dumper == nil {
+			return nil, errors.New("activities have not been initialized")
+		}
+		return dumper, nil
+	}
+
+	server, err := poolServer(string(name))
+	if err != nil {
+		return nil, err
+	}
+	return backup.NewDumperForURL(server.AdminURL), nil
+}
+
+// restorerFor returns the Restorer for a server in the pool or a deployed server, or the default Restorer if name is
+// empty.
+func restorerFor(ctx context.Context, name ServerRef) (backup.Restorer, error) {
+	url, deployed, err := deployedServerURL(ctx, name)
+	if err != nil {
+		return nil, err
+	} else if deployed && url == "" {
+		return restorer, nil
+	} else if deployed {
+		return backup.NewRestorerForURL(url), nil
+	}
+
+	if name == "" {
+		if restorer == nil {
+			return nil, errors.New("activities have not been initialized")
+		}
+		return restorer, nil
+	}
+
+	server, err := poolServer(string(name))
+	if err != nil {
+		return nil, err
+	}
+	return backup.NewRestorerForURL(server.AdminURL), nil
+}
+
+// deployedServerURL returns the admin URL of a server deployed by DeployKubernetesResources, and true if name is a
+// Deployment ID. The URL is empty when the default server is simulated, because the servers it deploys are too.
+func deployedServerURL(ctx context.Context, name ServerRef) (string, bool, error) {
+	namespace, deploymentName, ok := parseDeploymentID(string(name))
+	if !ok {
+		return "", false, nil
+	}
+
+	if databaseServer == nil {
+		return "", true, errors.New("activities have not been initialized")
+	} else if databaseServer.Name() == providers.Simulated {
+		return "", true, nil
+	}
+
+	admin, found, err := getServerAdmin(ctx, namespace, deploymentName)
+	if err != nil {
+		return "", true, err
+	} else if !found || admin.Host == "" {
+		return "", true, fmt.Errorf("server %q has no admin credentials: it must be deployed again", name)
+	}
+
+	return admin.postgresURL("postgres"), true, nil
+}
+
+func poolServer(name string) (providers.PoolServer, error) {
+	if serverPool == nil {
+		return providers.PoolServer{}, errors.New("activities have not been initialized")
+	}
+
+	server, ok := serverPool.Get(name)
+	if !ok {
+		return providers.PoolServer{}, fmt.Errorf("server %q is not in the server pool", name)
+	}
+	return server, nil
+}
+
+func CallPlacePostgresDatabase(ctx *daprworkflow.WorkflowContext, input PlacePostgresDatabaseInput) (PlacePostgresDatabaseOutput, error) {
+	task := ctx.CallActivity(PlacePostgresDatabase, daprworkflow.ActivityInput(input))
+
+	output := PlacePostgresDatabaseOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return PlacePostgresDatabaseOutput{}, err
+	}
+
+	return output, nil
+}
+
+type PlacePostgresDatabaseInput struct {
+	ResourceID    string                  `json:"resourceId"`
+	EnvironmentID string                  `json:"environmentId,omitempty"`
+	ApplicationID string                  `json:"applicationId,omitempty"`
+	Policy        PostgresPlacementPolicy `json:"policy"`
+	// Labels are the affinity labels of PostgresPlacementLabelAffinity.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type PlacePostgresDatabaseOutput struct {
+	Server string `json:"server"`
+	Host   string `json:"host"`
+	Port   int    `json:"port"`
+}
+
+// PlacePostgresDatabase chooses a server in the pool for the database of a resource, and adds it to the load of the
+// server. A resource that was already placed keeps its server.
+func PlacePostgresDatabase(ctx daprworkflow.ActivityContext) (any, error) {
+	input := PlacePostgresDatabaseInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	if !input.Policy.IsValid() {
+		return nil, fmt.Errorf("unsupported placement policy %q", input.Policy)
+	} else if serverPool == nil {
+		return nil, errors.New("activities have not been initialized")
+	} else if len(serverPool.Servers) == 0 {
+		return nil, errors.New("the server pool is empty")
+	}
+
+	logger := slog.Default().With(slog.String("resource.id", input.ResourceID), slog.String("policy", string(input.Policy)))
+
+	for range maxPlacementRetries {
+		loads := map[string]PoolServerLoad{}
+		etags := map[string]string{}
+		for _, server := range serverPool.Servers {
+			load := PoolServerLoad{Server: server.Name, Placements: []PoolPlacement{}}
+			etags[server.Name], _, err = getState(ctx.Context(), poolServerLoadKey(server.Name), &load)
+			if err != nil {
+				return nil, err
+			}
+			loads[server.Name] = load
+		}
+
+		server, placed, err := choosePoolServer(serverPool.Servers, loads, input)
+		if err != nil {
+			return nil, err
+		} else if placed {
+			logger.Info("Database was already placed", slog.String("server", server.Name))
+			return PlacePostgresDatabaseOutput{Server: server.Name, Host: server.Host, Port: server.Port}, nil
+		}
+
+		load := loads[server.Name]
+		load.Placements = append(load.Placements, PoolPlacement{
+			ResourceID:    input.ResourceID,
+			EnvironmentID: input.EnvironmentID,
+			ApplicationID: input.ApplicationID,
+		})
+
+		// Another placement on the same server fails the write, and the choice is made again with its load.
+		err = saveState(ctx.Context(), poolServerLoadKey(server.Name), load, etags[server.Name], true, nil)
+		if err != nil {
+			logger.Info("Retrying placement", slog.String("server", server.Name), slog.Any("error", err))
+			continue
+		}
+
+		logger.Info("Placed database", slog.String("server", server.Name), slog.Int("load", len(load.Placements)), slog.Int("capacity", server.Capacity))
+		return PlacePostgresDatabaseOutput{Server: server.Name, Host: server.Host, Port: server.Port}, nil
+	}
+
+	return nil, fmt.Errorf("could not place the database of resource %q after %d attempts: the server pool is busy", input.ResourceID, maxPlacementRetries)
+}
+
+// choosePoolServer chooses a server by the policy. Returns true if the resource was already placed on the server.
+func choosePoolServer(servers []providers.PoolServer, loads map[string]PoolServerLoad, input PlacePostgresDatabaseInput) (providers.PoolServer, bool, error) {
+	for _, server := range servers {
+		if slices.ContainsFunc(loads[server.Name].Placements, func(p PoolPlacement) bool { return p.ResourceID == input.ResourceID }) {
+			return server, true, nil
+		}
+	}
+
+	candidates := slices.Clone(servers)
+	if input.Policy == PostgresPlacementLabelAffinity {
+		candidates = slices.DeleteFunc(candidates, func(server providers.PoolServer) bool {
+			for key, value := range input.Labels {
+				if actual, ok := server.Labels[key]; !ok || actual != value {
+					return true
+				}
+			}
+			return false
+		})
+		if len(candidates) == 0 {
+			return providers.PoolServer{}, false, fmt.Errorf("no server in the pool has the labels %v", input.Labels)
+		}
+	}
+
+	candidates = slices.DeleteFunc(candidates, func(server providers.PoolServer) bool {
+		return server.Capacity > 0 && len(loads[server.Name].Placements) >= server.Capacity
+	})
+	if len(candidates) == 0 && input.Policy == PostgresPlacementLabelAffinity {
+		return providers.PoolServer{}, false, fmt.Errorf("every server in the pool with the labels %v is at capacity", input.Labels)
+	} else if len(candidates) == 0 {
+		return providers.PoolServer{}, false, errors.New("every server in the pool is at capacity")
+	}
+
+	sameApplication := func(server providers.PoolServer) int {
+		count := 0
+		for _, placement := range loads[server.Name].Placements {
+			if placement.ApplicationID != "" && placement.ApplicationID == input.ApplicationID {
+				count++
+			}
+		}
+		return count
+	}
+
+	slices.SortStableFunc(candidates, func(a, b providers.PoolServer) int {
+		if input.Policy == PostgresPlacementSpread {
+			if c := cmp.Compare(sameApplication(a), sameApplication(b)); c != 0 {
+				return c
+			}
+		}
+
+		if c := cmp.Compare(len(loads[a.Name].Placements), len(loads[b.Name].Placements)); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	return candidates[0], false, nil
+}
+
+func CallGetPostgresDatabasePlacement(ctx *daprworkflow.WorkflowContext, input GetPostgresDatabasePlacementInput) (GetPostgresDatabasePlacementOutput, error) {
+	task := ctx.CallActivity(GetPostgresDatabasePlacement, daprworkflow.ActivityInput(input))
+
+	output := GetPostgresDatabasePlacementOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return GetPostgresDatabasePlacementOutput{}, err
+	}
+
+	return output, nil
+}
+
+type GetPostgresDatabasePlacementInput struct {
+	ResourceID string `json:"resourceId"`
+}
+
+type GetPostgresDatabasePlacementOutput struct {
+	Found  bool   `json:"found"`
+	Server string `json:"server,omitempty"`
+}
+
+// GetPostgresDatabasePlacement returns the server in the pool the database of a resource was placed on, from the
+// load of each server.
+func GetPostgresDatabasePlacement(ctx daprworkflow.ActivityContext) (any, error) {
+	input := GetPostgresDatabasePlacementInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	if serverPool == nil {
+		return nil, errors.New("activities have not been initialized")
+	}
+
+	for _, server := range serverPool.Servers {
+		load := PoolServerLoad{}
+		_, _, err = getState(ctx.Context(), poolServerLoadKey(server.Name), &load)
+		if err != nil {
+			return nil, err
+		}
+
+		if slices.ContainsFunc(load.Placements, func(p PoolPlacement) bool { return p.ResourceID == input.ResourceID }) {
+			return GetPostgresDatabasePlacementOutput{Found: true, Server: server.Name}, nil
+		}
+	}
+
+	return GetPostgresDatabasePlacementOutput{Found: false}, nil
+}
+
+func CallReleasePostgresDatabasePlacement(ctx *daprworkflow.WorkflowContext, input ReleasePostgresDatabasePlacementInput) (ReleasePostgresDatabasePlacementOutput, error) {
+	task := ctx.CallActivity(ReleasePostgresDatabasePlacement, daprworkflow.ActivityInput(input))
+
+	output := ReleasePostgresDatabasePlacementOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return ReleasePostgresDatabasePlacementOutput{}, err
+	}
+
+	return output, nil
+}
+
+type ReleasePostgresDatabasePlacementInput struct {
+	Server     string `json:"server"`
+	ResourceID string `json:"resourceId"`
+}
+
+type ReleasePostgresDatabasePlacementOutput struct {
+	// Found is false if the resource was not placed on the server.
+	Found bool `json:"found"`
+}
+
+// ReleasePostgresDatabasePlacement removes the database of a resource from the load of its server.
+func ReleasePostgresDatabasePlacement(ctx daprworkflow.ActivityContext) (any, error) {
+	input := ReleasePostgresDatabasePlacementInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default().With(slog.String("resource.id", input.ResourceID), slog.String("server", input.Server))
+
+	key := poolServerLoadKey(input.Server)
+	for range maxPlacementRetries {
+		load := PoolServerLoad{}
+		etag, ok, err := getState(ctx.Context(), key, &load)
+		if err != nil {
+			return nil, err
+		}
+
+		before := len(load.Placements)
+		load.Placements = slices.DeleteFunc(load.Placements, func(p PoolPlacement) bool { return p.ResourceID == input.ResourceID })
+		if !ok || len(load.Placements) == before {
+			logger.Warn("Database was not placed on the server")
+			return ReleasePostgresDatabasePlacementOutput{Found: false}, nil
+		}
+
+		err = saveState(ctx.Context(), key, load, etag, false, nil)
+		if err != nil {
+			logger.Info("Retrying placement release", slog.Any("error", err))
+			continue
+		}
+
+		logger.Info("Released database placement", slog.Int("load", len(load.Placements)))
+		return ReleasePostgresDatabasePlacementOutput{Found: true}, nil
+	}
+
+	return nil, fmt.Errorf("could not release the placement of resource %q on server %q after %d attempts", input.ResourceID, input.Server, maxPlacementRetries)
+}
@@ -0,0 +1,110 @@
+package activities
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rynowak/workflow-recipe/pkg/providers"
+)
+
+func TestChoosePoolServer_LabelAffinity(t *testing.T) {
+	servers := []providers.PoolServer{
+		{Name: "dev-east", Labels: map[string]string{"environment": "dev", "region": "east"}},
+		{Name: "dev-west", Labels: map[string]string{"environment": "dev", "region": "west"}, Capacity: 1},
+		{Name: "prod-west", Labels: map[string]string{"environment": "prod", "region": "west"}},
+		{Name: "unlabeled"},
+	}
+	placements := func(count int) PoolServerLoad {
+		return PoolServerLoad{Placements: make([]PoolPlacement, count)}
+	}
+
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		loads   map[string]PoolServerLoad
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "every label matches",
+			labels: map[string]string{"environment": "dev", "region": "west"},
+			want:   "dev-west",
+		},
+		{
+			name:   "least loaded of the matches",
+			labels: map[string]string{"environment": "dev"},
+			loads:  map[string]PoolServerLoad{"dev-east": placements(2)},
+			want:   "dev-west",
+		},
+		{
+			name:   "no labels matches every server",
+			labels: nil,
+			loads:  map[string]PoolServerLoad{"dev-east": placements(1), "dev-west": placements(1), "prod-west": placements(1)},
+			want:   "unlabeled",
+		},
+		{
+			// A partial match is not a match, even if it is the best one.
+			name:    "no server has every label",
+			labels:  map[string]string{"environment": "prod", "region": "east"},
+			wantErr: "no server in the pool has the labels",
+		},
+		{
+			name:    "a missing label doesn't match an empty value",
+			labels:  map[string]string{"tier": ""},
+			wantErr: "no server in the pool has the labels",
+		},
+		{
+			name:    "matches are at capacity",
+			labels:  map[string]string{"region": "west", "environment": "dev"},
+			loads:   map[string]PoolServerLoad{"dev-west": placements(1)},
+			wantErr: "is at capacity",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loads := tt.loads
+			if loads == nil {
+				loads = map[string]PoolServerLoad{}
+			}
+
+			server, placed, err := choosePoolServer(servers, loads, PlacePostgresDatabaseInput{
+				ResourceID: "/resources/orders",
+				Policy:     PostgresPlacementLabelAffinity,
+				Labels:     tt.labels,
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if placed || server.Name != tt.want {
+				t.Errorf("got server %q (placed %v), want %q", server.Name, placed, tt.want)
+			}
+		})
+	}
+}
+
+func TestChoosePoolServer_AlreadyPlaced(t *testing.T) {
+	servers := []providers.PoolServer{
+		{Name: "dev", Labels: map[string]string{"environment": "dev"}},
+		{Name: "prod", Labels: map[string]string{"environment": "prod"}},
+	}
+	loads := map[string]PoolServerLoad{"prod": {Placements: []PoolPlacement{{ResourceID: "/resources/orders"}}}}
+
+	// A resource keeps its server even if the labels changed.
+	server, placed, err := choosePoolServer(servers, loads, PlacePostgresDatabaseInput{
+		ResourceID: "/resources/orders",
+		Policy:     PostgresPlacementLabelAffinity,
+		Labels:     map[string]string{"environment": "dev"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if !placed || server.Name != "prod" {
+		t.Errorf("got server %q (placed %v), want prod", server.Name, placed)
+	}
+}
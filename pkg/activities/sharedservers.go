@@ -0,0 +1,161 @@
+package activities
+
+import (
+	"log/slog"
+	"slices"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+)
+
+// SharedServer is a server that is shared by the resources of an environment. It is deleted when the last resource
+// that references it is deleted.
+type SharedServer struct {
+	Namespace string   `json:"namespace"`
+	Name      string   `json:"name"`
+	Host      string   `json:"host"`
+	Port      int      `json:"port"`
+	Resources []string `json:"resources"`
+	// References are the IDs of the resources that use the server.
+	References []string `json:"references"`
+}
+
+func sharedServerKey(namespace string, name string) string {
+	return "shared-servers||" + namespace + "||" + name
+}
+
+func CallAddSharedServerReference(ctx *daprworkflow.WorkflowContext, input AddSharedServerReferenceInput) (AddSharedServerReferenceOutput, error) {
+	task := ctx.CallActivity(AddSharedServerReference, daprworkflow.ActivityInput(input))
+
+	output := AddSharedServerReferenceOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return AddSharedServerReferenceOutput{}, err
+	}
+
+	return output, nil
+}
+
+type AddSharedServerReferenceInput struct {
+	// Server is the server that was deployed. Its references are ignored.
+	Server     SharedServer `json:"server"`
+	ResourceID string       `json:"resourceId"`
+}
+
+type AddSharedServerReferenceOutput struct {
+	Server SharedServer `json:"server"`
+}
+
+// AddSharedServerReference records that a resource uses a shared server. Adding a reference that exists is not an
+// error. Callers hold the lock for the server, so references aren't added while the server is being deleted.
+func AddSharedServerReference(ctx daprworkflow.ActivityContext) (any, error) {
+	input := AddSharedServerReferenceInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	key := sharedServerKey(input.Server.Namespace, input.Server.Name)
+	server := SharedServer{}
+	etag, ok, err := getState(ctx.Context(), key, &server)
+	if err != nil {
+		return nil, err
+	}
+
+	references := []string{}
+	if ok {
+		references = server.References
+	}
+
+	// The deployment is updated on every reference, in case the server was redeployed somewhere else.
+	server = input.Server
+	server.References = references
+	if !slices.Contains(server.References, input.ResourceID) {
+		server.References = append(server.References, input.ResourceID)
+	}
+
+	err = saveState(ctx.Context(), key, server, etag, !ok, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default()
+	logger.Info("Added shared server reference",
+		slog.String("namespace", server.Namespace),
+		slog.String("server", server.Name),
+		slog.String("resource.id", input.ResourceID),
+		slog.Int("references", len(server.References)))
+
+	return AddSharedServerReferenceOutput{
+		Server: server,
+	}, nil
+}
+
+func CallRemoveSharedServerReference(ctx *daprworkflow.WorkflowContext, input RemoveSharedServerReferenceInput) (RemoveSharedServerReferenceOutput, error) {
+	task := ctx.CallActivity(RemoveSharedServerReference, daprworkflow.ActivityInput(input))
+
+	output := RemoveSharedServerReferenceOutput{}
+	err := task.Await(&output)
+	if err != nil {
+		return RemoveSharedServerReferenceOutput{}, err
+	}
+
+	return output, nil
+}
+
+type RemoveSharedServerReferenceInput struct {
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+	ResourceID string `json:"resourceId"`
+}
+
+type RemoveSharedServerReferenceOutput struct {
+	// Found is false if the server has no record. It might have been created before references were recorded.
+	Found  bool         `json:"found"`
+	Server SharedServer `json:"server"`
+	// Unused is true if no resources reference the server any more, and it should be deleted.
+	Unused bool `json:"unused"`
+}
+
+// RemoveSharedServerReference records that a resource no longer uses a shared server. The record of the server is
+// deleted with the last reference. Removing a reference that doesn't exist is not an error.
+func RemoveSharedServerReference(ctx daprworkflow.ActivityContext) (any, error) {
+	input := RemoveSharedServerReferenceInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default().With(slog.String("namespace", input.Namespace), slog.String("server", input.Name), slog.String("resource.id", input.ResourceID))
+
+	key := sharedServerKey(input.Namespace, input.Name)
+	server := SharedServer{}
+	etag, ok, err := getState(ctx.Context(), key, &server)
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		logger.Warn("Shared server has no record")
+		return RemoveSharedServerReferenceOutput{Found: false}, nil
+	}
+
+	server.References = slices.DeleteFunc(server.References, func(id string) bool {
+		return id == input.ResourceID
+	})
+
+	if len(server.References) > 0 {
+		err = saveState(ctx.Context(), key, server, etag, false, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		logger.Info("Removed shared server reference", slog.Int("references", len(server.References)))
+		return RemoveSharedServerReferenceOutput{Found: true, Server: server}, nil
+	}
+
+	err = deleteState(ctx.Context(), key, etag)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Removed last shared server reference")
+	return RemoveSharedServerReferenceOutput{Found: true, Server: server, Unused: true}, nil
+}
@@ -0,0 +1,82 @@
+package activities
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	daprclient "github.com/dapr/go-sdk/client"
+)
+
+// getState reads a JSON value from the state store. Returns false if the key does not exist.
+func getState(ctx context.Context, key string, v any) (string, bool, error) {
+	if dapr == nil {
+		return "", false, errors.New("activities have not been initialized")
+	}
+
+	item, err := dapr.GetState(ctx, stateStore, key, nil)
+	if err != nil {
+		return "", false, fmt.Errorf("error reading %q from state store: %w", key, err)
+	}
+
+	if len(item.Value) == 0 {
+		return "", false, nil
+	}
+
+	err = json.Unmarshal(item.Value, v)
+	if err != nil {
+		return "", false, fmt.Errorf("error reading %q from state store: %w", key, err)
+	}
+
+	return item.Etag, true, nil
+}
+
+// saveState writes a JSON value to the state store. If etag is set the write only succeeds if the value has not
+// changed since it was read. If etag is empty the write only succeeds if firstWrite is false or the key does not exist.
+func saveState(ctx context.Context, key string, v any, etag string, firstWrite bool, metadata map[string]string) error {
+	if dapr == nil {
+		return errors.New("activities have not been initialized")
+	}
+
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	opts := []daprclient.StateOption{daprclient.WithConsistency(daprclient.StateConsistencyStrong)}
+	if etag != "" || firstWrite {
+		opts = append(opts, daprclient.WithConcurrency(daprclient.StateConcurrencyFirstWrite))
+	} else {
+		opts = append(opts, daprclient.WithConcurrency(daprclient.StateConcurrencyLastWrite))
+	}
+
+	err = dapr.SaveStateWithETag(ctx, stateStore, key, bs, etag, metadata, opts...)
+	if err != nil {
+		return fmt.Errorf("error writing %q to state store: %w", key, err)
+	}
+
+	return nil
+}
+
+// deleteState deletes a value from the state store. If etag is set the delete only succeeds if the value has not
+// changed since it was read.
+func deleteState(ctx context.Context, key string, etag string) error {
+	if dapr == nil {
+		return errors.New("activities have not been initialized")
+	}
+
+	var tag *daprclient.ETag
+	opts := &daprclient.StateOptions{Consistency: daprclient.StateConsistencyStrong, Concurrency: daprclient.StateConcurrencyLastWrite}
+	if etag != "" {
+		tag = &daprclient.ETag{Value: etag}
+		opts.Concurrency = daprclient.StateConcurrencyFirstWrite
+	}
+
+	err := dapr.DeleteStateWithETag(ctx, stateStore, key, tag, nil, opts)
+	if err != nil {
+		return fmt.Errorf("error deleting %q from state store: %w", key, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,207 @@
+package backup
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AzureBlobStorage stores backups as block blobs in an Azure Blob Storage container, or a stand-in like Azurite.
+// Requests are authorized with a shared access signature on the container URL.
+type AzureBlobStorage struct {
+	// ContainerURL is the URL of the container including a SAS token with read, write, list, and delete
+	// permissions.
+	// Ex. http://127.0.0.1:10000/devstoreaccount1/backups?sv=...&sig=...
+	ContainerURL string
+	// Client is the HTTP client used to make requests. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+func (s *AzureBlobStorage) Name() string {
+	return "azureblob"
+}
+
+func (s *AzureBlobStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (string, error) {
+	blob, err := s.blobURL(key)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPut, blob.String(), r)
+	if err != nil {
+		return "", err
+	}
+
+	// Single-shot uploads are limited to 5000 MiB, which is plenty for the databases we manage.
+	request.ContentLength = size
+	request.Header.Set("Content-Type", contentType)
+	request.Header.Set("X-Ms-Blob-Type", "BlockBlob")
+	request.Header.Set("X-Ms-Version", "2021-08-06")
+
+	response, err := s.client().Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return "", fmt.Errorf("unexpected status %s from blob storage: %s", response.Status, body)
+	}
+
+	// Don't leak the SAS token in the location.
+	blob.RawQuery = ""
+	return blob.String(), nil
+}
+
+func (s *AzureBlobStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	blob, err := s.blobURL(key)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, blob.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("X-Ms-Version", "2021-08-06")
+
+	response, err := s.client().Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusNotFound {
+		response.Body.Close()
+		return nil, ErrNotFound
+	} else if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return nil, fmt.Errorf("unexpected status %s from blob storage: %s", response.Status, body)
+	}
+
+	return response.Body, nil
+}
+
+func (s *AzureBlobStorage) List(ctx context.Context, prefix string) ([]string, error) {
+	container, err := url.Parse(s.ContainerURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid container URL: %w", err)
+	}
+
+	keys := []string{}
+	marker := ""
+	for {
+		// Keep the SAS token and add the list parameters.
+		query := container.Query()
+		query.Set("restype", "container")
+		query.Set("comp", "list")
+		query.Set("prefix", prefix)
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+
+		list := *container
+		list.RawQuery = query.Encode()
+
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, list.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		request.Header.Set("X-Ms-Version", "2021-08-06")
+
+		result := struct {
+			Blobs []struct {
+				Name string `xml:"Name"`
+			} `xml:"Blobs>Blob"`
+			NextMarker string `xml:"NextMarker"`
+		}{}
+		err = s.do(request, &result)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, blob := range result.Blobs {
+			keys = append(keys, blob.Name)
+		}
+
+		if result.NextMarker == "" {
+			return keys, nil
+		}
+		marker = result.NextMarker
+	}
+}
+
+func (s *AzureBlobStorage) Delete(ctx context.Context, key string) error {
+	blob, err := s.blobURL(key)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodDelete, blob.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("X-Ms-Version", "2021-08-06")
+
+	response, err := s.client().Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusAccepted && response.StatusCode != http.StatusNotFound {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return fmt.Errorf("unexpected status %s from blob storage: %s", response.Status, body)
+	}
+
+	return nil
+}
+
+// do sends a request and decodes the XML response body into v.
+func (s *AzureBlobStorage) do(request *http.Request, v any) error {
+	response, err := s.client().Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return fmt.Errorf("unexpected status %s from blob storage: %s", response.Status, body)
+	}
+
+	err = xml.NewDecoder(response.Body).Decode(v)
+	if err != nil {
+		return fmt.Errorf("error reading response from blob storage: %w", err)
+	}
+
+	return nil
+}
+
+func (s *AzureBlobStorage) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+
+	return http.DefaultClient
+}
+
+func (s *AzureBlobStorage) blobURL(key string) (*url.URL, error) {
+	container, err := url.Parse(s.ContainerURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid container URL: %w", err)
+	}
+
+	blob := *container
+	blob.Path = strings.TrimSuffix(container.Path, "/") + "/" + key
+	blob.RawPath = ""
+	return &blob, nil
+}
@@ -0,0 +1,243 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeAzureBlob is an in-memory blob container that requires the SAS token on every request. Listing returns one blob
+// per page so markers are exercised.
+type fakeAzureBlob struct {
+	t *testing.T
+
+	mu    sync.Mutex
+	blobs map[string][]byte
+	// status overrides the response to every request when it is set.
+	status int
+}
+
+func newFakeAzureBlob(t *testing.T) (*AzureBlobStorage, *fakeAzureBlob) {
+	t.Helper()
+
+	fake := &fakeAzureBlob{t: t, blobs: map[string][]byte{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	return &AzureBlobStorage{ContainerURL: server.URL + "/account/backups?sv=2021-08-06&sig=token", Client: server.Client()}, fake
+}
+
+func (f *fakeAzureBlob) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	query := r.URL.Query()
+	if query.Get("sig") != "token" {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte("<Error><Code>AuthenticationFailed</Code></Error>"))
+		return
+	} else if f.status != 0 {
+		w.WriteHeader(f.status)
+		_, _ = w.Write([]byte("<Error><Code>InternalError</Code></Error>"))
+		return
+	}
+
+	if r.Header.Get("X-Ms-Version") == "" {
+		f.t.Errorf("request %s %s has no X-Ms-Version", r.Method, r.URL.Path)
+	}
+
+	name, ok := strings.CutPrefix(r.URL.Path, "/account/backups")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	name = strings.TrimPrefix(name, "/")
+
+	switch {
+	case r.Method == http.MethodPut && name != "":
+		if r.Header.Get("X-Ms-Blob-Type") != "BlockBlob" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		f.blobs[name] = body
+		w.WriteHeader(http.StatusCreated)
+
+	case r.Method == http.MethodGet && name == "" && query.Get("restype") == "container" && query.Get("comp") == "list":
+		f.list(w, query)
+
+	case r.Method == http.MethodGet && name != "":
+		blob, ok := f.blobs[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("<Error><Code>BlobNotFound</Code></Error>"))
+			return
+		}
+		_, _ = w.Write(blob)
+
+	case r.Method == http.MethodDelete && name != "":
+		if _, ok := f.blobs[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.blobs, name)
+		w.WriteHeader(http.StatusAccepted)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeAzureBlob) list(w http.ResponseWriter, query url.Values) {
+	names := []string{}
+	for name := range f.blobs {
+		if strings.HasPrefix(name, query.Get("prefix")) && name > query.Get("marker") {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	type blob struct {
+		Name string `xml:"Name"`
+	}
+	result := struct {
+		XMLName    xml.Name `xml:"EnumerationResults"`
+		Blobs      []blob   `xml:"Blobs>Blob"`
+		NextMarker string   `xml:"NextMarker"`
+	}{}
+	if len(names) > 0 {
+		result.Blobs = []blob{{Name: names[0]}}
+	}
+	if len(names) > 1 {
+		result.NextMarker = names[0]
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(result)
+}
+
+func TestAzureBlobStorage(t *testing.T) {
+	ctx := context.Background()
+	storage, fake := newFakeAzureBlob(t)
+
+	data := []byte("pg_dump output")
+	for _, key := range []string{"orders/db/1.dump", "orders/db/2.dump", "inventory/db/1.dump"} {
+		location, err := storage.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "application/octet-stream")
+		if err != nil {
+			t.Fatalf("unexpected error from Put: %v", err)
+		}
+
+		// The SAS token is not part of the location.
+		if strings.Contains(location, "sig=") || !strings.HasSuffix(location, "/account/backups/"+key) {
+			t.Errorf("got location %q", location)
+		}
+	}
+
+	if !bytes.Equal(fake.blobs["orders/db/1.dump"], data) {
+		t.Errorf("got blobs %v", fake.blobs)
+	}
+
+	reader, err := storage.Get(ctx, "orders/db/1.dump")
+	if err != nil {
+		t.Fatalf("unexpected error from Get: %v", err)
+	}
+	got, _ := io.ReadAll(reader)
+	reader.Close()
+	if !bytes.Equal(got, data) {
+		t.Errorf("got %q from Get, want %q", got, data)
+	}
+
+	keys, err := storage.List(ctx, "orders/")
+	if err != nil {
+		t.Fatalf("unexpected error from List: %v", err)
+	}
+	want := []string{"orders/db/1.dump", "orders/db/2.dump"}
+	if !slices.Equal(keys, want) {
+		t.Errorf("got keys %v, want %v", keys, want)
+	}
+
+	err = storage.Delete(ctx, "orders/db/1.dump")
+	if err != nil {
+		t.Fatalf("unexpected error from Delete: %v", err)
+	}
+
+	_, err = storage.Get(ctx, "orders/db/1.dump")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v from Get after Delete, want ErrNotFound", err)
+	}
+
+	// Deleting a blob that doesn't exist is not an error.
+	err = storage.Delete(ctx, "orders/db/1.dump")
+	if err != nil {
+		t.Errorf("unexpected error deleting a missing blob: %v", err)
+	}
+}
+
+func TestAzureBlobStorage_Errors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("error status", func(t *testing.T) {
+		storage, fake := newFakeAzureBlob(t)
+		fake.status = http.StatusInternalServerError
+
+		_, err := storage.Put(ctx, "key", strings.NewReader("data"), 4, "text/plain")
+		if err == nil || !strings.Contains(err.Error(), "500") || !strings.Contains(err.Error(), "InternalError") {
+			t.Errorf("got error %v from Put, want the status and the response body", err)
+		}
+
+		_, err = storage.Get(ctx, "key")
+		if err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("got error %v from Get, want an error that isn't ErrNotFound", err)
+		}
+
+		_, err = storage.List(ctx, "")
+		if err == nil {
+			t.Error("expected an error from List")
+		}
+
+		err = storage.Delete(ctx, "key")
+		if err == nil {
+			t.Error("expected an error from Delete")
+		}
+	})
+
+	t.Run("missing SAS token", func(t *testing.T) {
+		storage, _ := newFakeAzureBlob(t)
+		storage.ContainerURL, _, _ = strings.Cut(storage.ContainerURL, "?")
+
+		_, err := storage.Put(ctx, "key", strings.NewReader("data"), 4, "text/plain")
+		if err == nil || !strings.Contains(err.Error(), "403") {
+			t.Errorf("got error %v, want a 403", err)
+		}
+	})
+
+	t.Run("invalid response", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("not xml"))
+		}))
+		t.Cleanup(server.Close)
+
+		storage := &AzureBlobStorage{ContainerURL: server.URL + "/account/backups"}
+		_, err := storage.List(ctx, "")
+		if err == nil || !strings.Contains(err.Error(), "error reading response") {
+			t.Errorf("got error %v, want an error reading the response", err)
+		}
+	})
+
+	t.Run("invalid container URL", func(t *testing.T) {
+		storage := &AzureBlobStorage{ContainerURL: "http://[::1"}
+		_, err := storage.Get(ctx, "key")
+		if err == nil || !strings.Contains(err.Error(), "invalid container URL") {
+			t.Errorf("got error %v, want an invalid container URL error", err)
+		}
+	})
+}
@@ -0,0 +1,173 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when a backup does not exist.
+	ErrNotFound = errors.New("backup not found")
+)
+
+const (
+	// FormatCustom is pg_dump's custom archive format, which is restored with pg_restore.
+	FormatCustom = "custom"
+	// FormatSQL is a plain SQL script, like the dumps produced by mysqldump.
+	FormatSQL = "sql"
+	// FormatMongoArchive is mongodump's archive format, which is restored with mongorestore.
+	FormatMongoArchive = "mongoArchive"
+	// FormatSimulated is the format of placeholder dumps produced for demos.
+	FormatSimulated = "simulated"
+
+	// ReasonDelete is the reason recorded for a backup taken before a database is deleted.
+	ReasonDelete = "delete"
+	// ReasonScheduled is the reason recorded for a backup taken by a backup schedule.
+	ReasonScheduled = "scheduled"
+)
+
+// Metadata describes a backup. It is stored alongside the backup and returned to callers so the backup can be found
+// and verified later.
+type Metadata struct {
+	// ID is the key of the backup in its storage backend.
+	ID string `json:"id"`
+	// Location is the URL of the backup in its storage backend.
+	Location string `json:"location"`
+	// Storage is the name of the storage backend. Ex. filesystem, s3, azureblob
+	Storage string `json:"storage"`
+	// ResourceID is the ID of the resource whose data was backed up.
+	ResourceID string `json:"resourceId"`
+	// Database is the name of the database that was backed up.
+	Database string `json:"database"`
+	// Format is the format of the dump.
+	Format string `json:"format"`
+	// Size is the size of the backup in bytes.
+	Size int64 `json:"size"`
+	// Checksum is the SHA-256 checksum of the backup, in the form sha256:<hex>.
+	Checksum string `json:"checksum"`
+	// Reason is why the backup was taken. Only scheduled backups are pruned by retention policies.
+	Reason string `json:"reason,omitempty"`
+	// CreatedAt is the time the backup was taken.
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Storage is a backend where backups are stored.
+type Storage interface {
+	// Name returns the name of the storage backend.
+	Name() string
+	// Put stores size bytes read from r under key, and returns the location of the stored object.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (string, error)
+	// Get opens the object stored under key. Returns ErrNotFound if there is no such object.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// List returns the keys of every object whose key starts with prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+	// Delete removes the object stored under key. Deleting an object that does not exist is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Request describes a backup to take.
+type Request struct {
+	ResourceID string
+	Database   string
+	Reason     string
+}
+
+// Create dumps a database and writes the dump and its metadata to storage. The dump is spooled to a temporary file
+// so its size and checksum are known before it is uploaded.
+func Create(ctx context.Context, storage Storage, dumper Dumper, request Request) (*Metadata, error) {
+	file, err := os.CreateTemp("", "backup-*.dump")
+	if err != nil {
+		return nil, fmt.Errorf("error creating temporary file for backup: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	hash := sha256.New()
+	err = dumper.Dump(ctx, request.Database, io.MultiWriter(file, hash))
+	if err != nil {
+		return nil, fmt.Errorf("error dumping database %q: %w", request.Database, err)
+	}
+
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	createdAt := time.Now().UTC()
+	key := Key(request.ResourceID, request.Database, createdAt)
+	location, err := storage.Put(ctx, key, file, size, "application/octet-stream")
+	if err != nil {
+		return nil, fmt.Errorf("error uploading backup: %w", err)
+	}
+
+	metadata := Metadata{
+		ID:         key,
+		Location:   location,
+		Storage:    storage.Name(),
+		ResourceID: request.ResourceID,
+		Database:   request.Database,
+		Format:     dumper.Format(),
+		Size:       size,
+		Checksum:   "sha256:" + hex.EncodeToString(hash.Sum(nil)),
+		Reason:     request.Reason,
+		CreatedAt:  createdAt,
+	}
+
+	bs, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = storage.Put(ctx, MetadataKey(key), strings.NewReader(string(bs)), int64(len(bs)), "application/json")
+	if err != nil {
+		return nil, fmt.Errorf("error uploading backup metadata: %w", err)
+	}
+
+	return &metadata, nil
+}
+
+// ResourcePrefix returns the prefix of the storage keys of every backup of a resource. Different resource IDs can
+// sanitize to the same prefix, so callers must check the ResourceID in the metadata.
+func ResourcePrefix(resourceID string) string {
+	return sanitize(resourceID) + "/"
+}
+
+// Key returns the storage key for a backup. Backups of the same database sort by the time they were taken.
+func Key(resourceID string, database string, createdAt time.Time) string {
+	return fmt.Sprintf("%s%s/%s.dump", ResourcePrefix(resourceID), sanitize(database), createdAt.UTC().Format("20060102T150405.000000000Z"))
+}
+
+// MetadataKey returns the storage key for the metadata of the backup stored under key.
+func MetadataKey(key string) string {
+	return key + ".json"
+}
+
+// sanitize makes a value safe to use as a single segment of a storage key.
+func sanitize(value string) string {
+	value = strings.Trim(value, "/")
+	if value == "" {
+		return "_"
+	}
+
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, value)
+}
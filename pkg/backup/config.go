@@ -0,0 +1,93 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rynowak/workflow-recipe/pkg/providers"
+)
+
+// NewStorageFromEnv creates the storage backend selected by the BACKUP_STORAGE environment variable:
+//
+//   - filesystem (default): BACKUP_FILESYSTEM_ROOT, defaults to a directory in the system temp directory.
+//   - s3: BACKUP_S3_ENDPOINT, BACKUP_S3_REGION, BACKUP_S3_BUCKET, BACKUP_S3_ACCESS_KEY_ID, BACKUP_S3_SECRET_ACCESS_KEY.
+//   - azureblob: BACKUP_AZURE_CONTAINER_URL, including a SAS token.
+func NewStorageFromEnv() (Storage, error) {
+	switch kind := os.Getenv("BACKUP_STORAGE"); kind {
+	case "", "filesystem":
+		root := os.Getenv("BACKUP_FILESYSTEM_ROOT")
+		if root == "" {
+			root = filepath.Join(os.TempDir(), "workflow-recipe-backups")
+		}
+		return &FilesystemStorage{Root: root}, nil
+
+	case "s3":
+		storage := &S3Storage{
+			Endpoint:        os.Getenv("BACKUP_S3_ENDPOINT"),
+			Region:          os.Getenv("BACKUP_S3_REGION"),
+			Bucket:          os.Getenv("BACKUP_S3_BUCKET"),
+			AccessKeyID:     os.Getenv("BACKUP_S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("BACKUP_S3_SECRET_ACCESS_KEY"),
+		}
+		if storage.Endpoint == "" || storage.Bucket == "" {
+			return nil, fmt.Errorf("BACKUP_S3_ENDPOINT and BACKUP_S3_BUCKET are required for s3 backup storage")
+		}
+		return storage, nil
+
+	case "azureblob":
+		storage := &AzureBlobStorage{
+			ContainerURL: os.Getenv("BACKUP_AZURE_CONTAINER_URL"),
+		}
+		if storage.ContainerURL == "" {
+			return nil, fmt.Errorf("BACKUP_AZURE_CONTAINER_URL is required for azureblob backup storage")
+		}
+		return storage, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported backup storage %q", kind)
+	}
+}
+
+// NewDumperFromEnv creates a Dumper that uses pg_dump to dump databases on the server at POSTGRES_ADMIN_URL if the
+// DATABASE_SERVER_PROVIDER environment variable selects the postgres provider, and produces simulated dumps otherwise.
+// PG_DUMP_PATH overrides the location of pg_dump.
+func NewDumperFromEnv() Dumper {
+	if os.Getenv("DATABASE_SERVER_PROVIDER") != providers.Postgres {
+		return &SimulatedDumper{}
+	}
+
+	return &PgDumper{URL: os.Getenv("POSTGRES_ADMIN_URL"), Path: os.Getenv("PG_DUMP_PATH")}
+}
+
+// NewDumperForURL creates a Dumper that uses pg_dump to dump databases from the server at url, or produces simulated
+// dumps if url is empty. PG_DUMP_PATH overrides the location of pg_dump.
+func NewDumperForURL(url string) Dumper {
+	if url == "" {
+		return &SimulatedDumper{}
+	}
+
+	return &PgDumper{URL: url, Path: os.Getenv("PG_DUMP_PATH")}
+}
+
+// NewMySQLDumperFromEnv creates a Dumper that uses mysqldump if the MYSQL_ADMIN_URL environment variable is set, and
+// produces simulated dumps otherwise. MYSQLDUMP_PATH overrides the location of mysqldump.
+func NewMySQLDumperFromEnv() Dumper {
+	url := os.Getenv("MYSQL_ADMIN_URL")
+	if url == "" {
+		return &SimulatedDumper{}
+	}
+
+	return &MySQLDumper{URL: url, Path: os.Getenv("MYSQLDUMP_PATH")}
+}
+
+// NewMongoDumperFromEnv creates a Dumper that uses mongodump if the MONGODB_ADMIN_URL environment variable is set, and
+// produces simulated dumps otherwise. MONGODUMP_PATH overrides the location of mongodump.
+func NewMongoDumperFromEnv() Dumper {
+	url := os.Getenv("MONGODB_ADMIN_URL")
+	if url == "" {
+		return &SimulatedDumper{}
+	}
+
+	return &MongoDumper{URL: url, Path: os.Getenv("MONGODUMP_PATH")}
+}
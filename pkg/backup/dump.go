@@ -0,0 +1,80 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"time"
+
+	"github.com/rynowak/workflow-recipe/pkg/providers"
+)
+
+// Dumper produces a logical dump of a database.
+type Dumper interface {
+	// Format returns the format of the dumps this Dumper produces.
+	Format() string
+	// Dump writes a dump of the database to w.
+	Dump(ctx context.Context, database string, w io.Writer) error
+}
+
+// PgDumper dumps databases with pg_dump.
+type PgDumper struct {
+	// URL is the connection URL of the server, with credentials that can read every database. The path of the URL
+	// is replaced with the database being dumped.
+	URL string
+	// Path is the path of the pg_dump binary. Defaults to pg_dump on the PATH.
+	Path string
+}
+
+func (d *PgDumper) Format() string {
+	return FormatCustom
+}
+
+func (d *PgDumper) Dump(ctx context.Context, database string, w io.Writer) error {
+	if d.URL == "" {
+		return errors.New("POSTGRES_ADMIN_URL is required to dump databases on the default server")
+	}
+
+	connection, env, err := providers.PostgresCommandEnv(d.URL, database)
+	if err != nil {
+		return err
+	}
+
+	path := d.Path
+	if path == "" {
+		path = "pg_dump"
+	}
+
+	stderr := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, path, "--format=custom", "--no-owner", "--dbname", connection)
+	cmd.Stdout = w
+	cmd.Stderr = stderr
+	cmd.Env = env
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("pg_dump failed: %w: %s", err, stderr.String())
+	}
+
+	return nil
+}
+
+// SimulatedDumper produces placeholder dumps for demos, where there is no real database to dump.
+type SimulatedDumper struct {
+}
+
+func (d *SimulatedDumper) Format() string {
+	return FormatSimulated
+}
+
+func (d *SimulatedDumper) Dump(ctx context.Context, database string, w io.Writer) error {
+	// Pretend we are dumping a database...
+	logger := slog.Default()
+	logger.Info("Dumping database", slog.String("database", database))
+
+	_, err := fmt.Fprintf(w, "-- Simulated dump of database %q taken at %s\n", database, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
@@ -0,0 +1,162 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+
+	"github.com/rynowak/workflow-recipe/pkg/providers"
+)
+
+// Restorer loads a logical dump into a database.
+type Restorer interface {
+	// Restore loads the dump read from r into the database. The database must already exist, and should be empty.
+	// The restored objects are owned by owner, or by the user the Restorer connects as if owner is empty.
+	Restore(ctx context.Context, database string, owner string, r io.Reader) error
+}
+
+// PgRestorer restores dumps in the custom format with pg_restore.
+type PgRestorer struct {
+	// URL is the connection URL of the server, with credentials that can write every database. The path of the URL
+	// is replaced with the database being restored.
+	URL string
+	// Path is the path of the pg_restore binary. Defaults to pg_restore on the PATH.
+	Path string
+}
+
+func (r *PgRestorer) Restore(ctx context.Context, database string, owner string, reader io.Reader) error {
+	if r.URL == "" {
+		return errors.New("POSTGRES_ADMIN_URL is required to restore databases on the default server")
+	}
+
+	connection, env, err := providers.PostgresCommandEnv(r.URL, database)
+	if err != nil {
+		return err
+	}
+
+	path := r.Path
+	if path == "" {
+		path = "pg_restore"
+	}
+
+	// The owners and grants in the dump name users of the database that was backed up, which may not exist anymore.
+	// Objects are created as the owner instead, and the caller grants access to the restored tables.
+	args := []string{"--no-owner", "--no-privileges", "--exit-on-error", "--single-transaction", "--dbname", connection}
+	if owner != "" {
+		args = append(args, "--role", owner)
+	}
+
+	stderr := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdin = reader
+	cmd.Stderr = stderr
+	cmd.Env = env
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("pg_restore failed: %w: %s", err, stderr.String())
+	}
+
+	return nil
+}
+
+// SimulatedRestorer restores simulated dumps for demos, where there is no real database to restore.
+type SimulatedRestorer struct {
+}
+
+func (r *SimulatedRestorer) Restore(ctx context.Context, database string, owner string, reader io.Reader) error {
+	// Pretend we are restoring a database...
+	logger := slog.Default()
+	logger.Info("Restoring database", slog.String("database", database), slog.String("owner", owner))
+
+	_, err := io.Copy(io.Discard, reader)
+	return err
+}
+
+// NewRestorerFromEnv creates a Restorer that uses pg_restore to restore databases on the server at POSTGRES_ADMIN_URL
+// if the DATABASE_SERVER_PROVIDER environment variable selects the postgres provider, and restores simulated dumps
+// otherwise. PG_RESTORE_PATH overrides the location of pg_restore.
+func NewRestorerFromEnv() Restorer {
+	if os.Getenv("DATABASE_SERVER_PROVIDER") != providers.Postgres {
+		return &SimulatedRestorer{}
+	}
+
+	return &PgRestorer{URL: os.Getenv("POSTGRES_ADMIN_URL"), Path: os.Getenv("PG_RESTORE_PATH")}
+}
+
+// NewRestorerForURL creates a Restorer that uses pg_restore to restore databases on the server at url, or restores
+// simulated dumps if url is empty. PG_RESTORE_PATH overrides the location of pg_restore.
+func NewRestorerForURL(url string) Restorer {
+	if url == "" {
+		return &SimulatedRestorer{}
+	}
+
+	return &PgRestorer{URL: url, Path: os.Getenv("PG_RESTORE_PATH")}
+}
+
+// ReadMetadata reads the metadata of the backup with the given ID. Returns ErrNotFound if there is no such backup.
+func ReadMetadata(ctx context.Context, storage Storage, id string) (*Metadata, error) {
+	reader, err := storage.Get(ctx, MetadataKey(id))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	metadata := Metadata{}
+	err = json.NewDecoder(reader).Decode(&metadata)
+	if err != nil {
+		return nil, fmt.Errorf("error reading backup metadata: %w", err)
+	}
+
+	return &metadata, nil
+}
+
+// Restore downloads a backup, verifies its size and checksum against its metadata, and loads it into the database.
+// Simulated backups are always restored with SimulatedRestorer.
+func Restore(ctx context.Context, storage Storage, restorer Restorer, metadata Metadata, database string, owner string) error {
+	reader, err := storage.Get(ctx, metadata.ID)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	file, err := os.CreateTemp("", "restore-*.dump")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file for restore: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), reader)
+	if err != nil {
+		return fmt.Errorf("error downloading backup: %w", err)
+	}
+
+	if size != metadata.Size {
+		return fmt.Errorf("backup %q is corrupt: expected %d bytes but downloaded %d", metadata.ID, metadata.Size, size)
+	}
+
+	checksum := "sha256:" + hex.EncodeToString(hash.Sum(nil))
+	if checksum != metadata.Checksum {
+		return fmt.Errorf("backup %q is corrupt: expected checksum %s but computed %s", metadata.ID, metadata.Checksum, checksum)
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	if metadata.Format == FormatSimulated {
+		restorer = &SimulatedRestorer{}
+	}
+
+	return restorer.Restore(ctx, database, owner, file)
+}
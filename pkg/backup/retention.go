@@ -0,0 +1,110 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Retention is a policy for how long scheduled backups are kept. A backup is pruned if it is not one of the newest
+// Count backups, or if it is older than Days. The newest backup is always kept.
+type Retention struct {
+	// Count is the number of backups to keep. Zero means no limit.
+	Count int `json:"count,omitempty"`
+	// Days is the number of days to keep backups for. Zero means no limit.
+	Days int `json:"days,omitempty"`
+}
+
+// IsZero returns true if the policy does not limit retention.
+func (r Retention) IsZero() bool {
+	return r.Count <= 0 && r.Days <= 0
+}
+
+// Validate returns an error if the policy is invalid.
+func (r Retention) Validate() error {
+	if r.Count < 0 || r.Days < 0 {
+		return errors.New("retention count and days must not be negative")
+	}
+
+	return nil
+}
+
+// ListBackups returns the backups of a resource, newest first.
+func ListBackups(ctx context.Context, storage Storage, resourceID string) ([]Metadata, error) {
+	keys, err := storage.List(ctx, ResourcePrefix(resourceID))
+	if err != nil {
+		return nil, fmt.Errorf("error listing backups: %w", err)
+	}
+
+	backups := []Metadata{}
+	for _, key := range keys {
+		if !strings.HasSuffix(key, ".json") {
+			continue
+		}
+
+		metadata, err := ReadMetadata(ctx, storage, strings.TrimSuffix(key, ".json"))
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if metadata.ResourceID == resourceID {
+			backups = append(backups, *metadata)
+		}
+	}
+
+	slices.SortFunc(backups, func(a, b Metadata) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+
+	return backups, nil
+}
+
+// Prune deletes the scheduled backups of a resource that are outside the retention policy, and returns the backups
+// that were deleted. Backups taken for any other reason, like before a delete, are never pruned.
+func Prune(ctx context.Context, storage Storage, resourceID string, retention Retention, now time.Time) ([]Metadata, error) {
+	if retention.IsZero() {
+		return []Metadata{}, nil
+	}
+
+	backups, err := ListBackups(ctx, storage, resourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	scheduled := slices.DeleteFunc(backups, func(metadata Metadata) bool {
+		return metadata.Reason != ReasonScheduled
+	})
+
+	cutoff := now.AddDate(0, 0, -retention.Days)
+	pruned := []Metadata{}
+	for i, metadata := range scheduled {
+		if i == 0 {
+			continue
+		}
+
+		expired := (retention.Count > 0 && i >= retention.Count) || (retention.Days > 0 && metadata.CreatedAt.Before(cutoff))
+		if !expired {
+			continue
+		}
+
+		// Delete the metadata last, so a partially deleted backup is found and deleted again next time.
+		err = storage.Delete(ctx, metadata.ID)
+		if err != nil {
+			return pruned, fmt.Errorf("error deleting backup %q: %w", metadata.ID, err)
+		}
+
+		err = storage.Delete(ctx, MetadataKey(metadata.ID))
+		if err != nil {
+			return pruned, fmt.Errorf("error deleting backup metadata %q: %w", metadata.ID, err)
+		}
+
+		pruned = append(pruned, metadata)
+	}
+
+	return pruned, nil
+}
@@ -0,0 +1,158 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testResourceID = "/planes/radius/local/resourceGroups/default/providers/Applications.Datastores/sqlDatabases/orders"
+
+// putBackup stores a backup and its metadata, taken age before now.
+func putBackup(t *testing.T, storage Storage, now time.Time, age time.Duration, reason string) Metadata {
+	t.Helper()
+
+	ctx := context.Background()
+	createdAt := now.Add(-age)
+	key := Key(testResourceID, "orders", createdAt)
+
+	_, err := storage.Put(ctx, key, strings.NewReader("dump"), 4, "application/octet-stream")
+	if err != nil {
+		t.Fatalf("error storing backup: %v", err)
+	}
+
+	metadata := Metadata{ID: key, ResourceID: testResourceID, Database: "orders", Reason: reason, CreatedAt: createdAt}
+	bs, err := json.Marshal(metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = storage.Put(ctx, MetadataKey(key), strings.NewReader(string(bs)), int64(len(bs)), "application/json")
+	if err != nil {
+		t.Fatalf("error storing backup metadata: %v", err)
+	}
+
+	return metadata
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name      string
+		retention Retention
+		// backups are the ages of the backups, newest first.
+		backups []time.Duration
+		// reasons are the reasons the backups were taken. Defaults to scheduled.
+		reasons []string
+		// want are the indexes of the backups that are kept.
+		want []int
+	}{
+		{
+			name:      "no limit",
+			retention: Retention{},
+			backups:   []time.Duration{0, day, 2 * day},
+			want:      []int{0, 1, 2},
+		},
+		{
+			name:      "count",
+			retention: Retention{Count: 2},
+			backups:   []time.Duration{0, day, 2 * day, 3 * day},
+			want:      []int{0, 1},
+		},
+		{
+			name:      "days",
+			retention: Retention{Days: 2},
+			backups:   []time.Duration{0, day, 3 * day, 4 * day},
+			want:      []int{0, 1},
+		},
+		{
+			name:      "count and days",
+			retention: Retention{Count: 3, Days: 2},
+			backups:   []time.Duration{0, day, 3 * day, 4 * day},
+			want:      []int{0, 1},
+		},
+		{
+			name:      "newest is kept when every backup is expired",
+			retention: Retention{Days: 1},
+			backups:   []time.Duration{10 * day, 11 * day, 12 * day},
+			want:      []int{0},
+		},
+		{
+			name:      "newest is kept when count is one",
+			retention: Retention{Count: 1},
+			backups:   []time.Duration{5 * day, 6 * day},
+			want:      []int{0},
+		},
+		{
+			name:      "only scheduled backups are pruned",
+			retention: Retention{Count: 1},
+			backups:   []time.Duration{0, day, 2 * day, 3 * day},
+			reasons:   []string{ReasonDelete, ReasonScheduled, ReasonDelete, ReasonScheduled},
+			want:      []int{0, 1, 2},
+		},
+		{
+			// A newer backup taken before a delete doesn't count as the newest scheduled backup.
+			name:      "newest scheduled is kept when a newer backup is expired",
+			retention: Retention{Days: 1},
+			backups:   []time.Duration{10 * day, 11 * day, 12 * day},
+			reasons:   []string{ReasonDelete, ReasonScheduled, ReasonScheduled},
+			want:      []int{0, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := &FilesystemStorage{Root: t.TempDir()}
+
+			backups := []Metadata{}
+			for i, age := range tt.backups {
+				reason := ReasonScheduled
+				if tt.reasons != nil {
+					reason = tt.reasons[i]
+				}
+				backups = append(backups, putBackup(t, storage, now, age, reason))
+			}
+
+			pruned, err := Prune(ctx, storage, testResourceID, tt.retention, now)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			remaining, err := ListBackups(ctx, storage, testResourceID)
+			if err != nil {
+				t.Fatalf("unexpected error listing backups: %v", err)
+			}
+
+			want := []string{}
+			for _, i := range tt.want {
+				want = append(want, backups[i].ID)
+			}
+			got := []string{}
+			for _, metadata := range remaining {
+				got = append(got, metadata.ID)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("got remaining backups %v, want %v", got, want)
+			}
+
+			if len(pruned)+len(remaining) != len(backups) {
+				t.Errorf("got %d pruned and %d remaining backups, want %d in total", len(pruned), len(remaining), len(backups))
+			}
+
+			// The dump is deleted along with the metadata.
+			for _, metadata := range pruned {
+				_, err := storage.Get(ctx, metadata.ID)
+				if !errors.Is(err, ErrNotFound) {
+					t.Errorf("got error %v reading pruned backup %q, want ErrNotFound", err, metadata.ID)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package backup
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Storage stores backups in an S3-compatible object store, like AWS S3 or MinIO. Requests are made with
+// path-style addressing and signed with AWS Signature Version 4.
+type S3Storage struct {
+	// Endpoint is the base URL of the object store. Ex. http://localhost:9000
+	Endpoint string
+	// Region is the region of the bucket. Defaults to us-east-1.
+	Region string
+	// Bucket is the bucket backups are stored in.
+	Bucket string
+	// AccessKeyID is the access key used to sign requests.
+	AccessKeyID string
+	// SecretAccessKey is the secret key used to sign requests.
+	SecretAccessKey string
+	// Client is the HTTP client used to make requests. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+func (s *S3Storage) Name() string {
+	return "s3"
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (string, error) {
+	// The payload hash has to be signed, so the body has to be read twice. Backups are spooled to disk so seeking is
+	// cheap, and small bodies are buffered.
+	var hash string
+	if seeker, ok := r.(io.ReadSeeker); ok {
+		h := sha256.New()
+		_, err := io.Copy(h, seeker)
+		if err != nil {
+			return "", err
+		}
+		_, err = seeker.Seek(0, io.SeekStart)
+		if err != nil {
+			return "", err
+		}
+		hash = hex.EncodeToString(h.Sum(nil))
+	} else {
+		hash = "UNSIGNED-PAYLOAD"
+	}
+
+	request, err := s.newRequest(ctx, http.MethodPut, key, r, hash)
+	if err != nil {
+		return "", err
+	}
+
+	request.ContentLength = size
+	request.Header.Set("Content-Type", contentType)
+	s.sign(request, hash, time.Now().UTC())
+
+	response, err := s.client().Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return "", fmt.Errorf("unexpected status %s from object store: %s", response.Status, body)
+	}
+
+	return fmt.Sprintf("s3://%s/%s", s.Bucket, key), nil
+}
+
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	hash := sha256.Sum256(nil)
+	request, err := s.newRequest(ctx, http.MethodGet, key, nil, hex.EncodeToString(hash[:]))
+	if err != nil {
+		return nil, err
+	}
+
+	s.sign(request, hex.EncodeToString(hash[:]), time.Now().UTC())
+
+	response, err := s.client().Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusNotFound {
+		response.Body.Close()
+		return nil, ErrNotFound
+	} else if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return nil, fmt.Errorf("unexpected status %s from object store: %s", response.Status, body)
+	}
+
+	return response.Body, nil
+}
+
+func (s *S3Storage) List(ctx context.Context, prefix string) ([]string, error) {
+	hash := sha256.Sum256(nil)
+	keys := []string{}
+	token := ""
+	for {
+		request, err := s.newRequest(ctx, http.MethodGet, "", nil, hex.EncodeToString(hash[:]))
+		if err != nil {
+			return nil, err
+		}
+
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		request.URL.RawQuery = query.Encode()
+		s.sign(request, hex.EncodeToString(hash[:]), time.Now().UTC())
+
+		result := struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}{}
+		err = s.do(request, &result)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	hash := sha256.Sum256(nil)
+	request, err := s.newRequest(ctx, http.MethodDelete, key, nil, hex.EncodeToString(hash[:]))
+	if err != nil {
+		return err
+	}
+
+	s.sign(request, hex.EncodeToString(hash[:]), time.Now().UTC())
+
+	response, err := s.client().Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	// S3 returns 204 whether or not the object existed, other stores may return 404.
+	if response.StatusCode/100 != 2 && response.StatusCode != http.StatusNotFound {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return fmt.Errorf("unexpected status %s from object store: %s", response.Status, body)
+	}
+
+	return nil
+}
+
+// do sends a request and decodes the XML response body into v.
+func (s *S3Storage) do(request *http.Request, v any) error {
+	response, err := s.client().Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return fmt.Errorf("unexpected status %s from object store: %s", response.Status, body)
+	}
+
+	err = xml.NewDecoder(response.Body).Decode(v)
+	if err != nil {
+		return fmt.Errorf("error reading response from object store: %w", err)
+	}
+
+	return nil
+}
+
+func (s *S3Storage) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+
+	return http.DefaultClient
+}
+
+func (s *S3Storage) region() string {
+	if s.Region != "" {
+		return s.Region
+	}
+
+	return "us-east-1"
+}
+
+func (s *S3Storage) newRequest(ctx context.Context, method string, key string, body io.Reader, hash string) (*http.Request, error) {
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+
+	// An empty key addresses the bucket itself.
+	segments := []string{strings.TrimSuffix(endpoint.Path, "/"), s3Escape(s.Bucket)}
+	if key != "" {
+		for _, segment := range strings.Split(key, "/") {
+			segments = append(segments, s3Escape(segment))
+		}
+	}
+	endpoint.RawPath = strings.Join(segments, "/")
+	endpoint.Path, err = url.PathUnescape(endpoint.RawPath)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, endpoint.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("X-Amz-Content-Sha256", hash)
+	return request, nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to the request. Every header already set on the request
+// is signed.
+func (s *S3Storage) sign(request *http.Request, hash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	request.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	canonicalHeaders := &strings.Builder{}
+	for _, name := range names {
+		fmt.Fprintf(canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, s.region())
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretAccessKey), date)
+	key = hmacSHA256(key, s.region())
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape escapes a path segment the way S3 expects: everything except unreserved characters is percent-encoded.
+func s3Escape(segment string) string {
+	builder := &strings.Builder{}
+	for _, b := range []byte(segment) {
+		switch {
+		case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z', b >= '0' && b <= '9', b == '-', b == '_', b == '.', b == '~':
+			builder.WriteByte(b)
+		default:
+			fmt.Fprintf(builder, "%%%02X", b)
+		}
+	}
+	return builder.String()
+}
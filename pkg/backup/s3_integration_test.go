@@ -0,0 +1,118 @@
+//go:build integration
+
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestS3Storage_MinIO runs against a real MinIO server. Run it with:
+//
+//	docker run -d -p 9000:9000 minio/minio server /data
+//	BACKUP_S3_ENDPOINT=http://localhost:9000 go test -tags integration ./pkg/backup
+//
+// BACKUP_S3_ACCESS_KEY_ID and BACKUP_S3_SECRET_ACCESS_KEY default to MinIO's default credentials, and
+// BACKUP_S3_BUCKET defaults to a bucket that is created by the test.
+func TestS3Storage_MinIO(t *testing.T) {
+	endpoint := os.Getenv("BACKUP_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("BACKUP_S3_ENDPOINT is not set")
+	}
+
+	storage := &S3Storage{
+		Endpoint:        endpoint,
+		Region:          os.Getenv("BACKUP_S3_REGION"),
+		Bucket:          envOrDefault("BACKUP_S3_BUCKET", "workflow-recipe-test"),
+		AccessKeyID:     envOrDefault("BACKUP_S3_ACCESS_KEY_ID", "minioadmin"),
+		SecretAccessKey: envOrDefault("BACKUP_S3_SECRET_ACCESS_KEY", "minioadmin"),
+	}
+
+	ctx := context.Background()
+	createBucket(t, ctx, storage)
+
+	prefix := "integration/" + time.Now().UTC().Format("20060102150405") + "/"
+	data := []byte("pg_dump output")
+	keys := []string{prefix + "db/1.dump", prefix + "db/2 with space.dump"}
+	for _, key := range keys {
+		_, err := storage.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "application/octet-stream")
+		if err != nil {
+			t.Fatalf("unexpected error from Put: %v", err)
+		}
+	}
+	t.Cleanup(func() {
+		for _, key := range keys {
+			_ = storage.Delete(context.Background(), key)
+		}
+	})
+
+	reader, err := storage.Get(ctx, keys[1])
+	if err != nil {
+		t.Fatalf("unexpected error from Get: %v", err)
+	}
+	got, _ := io.ReadAll(reader)
+	reader.Close()
+	if !bytes.Equal(got, data) {
+		t.Errorf("got %q from Get, want %q", got, data)
+	}
+
+	listed, err := storage.List(ctx, prefix)
+	if err != nil {
+		t.Fatalf("unexpected error from List: %v", err)
+	}
+	slices.Sort(listed)
+	if !slices.Equal(listed, keys) {
+		t.Errorf("got keys %v, want %v", listed, keys)
+	}
+
+	err = storage.Delete(ctx, keys[0])
+	if err != nil {
+		t.Fatalf("unexpected error from Delete: %v", err)
+	}
+
+	_, err = storage.Get(ctx, keys[0])
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v from Get after Delete, want ErrNotFound", err)
+	}
+}
+
+// createBucket creates the bucket of the storage if it doesn't exist.
+func createBucket(t *testing.T, ctx context.Context, storage *S3Storage) {
+	t.Helper()
+
+	hash := sha256.Sum256(nil)
+	request, err := storage.newRequest(ctx, http.MethodPut, "", nil, hex.EncodeToString(hash[:]))
+	if err != nil {
+		t.Fatalf("error creating bucket: %v", err)
+	}
+	storage.sign(request, hex.EncodeToString(hash[:]), time.Now().UTC())
+
+	response, err := storage.client().Do(request)
+	if err != nil {
+		t.Fatalf("error creating bucket: %v", err)
+	}
+	defer response.Body.Close()
+
+	body, _ := io.ReadAll(response.Body)
+	if response.StatusCode != http.StatusOK && !strings.Contains(string(body), "BucketAlreadyOwnedByYou") {
+		t.Fatalf("unexpected status %s creating bucket: %s", response.Status, body)
+	}
+}
+
+func envOrDefault(name string, value string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+
+	return value
+}
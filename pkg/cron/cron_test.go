@@ -0,0 +1,178 @@
+package cron
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{expression: "", want: "expected 5 fields but got 0"},
+		{expression: "* * * *", want: "expected 5 fields but got 4"},
+		{expression: "* * * * * *", want: "expected 5 fields but got 6"},
+		{expression: "@every 5m", want: "expected 5 fields"},
+		{expression: "60 * * * *", want: `invalid value "60" in minute field`},
+		{expression: "-1 * * * *", want: "minute field"},
+		{expression: "* 24 * * *", want: `invalid value "24" in hour field`},
+		{expression: "* * 0 * *", want: `invalid value "0" in day of month field`},
+		{expression: "* * 32 * *", want: `invalid value "32" in day of month field`},
+		{expression: "* * * 0 *", want: `invalid value "0" in month field`},
+		{expression: "* * * 13 *", want: `invalid value "13" in month field`},
+		{expression: "* * * * 8", want: `invalid value "8" in day of week field`},
+		{expression: "* * * JAN *", want: `invalid value "JAN" in month field`},
+		{expression: "5-1 * * * *", want: `invalid range "5-1" in minute field`},
+		{expression: "0-60 * * * *", want: `invalid range "0-60" in minute field`},
+		{expression: "*/0 * * * *", want: `invalid step "0" in minute field`},
+		{expression: "*/x * * * *", want: `invalid step "x" in minute field`},
+		{expression: "1,,2 * * * *", want: `invalid value "" in minute field`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := Parse(tt.expression)
+			if err == nil {
+				t.Fatalf("expected an error")
+			} else if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %q, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchedule_Next(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		from       string
+		want       []string
+	}{
+		{
+			name:       "every minute",
+			expression: "* * * * *",
+			from:       "2024-01-01T10:00:30Z",
+			want:       []string{"2024-01-01T10:01:00Z", "2024-01-01T10:02:00Z"},
+		},
+		{
+			name:       "steps",
+			expression: "*/15 * * * *",
+			from:       "2024-01-01T10:07:00Z",
+			want:       []string{"2024-01-01T10:15:00Z", "2024-01-01T10:30:00Z", "2024-01-01T10:45:00Z", "2024-01-01T11:00:00Z"},
+		},
+		{
+			name:       "step from a start",
+			expression: "5/20 * * * *",
+			from:       "2024-01-01T10:00:00Z",
+			want:       []string{"2024-01-01T10:05:00Z", "2024-01-01T10:25:00Z", "2024-01-01T10:45:00Z", "2024-01-01T11:05:00Z"},
+		},
+		{
+			name:       "ranges and lists",
+			expression: "0 9-10,17 * * *",
+			from:       "2024-01-01T09:30:00Z",
+			want:       []string{"2024-01-01T10:00:00Z", "2024-01-01T17:00:00Z", "2024-01-02T09:00:00Z"},
+		},
+		{
+			name:       "day rollover",
+			expression: "30 2 * * *",
+			from:       "2024-01-01T02:30:00Z",
+			want:       []string{"2024-01-02T02:30:00Z"},
+		},
+		{
+			name:       "month rollover skips short months",
+			expression: "0 0 31 * *",
+			from:       "2024-01-31T00:00:00Z",
+			want:       []string{"2024-03-31T00:00:00Z", "2024-05-31T00:00:00Z", "2024-07-31T00:00:00Z", "2024-08-31T00:00:00Z"},
+		},
+		{
+			name:       "year rollover",
+			expression: "0 0 1 1 *",
+			from:       "2024-06-15T12:00:00Z",
+			want:       []string{"2025-01-01T00:00:00Z", "2026-01-01T00:00:00Z"},
+		},
+		{
+			name:       "leap day",
+			expression: "0 0 29 2 *",
+			from:       "2024-03-01T00:00:00Z",
+			want:       []string{"2028-02-29T00:00:00Z"},
+		},
+		{
+			name:       "restricted day of month only",
+			expression: "0 0 13 * *",
+			from:       "2024-09-01T00:00:00Z",
+			want:       []string{"2024-09-13T00:00:00Z", "2024-10-13T00:00:00Z"},
+		},
+		{
+			name:       "restricted day of week only",
+			expression: "0 0 * * 5",
+			from:       "2024-09-01T00:00:00Z",
+			want:       []string{"2024-09-06T00:00:00Z", "2024-09-13T00:00:00Z"},
+		},
+		{
+			// Both day fields are restricted, so either the 13th or a Friday matches.
+			name:       "day of month or day of week",
+			expression: "0 0 13 * 5",
+			from:       "2024-09-01T00:00:00Z",
+			want:       []string{"2024-09-06T00:00:00Z", "2024-09-13T00:00:00Z", "2024-09-20T00:00:00Z", "2024-09-27T00:00:00Z", "2024-10-04T00:00:00Z", "2024-10-11T00:00:00Z", "2024-10-13T00:00:00Z"},
+		},
+		{
+			name:       "sunday as 7",
+			expression: "0 0 * * 7",
+			from:       "2024-09-01T00:00:00Z",
+			want:       []string{"2024-09-08T00:00:00Z"},
+		},
+		{
+			name:       "weekdays to sunday",
+			expression: "0 0 * * 5-7",
+			from:       "2024-09-02T00:00:00Z",
+			want:       []string{"2024-09-06T00:00:00Z", "2024-09-07T00:00:00Z", "2024-09-08T00:00:00Z", "2024-09-13T00:00:00Z"},
+		},
+		{
+			name:       "descriptor",
+			expression: "@weekly",
+			from:       "2024-09-04T00:00:00Z",
+			want:       []string{"2024-09-08T00:00:00Z", "2024-09-15T00:00:00Z"},
+		},
+		{
+			name:       "time zones are converted to UTC",
+			expression: "0 12 * * *",
+			from:       "2024-01-01T10:00:00+05:00",
+			want:       []string{"2024-01-01T12:00:00Z"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := Parse(tt.expression)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			next, err := time.Parse(time.RFC3339, tt.from)
+			if err != nil {
+				t.Fatalf("invalid time %q: %v", tt.from, err)
+			}
+
+			for _, want := range tt.want {
+				next = schedule.Next(next)
+				if got := next.Format(time.RFC3339); got != want {
+					t.Fatalf("got %s, want %s", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSchedule_Next_Impossible(t *testing.T) {
+	schedule, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	next := schedule.Next(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	if !next.IsZero() {
+		t.Errorf("got %s, want the zero time", next)
+	}
+}
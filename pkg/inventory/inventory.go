@@ -0,0 +1,302 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	daprclient "github.com/dapr/go-sdk/client"
+)
+
+const (
+	keyPrefix = "inventory||"
+	indexKey  = "inventory-index"
+
+	// maxIndexRetries is the number of times an update to the index is retried when there are concurrent writers.
+	maxIndexRetries = 5
+)
+
+var (
+	// ErrNotFound is returned when a resource is not in the inventory.
+	ErrNotFound = errors.New("resource not found in inventory")
+)
+
+// Record is the inventory entry for a resource provisioned by a recipe. It is the durable record of what was created,
+// and outlives the workflow that created it.
+type Record struct {
+	// ID is the fully qualified resource ID. This is the key of the record.
+	ID string `json:"id"`
+	// Name is the name of the resource.
+	Name string `json:"name"`
+	// Type is the type of the resource. Ex. Applications.Datastores/sqlDatabases
+	Type string `json:"type"`
+	// ApplicationID is the ID of the application that owns the resource.
+	ApplicationID string `json:"applicationId,omitempty"`
+	// EnvironmentID is the ID of the environment that owns the resource.
+	EnvironmentID string `json:"environmentId,omitempty"`
+
+	// Recipe is the name of the recipe that provisioned the resource.
+	Recipe string `json:"recipe"`
+	// RecipeVersion is the version of the recipe that provisioned the resource.
+	RecipeVersion string `json:"recipeVersion"`
+	// InstanceID is the ID of the workflow instance that last updated the resource.
+	InstanceID string `json:"instanceId"`
+	// Context is the recipe context the resource was last provisioned with.
+	Context json.RawMessage `json:"context,omitempty"`
+
+	// Namespace is the Kubernetes namespace the resource was deployed to.
+	Namespace string `json:"namespace,omitempty"`
+	// Resources are the IDs of the Kubernetes resources that were created.
+	Resources []string `json:"resources,omitempty"`
+	// Host is the hostname of the server.
+	Host string `json:"host,omitempty"`
+	// Port is the port of the server.
+	Port int `json:"port,omitempty"`
+	// ServerMode is how the server was provisioned. Empty for a server dedicated to the resource.
+	ServerMode string `json:"serverMode,omitempty"`
+	// Server is the name of the server, when it is not dedicated to the resource.
+	Server string `json:"server,omitempty"`
+	// ServerNamespace is the Kubernetes namespace of the server, when it is not dedicated to the resource.
+	ServerNamespace string `json:"serverNamespace,omitempty"`
+	// Database is the name of the database that was created.
+	Database string `json:"database,omitempty"`
+	// Username is the name of the user that was created.
+	Username string `json:"username,omitempty"`
+	// Users are every database user that was created, including Username.
+	Users []User `json:"users,omitempty"`
+	// VHost is the name of the RabbitMQ vhost that was created.
+	VHost string `json:"vhost,omitempty"`
+	// Queue is the name of the queue that was created.
+	Queue string `json:"queue,omitempty"`
+	// CredentialsIssuedAt is the time the current credentials were issued. Nil for resources provisioned before this
+	// was recorded.
+	CredentialsIssuedAt *time.Time `json:"credentialsIssuedAt,omitempty"`
+	// PendingDeletion is set while a resource that was soft-deleted can still be undeleted.
+	PendingDeletion *PendingDeletion `json:"pendingDeletion,omitempty"`
+
+	// CreatedAt is the time the resource was first provisioned.
+	CreatedAt time.Time `json:"createdAt"`
+	// UpdatedAt is the time the record was last updated.
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+const (
+	// UndeleteEvent is the name of the external event that cancels the deletion of a soft-deleted resource. It is sent
+	// to the Delete workflow in PendingDeletion.InstanceID.
+	UndeleteEvent = "undelete"
+)
+
+// PendingDeletion describes a resource that was soft-deleted. Its credentials are revoked, and it is deleted at
+// DeleteAt unless it is undeleted first.
+type PendingDeletion struct {
+	// InstanceID is the ID of the Delete workflow that is waiting to delete the resource. Undelete events are sent to
+	// it.
+	InstanceID string `json:"instanceId"`
+	// RequestedAt is the time the resource was soft-deleted.
+	RequestedAt time.Time `json:"requestedAt"`
+	// DeleteAt is the time the resource will be deleted.
+	DeleteAt time.Time `json:"deleteAt"`
+}
+
+// User is a database user that was created for a resource.
+type User struct {
+	// Name is the name of the user in the recipe parameters and output.
+	Name string `json:"name"`
+	// Username is the name of the user in the database.
+	Username string `json:"username"`
+	// Role is the role profile of the user.
+	Role string `json:"role,omitempty"`
+	// Grants are the table privileges of a custom role.
+	Grants []string `json:"grants,omitempty"`
+}
+
+// Store reads and writes inventory records in a Dapr state store.
+type Store struct {
+	client daprclient.Client
+	name   string
+}
+
+// NewStore creates a Store backed by the named Dapr state store component.
+func NewStore(client daprclient.Client, name string) *Store {
+	return &Store{client: client, name: name}
+}
+
+// Get returns the record for a resource. Returns ErrNotFound if the resource is not in the inventory.
+func (s *Store) Get(ctx context.Context, id string) (*Record, error) {
+	item, err := s.client.GetState(ctx, s.name, keyPrefix+id, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error reading inventory record: %w", err)
+	}
+
+	if len(item.Value) == 0 {
+		return nil, ErrNotFound
+	}
+
+	record := Record{}
+	err = json.Unmarshal(item.Value, &record)
+	if err != nil {
+		return nil, fmt.Errorf("error reading inventory record: %w", err)
+	}
+
+	return &record, nil
+}
+
+// List returns the records for every resource in the inventory.
+func (s *Store) List(ctx context.Context) ([]Record, error) {
+	ids, _, err := s.readIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []Record{}
+	if len(ids) == 0 {
+		return records, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = keyPrefix + id
+	}
+
+	items, err := s.client.GetBulkState(ctx, s.name, keys, nil, 10)
+	if err != nil {
+		return nil, fmt.Errorf("error reading inventory records: %w", err)
+	}
+
+	for _, item := range items {
+		if item.Error != "" {
+			return nil, fmt.Errorf("error reading inventory record %q: %s", item.Key, item.Error)
+		}
+
+		// The index can briefly refer to a deleted record.
+		if len(item.Value) == 0 {
+			continue
+		}
+
+		record := Record{}
+		err = json.Unmarshal(item.Value, &record)
+		if err != nil {
+			return nil, fmt.Errorf("error reading inventory record %q: %w", item.Key, err)
+		}
+
+		records = append(records, record)
+	}
+
+	slices.SortFunc(records, func(a, b Record) int {
+		if a.ID < b.ID {
+			return -1
+		} else if a.ID > b.ID {
+			return 1
+		}
+		return 0
+	})
+
+	return records, nil
+}
+
+// Save creates or replaces the record for a resource. CreatedAt is preserved from an existing record and UpdatedAt
+// is set to the current time.
+func (s *Store) Save(ctx context.Context, record Record) (*Record, error) {
+	now := time.Now().UTC()
+
+	existing, err := s.Get(ctx, record.ID)
+	if errors.Is(err, ErrNotFound) {
+		record.CreatedAt = now
+	} else if err != nil {
+		return nil, err
+	} else {
+		record.CreatedAt = existing.CreatedAt
+	}
+	record.UpdatedAt = now
+
+	// Add to the index first, so a record is never missing from the index.
+	err = s.updateIndex(ctx, func(ids []string) []string {
+		if slices.Contains(ids, record.ID) {
+			return ids
+		}
+		return append(ids, record.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	bs, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.client.SaveState(ctx, s.name, keyPrefix+record.ID, bs, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error writing inventory record: %w", err)
+	}
+
+	return &record, nil
+}
+
+// Delete removes the record for a resource. Deleting a resource that is not in the inventory is not an error.
+func (s *Store) Delete(ctx context.Context, id string) error {
+	err := s.client.DeleteState(ctx, s.name, keyPrefix+id, nil)
+	if err != nil {
+		return fmt.Errorf("error deleting inventory record: %w", err)
+	}
+
+	return s.updateIndex(ctx, func(ids []string) []string {
+		return slices.DeleteFunc(ids, func(existing string) bool {
+			return existing == id
+		})
+	})
+}
+
+func (s *Store) readIndex(ctx context.Context) ([]string, string, error) {
+	item, err := s.client.GetState(ctx, s.name, indexKey, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading inventory index: %w", err)
+	}
+
+	ids := []string{}
+	if len(item.Value) > 0 {
+		err = json.Unmarshal(item.Value, &ids)
+		if err != nil {
+			return nil, "", fmt.Errorf("error reading inventory index: %w", err)
+		}
+	}
+
+	return ids, item.Etag, nil
+}
+
+// updateIndex applies an update to the list of resource IDs using optimistic concurrency.
+func (s *Store) updateIndex(ctx context.Context, update func(ids []string) []string) error {
+	var err error
+	for range maxIndexRetries {
+		var ids []string
+		var etag string
+		ids, etag, err = s.readIndex(ctx)
+		if err != nil {
+			return err
+		}
+
+		before := len(ids)
+		ids = update(ids)
+		if len(ids) == before && etag != "" {
+			return nil
+		}
+
+		var bs []byte
+		bs, err = json.Marshal(ids)
+		if err != nil {
+			return err
+		}
+
+		err = s.client.SaveStateWithETag(ctx, s.name, indexKey, bs, etag, nil,
+			daprclient.WithConcurrency(daprclient.StateConcurrencyFirstWrite),
+			daprclient.WithConsistency(daprclient.StateConsistencyStrong))
+		if err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("error writing inventory index: %w", err)
+}
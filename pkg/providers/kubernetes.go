@@ -0,0 +1,233 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// KubectlCluster deploys to a real Kubernetes cluster with kubectl, using the current KUBECONFIG.
+type KubectlCluster struct {
+	// Path is the path of the kubectl binary. Defaults to kubectl on the PATH.
+	Path string
+}
+
+var _ ClusterDeployer = (*KubectlCluster)(nil)
+var _ SecretWriter = (*KubectlCluster)(nil)
+
+func (c *KubectlCluster) Name() string {
+	return Kubernetes
+}
+
+func (c *KubectlCluster) Deploy(ctx context.Context, namespace string, name string, spec ServerSpec) (Deployment, error) {
+	labels := map[string]string{"app.kubernetes.io/name": name, "app.kubernetes.io/managed-by": "workflow-recipe"}
+
+	container := map[string]any{
+		"name":           name,
+		"image":          spec.Image,
+		"ports":          []any{map[string]any{"containerPort": spec.Port}},
+		"readinessProbe": map[string]any{"tcpSocket": map[string]any{"port": spec.Port}},
+		"envFrom":        []any{map[string]any{"secretRef": map[string]any{"name": adminSecretName(name)}}},
+	}
+	if len(spec.Command) > 0 {
+		container["command"] = spec.Command
+	}
+	if spec.AdminPort != 0 {
+		container["ports"] = append(container["ports"].([]any), map[string]any{"containerPort": spec.AdminPort})
+	}
+	pod := map[string]any{"containers": []any{container}}
+
+	env := spec.Env
+	if env == nil {
+		env = map[string]string{}
+	}
+
+	items := []any{
+		map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   map[string]any{"name": adminSecretName(name), "namespace": namespace, "labels": labels},
+			"type":       "Opaque",
+			"stringData": env,
+		},
+	}
+
+	// The volume can only be mounted by one pod at a time, so the old pod is stopped before the new one starts.
+	strategy := map[string]any{"type": "RollingUpdate"}
+	if spec.DataPath != "" {
+		size := spec.StorageSize
+		if size == "" {
+			size = DefaultStorageSize
+		}
+
+		items = append(items, map[string]any{
+			"apiVersion": "v1",
+			"kind":       "PersistentVolumeClaim",
+			"metadata":   map[string]any{"name": dataClaimName(name), "namespace": namespace, "labels": labels},
+			"spec": map[string]any{
+				"accessModes": []any{"ReadWriteOnce"},
+				"resources":   map[string]any{"requests": map[string]any{"storage": size}},
+			},
+		})
+
+		container["volumeMounts"] = []any{map[string]any{"name": "data", "mountPath": spec.DataPath}}
+		pod["volumes"] = []any{map[string]any{"name": "data", "persistentVolumeClaim": map[string]any{"claimName": dataClaimName(name)}}}
+		strategy = map[string]any{"type": "Recreate"}
+	}
+
+	ports := []any{map[string]any{"name": "server", "port": spec.Port, "targetPort": spec.Port}}
+	if spec.AdminPort != 0 {
+		ports = append(ports, map[string]any{"name": "admin", "port": spec.AdminPort, "targetPort": spec.AdminPort})
+	}
+
+	items = append(items,
+		map[string]any{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]any{"name": name, "namespace": namespace, "labels": labels},
+			"spec": map[string]any{
+				"replicas": 1,
+				"strategy": strategy,
+				"selector": map[string]any{"matchLabels": labels},
+				"template": map[string]any{
+					"metadata": map[string]any{"labels": labels},
+					"spec":     pod,
+				},
+			},
+		},
+		map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata":   map[string]any{"name": name, "namespace": namespace, "labels": labels},
+			"spec": map[string]any{
+				"selector": labels,
+				"ports":    ports,
+			},
+		})
+
+	err := c.apply(ctx, map[string]any{"apiVersion": "v1", "kind": "List", "items": items})
+	if err != nil {
+		return Deployment{}, err
+	}
+
+	_, err = c.run(ctx, nil, "rollout", "status", "deployment/"+name, "--namespace", namespace, "--timeout", "5m")
+	if err != nil {
+		return Deployment{}, err
+	}
+
+	return Deployment{
+		Host:      fmt.Sprintf("%s.%s.svc.cluster.local", name, namespace),
+		Port:      spec.Port,
+		Resources: deploymentResources(namespace, name, spec),
+	}, nil
+}
+
+func (c *KubectlCluster) Delete(ctx context.Context, namespace string, name string) error {
+	_, err := c.run(ctx, nil, "delete",
+		"deployment/"+name,
+		"service/"+name,
+		"secret/"+adminSecretName(name),
+		"persistentvolumeclaim/"+dataClaimName(name),
+		"--namespace", namespace, "--ignore-not-found")
+	return err
+}
+
+func (c *KubectlCluster) WriteSecret(ctx context.Context, namespace string, name string, data map[string]string) (string, error) {
+	err := c.apply(ctx, map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]any{"name": name, "namespace": namespace},
+		"type":       "Opaque",
+		"stringData": data,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return secretResource(namespace, name), nil
+}
+
+// ReadConfigMap returns the data of a ConfigMap. Returns false if the ConfigMap does not exist.
+func (c *KubectlCluster) ReadConfigMap(ctx context.Context, namespace string, name string) (map[string]string, bool, error) {
+	output, err := c.run(ctx, nil, "get", "configmap", name, "--namespace", namespace, "--output", "json", "--ignore-not-found")
+	if err != nil {
+		return nil, false, err
+	} else if strings.TrimSpace(output) == "" {
+		return nil, false, nil
+	}
+
+	configMap := struct {
+		Data map[string]string `json:"data"`
+	}{}
+	err = json.Unmarshal([]byte(output), &configMap)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid ConfigMap %q from kubectl: %w", name, err)
+	}
+
+	return configMap.Data, true, nil
+}
+
+// apply applies a manifest. The manifest is passed on stdin so secrets are not visible in the process list.
+func (c *KubectlCluster) apply(ctx context.Context, manifest any) error {
+	bs, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.run(ctx, bytes.NewReader(bs), "apply", "--filename", "-")
+	return err
+}
+
+func (c *KubectlCluster) run(ctx context.Context, stdin io.Reader, args ...string) (string, error) {
+	path := c.Path
+	if path == "" {
+		path = "kubectl"
+	}
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("kubectl %s failed: %w: %s", args[0], err, stderr.String())
+	}
+
+	return stdout.String(), nil
+}
+
+// deploymentResources returns the IDs of the resources created by Deploy.
+func deploymentResources(namespace string, name string, spec ServerSpec) []string {
+	resources := []string{
+		"/planes/kubernetes/local/namespaces/" + namespace + "/providers/core/Service/" + name,
+		"/planes/kubernetes/local/namespaces/" + namespace + "/providers/apps/Deployment/" + name,
+		secretResource(namespace, adminSecretName(name)),
+	}
+
+	if spec.DataPath != "" {
+		resources = append(resources, "/planes/kubernetes/local/namespaces/"+namespace+"/providers/core/PersistentVolumeClaim/"+dataClaimName(name))
+	}
+
+	return resources
+}
+
+// adminSecretName returns the name of the Secret with the environment variables of a server deployed by Deploy.
+func adminSecretName(name string) string {
+	return name + "-admin"
+}
+
+// dataClaimName returns the name of the PersistentVolumeClaim of a server deployed by Deploy.
+func dataClaimName(name string) string {
+	return name + "-data"
+}
+
+// secretResource returns the ID of a secret written by WriteSecret.
+func secretResource(namespace string, name string) string {
+	return "/planes/kubernetes/local/namespaces/" + namespace + "/providers/core/Secret/" + name
+}
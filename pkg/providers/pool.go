@@ -0,0 +1,122 @@
+package providers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+)
+
+const (
+	// DefaultPoolServerPort is the port of a pool server that doesn't set one.
+	DefaultPoolServerPort = 5432
+)
+
+// PoolServer is a pre-existing PostgreSQL server that databases can be placed on.
+type PoolServer struct {
+	// Name identifies the server. It is recorded in the inventory of the resources placed on it.
+	Name string `json:"name"`
+	// Host is the hostname applications connect to.
+	Host string `json:"host"`
+	// Port is the port applications connect to. Defaults to DefaultPoolServerPort.
+	Port int `json:"port,omitempty"`
+	// AdminURL is the connection URL of the server, with the credentials of the server admin. Only used by the
+	// postgres database server provider.
+	AdminURL string `json:"adminUrl,omitempty"`
+	// Capacity is the most databases that can be placed on the server. Zero means no limit.
+	Capacity int `json:"capacity,omitempty"`
+	// Labels are matched against the labels requested for a database. Ex. {"environment": "dev", "region": "east"}
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// ServerPool is the registry of servers that databases can be placed on.
+type ServerPool struct {
+	Servers []PoolServer `json:"servers"`
+
+	databaseServers map[string]DatabaseServer
+}
+
+// NewServerPool creates a ServerPool. Each server is managed by a DatabaseServer of the given provider kind.
+func NewServerPool(servers []PoolServer, kind string) (*ServerPool, error) {
+	pool := &ServerPool{Servers: []PoolServer{}, databaseServers: map[string]DatabaseServer{}}
+	for _, server := range servers {
+		if server.Name == "" {
+			return nil, errors.New("every server in the pool must have a name")
+		} else if server.Host == "" {
+			return nil, fmt.Errorf("server %q in the pool must have a host", server.Name)
+		} else if server.Capacity < 0 {
+			return nil, fmt.Errorf("server %q in the pool has a negative capacity", server.Name)
+		} else if pool.databaseServers[server.Name] != nil {
+			return nil, fmt.Errorf("server %q is in the pool more than once", server.Name)
+		}
+
+		if server.Port == 0 {
+			server.Port = DefaultPoolServerPort
+		}
+
+		switch kind {
+		case "", Simulated:
+			pool.databaseServers[server.Name] = NewSimulatedDatabaseServer()
+
+		case Postgres:
+			if server.AdminURL == "" {
+				return nil, fmt.Errorf("server %q in the pool must have an adminUrl for the %s database server provider", server.Name, Postgres)
+			}
+			pool.databaseServers[server.Name] = NewDatabaseServerForURL(server.AdminURL)
+
+		default:
+			return nil, fmt.Errorf("unsupported database server provider %q", kind)
+		}
+
+		pool.Servers = append(pool.Servers, server)
+	}
+
+	return pool, nil
+}
+
+// NewServerPoolFromEnv loads the ServerPool from the JSON file named by the POSTGRES_SERVER_POOL environment
+// variable. The pool is empty if it is not set. The servers are managed by the provider selected by the
+// DATABASE_SERVER_PROVIDER environment variable. Ex.
+//
+//	{
+//	  "servers": [
+//	    { "name": "pg-dev-1", "host": "pg-dev-1.example.com", "capacity": 50, "labels": { "environment": "dev" } }
+//	  ]
+//	}
+func NewServerPoolFromEnv() (*ServerPool, error) {
+	path := os.Getenv("POSTGRES_SERVER_POOL")
+	if path == "" {
+		return NewServerPool(nil, os.Getenv("DATABASE_SERVER_PROVIDER"))
+	}
+
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading server pool: %w", err)
+	}
+
+	config := ServerPool{}
+	err = json.Unmarshal(bs, &config)
+	if err != nil {
+		return nil, fmt.Errorf("error reading server pool %q: %w", path, err)
+	}
+
+	return NewServerPool(config.Servers, os.Getenv("DATABASE_SERVER_PROVIDER"))
+}
+
+// Get returns the server with the given name. Returns false if it is not in the pool.
+func (p *ServerPool) Get(name string) (PoolServer, bool) {
+	i := slices.IndexFunc(p.Servers, func(server PoolServer) bool { return server.Name == name })
+	if i < 0 {
+		return PoolServer{}, false
+	}
+
+	return p.Servers[i], true
+}
+
+// DatabaseServer returns the DatabaseServer that manages the server with the given name. Returns false if it is not
+// in the pool.
+func (p *ServerPool) DatabaseServer(name string) (DatabaseServer, bool) {
+	server, ok := p.databaseServers[name]
+	return server, ok
+}
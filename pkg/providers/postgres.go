@@ -0,0 +1,284 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	// MigrationsTable is the table in each database that records the migrations that were applied.
+	MigrationsTable = "schema_migrations"
+)
+
+// PsqlDatabaseServer manages a real PostgreSQL server with psql. Labels are stored as JSON in the comments of
+// databases and users.
+type PsqlDatabaseServer struct {
+	// URL is the connection URL of the server, with the credentials of the server admin. The path of the URL is
+	// replaced with the database being operated on.
+	URL string
+	// Path is the path of the psql binary. Defaults to psql on the PATH.
+	Path string
+}
+
+var _ DatabaseServer = (*PsqlDatabaseServer)(nil)
+
+func (s *PsqlDatabaseServer) Name() string {
+	return Postgres
+}
+
+func (s *PsqlDatabaseServer) CreateUser(ctx context.Context, username string, password string, labels map[string]string) error {
+	exists, err := s.query(ctx, "postgres", fmt.Sprintf("SELECT 1 FROM pg_roles WHERE rolname = %s", QuoteLiteral(username)))
+	if err != nil {
+		return err
+	}
+
+	verb := "CREATE"
+	if len(exists) > 0 {
+		verb = "ALTER"
+	}
+
+	comment, err := labelsComment(labels)
+	if err != nil {
+		return err
+	}
+
+	return s.Exec(ctx, "postgres", []string{
+		fmt.Sprintf("%s ROLE %s WITH LOGIN PASSWORD %s", verb, QuoteIdentifier(username), QuoteLiteral(password)),
+		fmt.Sprintf("COMMENT ON ROLE %s IS %s", QuoteIdentifier(username), QuoteLiteral(comment)),
+	})
+}
+
+func (s *PsqlDatabaseServer) DeleteUser(ctx context.Context, username string) error {
+	return s.Exec(ctx, "postgres", []string{fmt.Sprintf("DROP ROLE IF EXISTS %s", QuoteIdentifier(username))})
+}
+
+func (s *PsqlDatabaseServer) CreateDatabase(ctx context.Context, database string, owner string, labels map[string]string) error {
+	comment, err := labelsComment(labels)
+	if err != nil {
+		return err
+	}
+
+	statement := fmt.Sprintf("CREATE DATABASE %s", QuoteIdentifier(database))
+	if owner != "" {
+		statement += fmt.Sprintf(" OWNER %s", QuoteIdentifier(owner))
+	}
+
+	// CREATE DATABASE can't run in a transaction.
+	_, err = s.run(ctx, "postgres", false, statement)
+	if err != nil {
+		return err
+	}
+
+	return s.Exec(ctx, "postgres", []string{fmt.Sprintf("COMMENT ON DATABASE %s IS %s", QuoteIdentifier(database), QuoteLiteral(comment))})
+}
+
+func (s *PsqlDatabaseServer) DeleteDatabase(ctx context.Context, database string) error {
+	// DROP DATABASE can't run in a transaction.
+	_, err := s.run(ctx, "postgres", false, fmt.Sprintf("DROP DATABASE IF EXISTS %s WITH (FORCE)", QuoteIdentifier(database)))
+	return err
+}
+
+func (s *PsqlDatabaseServer) DatabaseExists(ctx context.Context, database string) (bool, error) {
+	rows, err := s.query(ctx, "postgres", fmt.Sprintf("SELECT 1 FROM pg_database WHERE datname = %s", QuoteLiteral(database)))
+	if err != nil {
+		return false, err
+	}
+
+	return len(rows) > 0, nil
+}
+
+func (s *PsqlDatabaseServer) Exec(ctx context.Context, database string, statements []string) error {
+	_, err := s.run(ctx, database, true, strings.Join(statements, ";\n"))
+	return err
+}
+
+func (s *PsqlDatabaseServer) AppliedMigrations(ctx context.Context, database string) (map[string]string, error) {
+	err := s.Exec(ctx, database, []string{createMigrationsTableStatement()})
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.query(ctx, database, fmt.Sprintf("SELECT id || '|' || checksum FROM %s", MigrationsTable))
+	if err != nil {
+		return nil, err
+	}
+
+	applied := map[string]string{}
+	for _, row := range rows {
+		id, checksum, _ := strings.Cut(row, "|")
+		applied[id] = checksum
+	}
+	return applied, nil
+}
+
+func (s *PsqlDatabaseServer) ApplyMigration(ctx context.Context, database string, username string, migration Migration) error {
+	statements := []string{}
+	if username != "" {
+		statements = append(statements, fmt.Sprintf("SET LOCAL ROLE %s", QuoteIdentifier(username)))
+	}
+	statements = append(statements, migration.SQL, "RESET ROLE", insertMigrationStatement(migration))
+
+	return s.Exec(ctx, database, statements)
+}
+
+func (s *PsqlDatabaseServer) FindByLabels(ctx context.Context, labels map[string]string) ([]string, []string, error) {
+	databases, err := s.findByComment(ctx, "SELECT json_build_array(datname, shobj_description(oid, 'pg_database')) FROM pg_database WHERE shobj_description(oid, 'pg_database') IS NOT NULL", labels)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	users, err := s.findByComment(ctx, "SELECT json_build_array(rolname, shobj_description(oid, 'pg_authid')) FROM pg_roles WHERE shobj_description(oid, 'pg_authid') IS NOT NULL", labels)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return databases, users, nil
+}
+
+// findByComment runs a query that returns the name and comment of objects, and returns the names of the objects
+// whose comment contains the labels. The comments are matched here instead of in SQL, because a comment that isn't a
+// JSON object, like one written by hand, would fail a cast to jsonb and the whole query with it.
+func (s *PsqlDatabaseServer) findByComment(ctx context.Context, query string, labels map[string]string) ([]string, error) {
+	rows, err := s.query(ctx, "postgres", query)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, row := range rows {
+		// Each row is a JSON array, so names and comments with newlines or separators are read correctly.
+		columns := []string{}
+		err = json.Unmarshal([]byte(row), &columns)
+		if err != nil || len(columns) != 2 {
+			return nil, fmt.Errorf("unexpected row from psql: %q", row)
+		}
+
+		comment := map[string]any{}
+		if json.Unmarshal([]byte(columns[1]), &comment) != nil {
+			continue
+		}
+
+		if containsLabels(comment, labels) {
+			names = append(names, columns[0])
+		}
+	}
+	return names, nil
+}
+
+// query runs a query and returns the first column of each row.
+func (s *PsqlDatabaseServer) query(ctx context.Context, database string, query string) ([]string, error) {
+	output, err := s.run(ctx, database, false, query)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		if line != "" {
+			rows = append(rows, line)
+		}
+	}
+	return rows, nil
+}
+
+// run runs SQL with psql. The SQL is passed on stdin so passwords are not visible in the process list.
+func (s *PsqlDatabaseServer) run(ctx context.Context, database string, transaction bool, sql string) (string, error) {
+	if s.URL == "" {
+		return "", errors.New("POSTGRES_ADMIN_URL is required for databases that are not on a deployed server or a server in the pool")
+	}
+
+	connection, env, err := PostgresCommandEnv(s.URL, database)
+	if err != nil {
+		return "", err
+	}
+
+	path := s.Path
+	if path == "" {
+		path = "psql"
+	}
+
+	args := []string{"--no-psqlrc", "--quiet", "--tuples-only", "--no-align", "--set", "ON_ERROR_STOP=1", "--dbname", connection}
+	if transaction {
+		args = append(args, "--single-transaction")
+	}
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdin = strings.NewReader(sql)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Env = env
+	err = cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("psql failed: %w: %s", err, stderr.String())
+	}
+
+	return stdout.String(), nil
+}
+
+// PostgresCommandEnv returns the URL of a database on a server for the --dbname of a PostgreSQL client like psql, and
+// the environment to run the client with. The password is passed in the environment instead of the URL so it isn't
+// visible in the process list.
+func PostgresCommandEnv(serverURL string, database string) (string, []string, error) {
+	connection, err := url.Parse(serverURL)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid postgres URL: %w", err)
+	}
+	connection.Path = "/" + database
+
+	env := os.Environ()
+	if password, ok := connection.User.Password(); ok {
+		connection.User = url.User(connection.User.Username())
+		env = append(env, "PGPASSWORD="+password)
+	}
+
+	return connection.String(), env, nil
+}
+
+// QuoteIdentifier quotes a PostgreSQL identifier, like a database or user name.
+func QuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// QuoteLiteral quotes a PostgreSQL string literal.
+func QuoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+func labelsComment(labels map[string]string) (string, error) {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	bs, err := json.Marshal(labels)
+	if err != nil {
+		return "", err
+	}
+	return string(bs), nil
+}
+
+// containsLabels returns true if a comment has all of the labels.
+func containsLabels(comment map[string]any, labels map[string]string) bool {
+	for key, value := range labels {
+		if actual, ok := comment[key].(string); !ok || actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+func createMigrationsTableStatement() string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id text PRIMARY KEY, checksum text NOT NULL, applied_at timestamptz NOT NULL DEFAULT now())", MigrationsTable)
+}
+
+func insertMigrationStatement(migration Migration) string {
+	return fmt.Sprintf("INSERT INTO %s (id, checksum) VALUES (%s, %s)", MigrationsTable, QuoteLiteral(migration.ID), QuoteLiteral(migration.Checksum))
+}
@@ -0,0 +1,165 @@
+// Package providers separates what recipes do from the infrastructure they do it with. Activities call the
+// interfaces in this package, and the implementations are chosen by configuration: simulated providers for demos,
+// or real ones backed by PostgreSQL and Kubernetes. There are no providers for cloud services yet, like a managed
+// PostgreSQL service, and selecting the cloud provider is an error.
+package providers
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+const (
+	// Simulated providers log what they would do instead of doing it.
+	Simulated = "simulated"
+	// Postgres providers use a real PostgreSQL server.
+	Postgres = "postgres"
+	// Kubernetes providers use a real Kubernetes cluster.
+	Kubernetes = "kubernetes"
+	// Cloud providers would use a cloud service, like a managed PostgreSQL service. They are not implemented yet.
+	Cloud = "cloud"
+)
+
+// DatabaseServer creates and deletes users and databases on a PostgreSQL server.
+type DatabaseServer interface {
+	// Name returns the name of the provider.
+	Name() string
+	// CreateUser creates a user that can log in with the password, or changes the password of an existing user. The
+	// labels are attached to the user, so it can be found with FindByLabels.
+	CreateUser(ctx context.Context, username string, password string, labels map[string]string) error
+	// DeleteUser deletes a user. Deleting a user that does not exist is not an error.
+	DeleteUser(ctx context.Context, username string) error
+	// CreateDatabase creates a database owned by owner, or by the server admin if owner is empty. The labels are
+	// attached to the database, so it can be found with FindByLabels.
+	CreateDatabase(ctx context.Context, database string, owner string, labels map[string]string) error
+	// DeleteDatabase deletes a database. Deleting a database that does not exist is not an error.
+	DeleteDatabase(ctx context.Context, database string) error
+	// DatabaseExists returns true if the database exists.
+	DatabaseExists(ctx context.Context, database string) (bool, error)
+	// Exec runs SQL statements in a database, in a single transaction, as the server admin.
+	Exec(ctx context.Context, database string, statements []string) error
+	// AppliedMigrations returns the checksums of the migrations that were applied to a database, keyed by ID.
+	AppliedMigrations(ctx context.Context, database string) (map[string]string, error)
+	// ApplyMigration runs the SQL of a migration in a database and records it as applied, in a single transaction.
+	// The SQL runs as username so it owns the objects it creates, or as the server admin if username is empty.
+	ApplyMigration(ctx context.Context, database string, username string, migration Migration) error
+	// FindByLabels returns the databases and users that have all of the labels.
+	FindByLabels(ctx context.Context, labels map[string]string) (databases []string, users []string, err error)
+}
+
+// Migration is a SQL script that is applied to a database once.
+type Migration struct {
+	// ID identifies the migration in the migrations table.
+	ID string
+	// Checksum is the checksum of the SQL, used to detect migrations that were changed after they were applied.
+	Checksum string
+	// SQL is the script to run.
+	SQL string
+}
+
+// Deployment is a server that was deployed to a cluster.
+type Deployment struct {
+	// Host is the hostname of the server inside the cluster.
+	Host string
+	// Port is the port of the server.
+	Port int
+	// Resources are the IDs of the resources that were created.
+	Resources []string
+}
+
+// ServerSpec describes a server to deploy.
+type ServerSpec struct {
+	// Image is the container image of the server.
+	Image string
+	// Command replaces the entrypoint of the image. Empty to use the entrypoint.
+	Command []string
+	// Port is the port the server listens on.
+	Port int
+	// AdminPort is a second port the Service exposes, for the server's management API. Zero if there is none.
+	AdminPort int
+	// Env are the environment variables of the server. They are stored in a Secret, because they usually include the
+	// admin password.
+	Env map[string]string
+	// DataPath is the directory the server keeps its data in. A volume is mounted there, so the data survives
+	// restarts. Empty if the server has no data to keep.
+	DataPath string
+	// StorageSize is the size of the volume. Ex. 1Gi. Defaults to DefaultStorageSize.
+	StorageSize string
+}
+
+const (
+	// DefaultStorageSize is the size of the volume of a server that doesn't set one.
+	DefaultStorageSize = "1Gi"
+)
+
+// ClusterDeployer deploys servers to a cluster.
+type ClusterDeployer interface {
+	// Name returns the name of the provider.
+	Name() string
+	// Deploy deploys a single-replica server and a Service in front of it, and waits for it to be ready. Deploying a
+	// server that exists updates it.
+	Deploy(ctx context.Context, namespace string, name string, spec ServerSpec) (Deployment, error)
+	// Delete deletes a server deployed with Deploy, including its data. Deleting a server that does not exist is not
+	// an error.
+	Delete(ctx context.Context, namespace string, name string) error
+}
+
+// SecretWriter writes secrets that applications read their credentials from.
+type SecretWriter interface {
+	// Name returns the name of the provider.
+	Name() string
+	// WriteSecret creates or replaces a secret, and returns its resource ID.
+	WriteSecret(ctx context.Context, namespace string, name string, data map[string]string) (string, error)
+}
+
+// NewDatabaseServerFromEnv creates the DatabaseServer selected by the DATABASE_SERVER_PROVIDER environment variable:
+//
+//   - simulated (default)
+//   - postgres: POSTGRES_ADMIN_URL, and PSQL_PATH to override the location of psql. POSTGRES_ADMIN_URL is only
+//     needed for databases that are not on a deployed server or a server in the pool.
+//   - cloud: not implemented yet. Point the postgres provider at the admin URL of a managed server instead.
+func NewDatabaseServerFromEnv() (DatabaseServer, error) {
+	switch kind := os.Getenv("DATABASE_SERVER_PROVIDER"); kind {
+	case "", Simulated:
+		return NewSimulatedDatabaseServer(), nil
+
+	case Postgres:
+		return NewDatabaseServerForURL(os.Getenv("POSTGRES_ADMIN_URL")), nil
+
+	case Cloud:
+		return nil, fmt.Errorf("the %s database server provider is not implemented yet: use %s with the admin URL of a managed server", Cloud, Postgres)
+
+	default:
+		return nil, fmt.Errorf("unsupported database server provider %q", kind)
+	}
+}
+
+// NewDatabaseServerForURL creates a DatabaseServer that uses psql to manage the server at url. PSQL_PATH overrides
+// the location of psql.
+func NewDatabaseServerForURL(url string) DatabaseServer {
+	return &PsqlDatabaseServer{URL: url, Path: os.Getenv("PSQL_PATH")}
+}
+
+// NewClusterFromEnv creates the ClusterDeployer and SecretWriter selected by the CLUSTER_PROVIDER environment
+// variable:
+//
+//   - simulated (default)
+//   - kubernetes: uses kubectl with the current KUBECONFIG. KUBECTL_PATH overrides the location of kubectl.
+//   - cloud: not implemented yet. A managed Kubernetes cluster works with the kubernetes provider.
+func NewClusterFromEnv() (ClusterDeployer, SecretWriter, error) {
+	switch kind := os.Getenv("CLUSTER_PROVIDER"); kind {
+	case "", Simulated:
+		return &SimulatedCluster{}, &SimulatedCluster{}, nil
+
+	case Kubernetes:
+		cluster := &KubectlCluster{Path: os.Getenv("KUBECTL_PATH")}
+		return cluster, cluster, nil
+
+	case Cloud:
+		return nil, nil, fmt.Errorf("the %s cluster provider is not implemented yet: use %s with the KUBECONFIG of a managed cluster", Cloud, Kubernetes)
+
+	default:
+		return nil, nil, fmt.Errorf("unsupported cluster provider %q", kind)
+	}
+}
@@ -0,0 +1,169 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"sync"
+	"time"
+)
+
+// SimulatedDatabaseServer pretends to be a PostgreSQL server, for demos where there is no real server. Applied
+// migrations are remembered in memory, so they are forgotten when the process restarts.
+type SimulatedDatabaseServer struct {
+	mutex      sync.Mutex
+	migrations map[string]map[string]string
+}
+
+var _ DatabaseServer = (*SimulatedDatabaseServer)(nil)
+
+// NewSimulatedDatabaseServer creates a SimulatedDatabaseServer.
+func NewSimulatedDatabaseServer() *SimulatedDatabaseServer {
+	return &SimulatedDatabaseServer{migrations: map[string]map[string]string{}}
+}
+
+func (s *SimulatedDatabaseServer) Name() string {
+	return Simulated
+}
+
+func (s *SimulatedDatabaseServer) CreateUser(ctx context.Context, username string, password string, labels map[string]string) error {
+	// Pretend we are very secure...
+	logger := slog.Default()
+	logger.Info("Generating new postgres user", slog.String("username", username))
+	logger.Info("Generating really really secure password", slog.String("password", "********")) // Haha, just kidding
+	logger.Info("Labeling user", slog.Any("labels", labels))
+	return nil
+}
+
+func (s *SimulatedDatabaseServer) DeleteUser(ctx context.Context, username string) error {
+	logger := slog.Default()
+	logger.Info("Deleting postgres user", slog.String("username", username))
+	return nil
+}
+
+func (s *SimulatedDatabaseServer) CreateDatabase(ctx context.Context, database string, owner string, labels map[string]string) error {
+	// Pretend we are using a real database server...
+	logger := slog.Default()
+	logger.Info("Creating new database", slog.String("database", database))
+	logger.Info("Labeling database", slog.Any("labels", labels))
+	if owner != "" {
+		logger.Info("Granting user permission", slog.String("username", owner))
+	}
+	return nil
+}
+
+func (s *SimulatedDatabaseServer) DeleteDatabase(ctx context.Context, database string) error {
+	// Pretend we are using a real database server...
+	logger := slog.Default()
+	logger.Info("Deleting database", slog.String("database", database))
+
+	// The migrations table goes away with the database.
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.migrations, database)
+	return nil
+}
+
+func (s *SimulatedDatabaseServer) DatabaseExists(ctx context.Context, database string) (bool, error) {
+	// Pretend every database exists...
+	logger := slog.Default()
+	logger.Info("Looking up database", slog.String("database", database))
+	return true, nil
+}
+
+func (s *SimulatedDatabaseServer) Exec(ctx context.Context, database string, statements []string) error {
+	// Pretend we are using a real database server...
+	logger := slog.Default()
+	for _, statement := range statements {
+		logger.Info("Executing SQL", slog.String("database", database), slog.String("statement", statement))
+	}
+	return nil
+}
+
+func (s *SimulatedDatabaseServer) AppliedMigrations(ctx context.Context, database string) (map[string]string, error) {
+	err := s.Exec(ctx, database, []string{createMigrationsTableStatement()})
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return maps.Clone(s.migrations[database]), nil
+}
+
+func (s *SimulatedDatabaseServer) ApplyMigration(ctx context.Context, database string, username string, migration Migration) error {
+	statements := []string{}
+	if username != "" {
+		statements = append(statements, fmt.Sprintf("SET LOCAL ROLE %s", QuoteIdentifier(username)))
+	}
+	statements = append(statements, migration.SQL, "RESET ROLE", insertMigrationStatement(migration))
+
+	err := s.Exec(ctx, database, statements)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.migrations[database] == nil {
+		s.migrations[database] = map[string]string{}
+	}
+	s.migrations[database][migration.ID] = migration.Checksum
+	return nil
+}
+
+func (s *SimulatedDatabaseServer) FindByLabels(ctx context.Context, labels map[string]string) ([]string, []string, error) {
+	// Pretend we are searching the comments of databases and roles for our labels...
+	logger := slog.Default()
+	logger.Info("Searching for databases and users by label", slog.Any("labels", labels))
+	return []string{}, []string{}, nil
+}
+
+// SimulatedCluster pretends to be a Kubernetes cluster, for demos where there is no real cluster.
+type SimulatedCluster struct {
+}
+
+var _ ClusterDeployer = (*SimulatedCluster)(nil)
+var _ SecretWriter = (*SimulatedCluster)(nil)
+
+func (c *SimulatedCluster) Name() string {
+	return Simulated
+}
+
+func (c *SimulatedCluster) Deploy(ctx context.Context, namespace string, name string, spec ServerSpec) (Deployment, error) {
+	// Pretend we are deploying resources...
+	logger := slog.Default()
+	logger.Info("Deploying Kubernetes Secret", slog.Int("keys", len(spec.Env)))
+	if spec.DataPath != "" {
+		logger.Info("Deploying Kubernetes PersistentVolumeClaim", slog.String("path", spec.DataPath))
+	}
+	logger.Info("Deploying Kubernetes Deployment", slog.String("image", spec.Image))
+	logger.Info("Deploying Kubernetes Service")
+	logger.Info("Waiting for pods to be ready")
+	time.Sleep(2 * time.Second)
+	logger.Info("Pods are ready")
+
+	return Deployment{
+		Host:      fmt.Sprintf("%s.%s.svc.cluster.local", namespace, name),
+		Port:      spec.Port,
+		Resources: deploymentResources(namespace, name, spec),
+	}, nil
+}
+
+func (c *SimulatedCluster) Delete(ctx context.Context, namespace string, name string) error {
+	// Pretend we are deleting resources...
+	logger := slog.Default()
+	logger.Info("Deleting Kubernetes Deployment")
+	logger.Info("Deleting Kubernetes Service")
+	logger.Info("Deleting Kubernetes Secret")
+	logger.Info("Deleting Kubernetes PersistentVolumeClaim")
+	return nil
+}
+
+func (c *SimulatedCluster) WriteSecret(ctx context.Context, namespace string, name string, data map[string]string) (string, error) {
+	// Pretend we are updating the secret...
+	logger := slog.Default()
+	logger.Info("Updating Kubernetes Secret", slog.String("namespace", namespace), slog.String("name", name), slog.Int("keys", len(data)))
+	return secretResource(namespace, name), nil
+}
@@ -0,0 +1,153 @@
+// Package rabbitmq is a client for the parts of the RabbitMQ management HTTP API that recipes use.
+package rabbitmq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned when the object does not exist.
+	ErrNotFound = errors.New("not found")
+)
+
+// Queue describes a queue to declare.
+type Queue struct {
+	// Durable queues survive a broker restart.
+	Durable bool `json:"durable"`
+	// AutoDelete queues are deleted when their last consumer unsubscribes.
+	AutoDelete bool `json:"auto_delete"`
+	// Arguments are the optional queue arguments, like x-message-ttl.
+	Arguments map[string]any `json:"arguments"`
+}
+
+// Permissions are the regular expressions that match the resources a user can configure, write, and read in a vhost.
+type Permissions struct {
+	Configure string `json:"configure"`
+	Write     string `json:"write"`
+	Read      string `json:"read"`
+}
+
+// Client calls the RabbitMQ management HTTP API. Creating an object that already exists updates it, so every
+// operation can be retried.
+type Client struct {
+	// URL is the base URL of the management API. Ex. http://localhost:15672
+	URL string
+	// Username is the name of a user with the administrator tag.
+	Username string
+	// Password is the password of the user.
+	Password string
+	// Client is the HTTP client used to make requests. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// PutVHost creates a vhost.
+func (c *Client) PutVHost(ctx context.Context, vhost string) error {
+	return c.do(ctx, http.MethodPut, "/api/vhosts/"+url.PathEscape(vhost), map[string]any{})
+}
+
+// DeleteVHost deletes a vhost, and everything in it. Returns ErrNotFound if the vhost does not exist.
+func (c *Client) DeleteVHost(ctx context.Context, vhost string) error {
+	return c.do(ctx, http.MethodDelete, "/api/vhosts/"+url.PathEscape(vhost), nil)
+}
+
+// PutUser creates a user, or changes the password of an existing user. The user has no tags, so it can't use the
+// management API.
+func (c *Client) PutUser(ctx context.Context, username string, password string) error {
+	return c.do(ctx, http.MethodPut, "/api/users/"+url.PathEscape(username), map[string]any{
+		"password": password,
+		"tags":     "",
+	})
+}
+
+// DeleteUser deletes a user. Returns ErrNotFound if the user does not exist.
+func (c *Client) DeleteUser(ctx context.Context, username string) error {
+	return c.do(ctx, http.MethodDelete, "/api/users/"+url.PathEscape(username), nil)
+}
+
+// PutPermissions sets the permissions of a user in a vhost.
+func (c *Client) PutPermissions(ctx context.Context, vhost string, username string, permissions Permissions) error {
+	return c.do(ctx, http.MethodPut, "/api/permissions/"+url.PathEscape(vhost)+"/"+url.PathEscape(username), permissions)
+}
+
+// PutQueue declares a queue in a vhost. Declaring a queue that exists with different properties fails.
+func (c *Client) PutQueue(ctx context.Context, vhost string, name string, queue Queue) error {
+	if queue.Arguments == nil {
+		queue.Arguments = map[string]any{}
+	}
+	return c.do(ctx, http.MethodPut, "/api/queues/"+url.PathEscape(vhost)+"/"+url.PathEscape(name), queue)
+}
+
+// DeleteQueue deletes a queue, and the messages in it. Returns ErrNotFound if the queue does not exist.
+func (c *Client) DeleteQueue(ctx context.Context, vhost string, name string) error {
+	return c.do(ctx, http.MethodDelete, "/api/queues/"+url.PathEscape(vhost)+"/"+url.PathEscape(name), nil)
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, body any) error {
+	var reader io.Reader
+	if body != nil {
+		bs, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(bs)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.URL, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+
+	request.SetBasicAuth(c.Username, c.Password)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := c.client().Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	} else if response.StatusCode/100 != 2 {
+		bs, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return fmt.Errorf("unexpected status %s from RabbitMQ management API for %s %s: %s", response.Status, method, path, bs)
+	}
+
+	return nil
+}
+
+func (c *Client) client() *http.Client {
+	if c.Client != nil {
+		return c.Client
+	}
+
+	return http.DefaultClient
+}
+
+// NewClientFromEnv creates a Client for the management API at the RABBITMQ_MANAGEMENT_URL environment variable,
+// authenticated with RABBITMQ_MANAGEMENT_USERNAME and RABBITMQ_MANAGEMENT_PASSWORD. It is used when the cluster is
+// simulated, because servers deployed to a real cluster are managed with their own admin credentials. Returns nil if
+// the URL is not set, which means RabbitMQ is simulated.
+func NewClientFromEnv() *Client {
+	endpoint := os.Getenv("RABBITMQ_MANAGEMENT_URL")
+	if endpoint == "" {
+		return nil
+	}
+
+	return &Client{
+		URL:      endpoint,
+		Username: os.Getenv("RABBITMQ_MANAGEMENT_USERNAME"),
+		Password: os.Getenv("RABBITMQ_MANAGEMENT_PASSWORD"),
+	}
+}
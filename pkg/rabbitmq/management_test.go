@@ -0,0 +1,161 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// request is a request received by the test server.
+type request struct {
+	Method string
+	Path   string
+	Body   map[string]any
+}
+
+// newTestServer starts a management API that records the requests it receives, and responds with status.
+func newTestServer(t *testing.T, status int) (*Client, *[]request) {
+	t.Helper()
+
+	requests := []request{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "admin" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		received := request{Method: r.Method, Path: r.URL.EscapedPath()}
+		bs, _ := io.ReadAll(r.Body)
+		if len(bs) > 0 {
+			if r.Header.Get("Content-Type") != "application/json" {
+				t.Errorf("request to %s has Content-Type %q", received.Path, r.Header.Get("Content-Type"))
+			}
+
+			err := json.Unmarshal(bs, &received.Body)
+			if err != nil {
+				t.Errorf("request to %s has invalid body: %v", received.Path, err)
+			}
+		}
+		requests = append(requests, received)
+
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("error details"))
+	}))
+	t.Cleanup(server.Close)
+
+	return &Client{URL: server.URL + "/", Username: "admin", Password: "secret"}, &requests
+}
+
+func TestClient_Requests(t *testing.T) {
+	tests := []struct {
+		name string
+		call func(ctx context.Context, client *Client) error
+		want request
+	}{
+		{
+			name: "put vhost",
+			call: func(ctx context.Context, client *Client) error { return client.PutVHost(ctx, "orders/prod") },
+			want: request{Method: http.MethodPut, Path: "/api/vhosts/orders%2Fprod", Body: map[string]any{}},
+		},
+		{
+			name: "delete vhost",
+			call: func(ctx context.Context, client *Client) error { return client.DeleteVHost(ctx, "orders") },
+			want: request{Method: http.MethodDelete, Path: "/api/vhosts/orders"},
+		},
+		{
+			name: "put user",
+			call: func(ctx context.Context, client *Client) error { return client.PutUser(ctx, "app", "pw") },
+			want: request{Method: http.MethodPut, Path: "/api/users/app", Body: map[string]any{"password": "pw", "tags": ""}},
+		},
+		{
+			name: "delete user",
+			call: func(ctx context.Context, client *Client) error { return client.DeleteUser(ctx, "app") },
+			want: request{Method: http.MethodDelete, Path: "/api/users/app"},
+		},
+		{
+			name: "put permissions",
+			call: func(ctx context.Context, client *Client) error {
+				return client.PutPermissions(ctx, "orders", "app", Permissions{Configure: "c", Write: "w", Read: "r"})
+			},
+			want: request{Method: http.MethodPut, Path: "/api/permissions/orders/app", Body: map[string]any{"configure": "c", "write": "w", "read": "r"}},
+		},
+		{
+			name: "put queue",
+			call: func(ctx context.Context, client *Client) error {
+				return client.PutQueue(ctx, "orders", "incoming", Queue{Durable: true})
+			},
+			want: request{Method: http.MethodPut, Path: "/api/queues/orders/incoming", Body: map[string]any{"durable": true, "auto_delete": false, "arguments": map[string]any{}}},
+		},
+		{
+			name: "delete queue",
+			call: func(ctx context.Context, client *Client) error { return client.DeleteQueue(ctx, "orders", "incoming") },
+			want: request{Method: http.MethodDelete, Path: "/api/queues/orders/incoming"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, requests := newTestServer(t, http.StatusNoContent)
+
+			err := tt.call(context.Background(), client)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(*requests) != 1 {
+				t.Fatalf("got %d requests, want 1", len(*requests))
+			}
+
+			got := (*requests)[0]
+			if got.Method != tt.want.Method || got.Path != tt.want.Path {
+				t.Errorf("got %s %s, want %s %s", got.Method, got.Path, tt.want.Method, tt.want.Path)
+			}
+
+			gotBody, _ := json.Marshal(got.Body)
+			wantBody, _ := json.Marshal(tt.want.Body)
+			if string(gotBody) != string(wantBody) {
+				t.Errorf("got body %s, want %s", gotBody, wantBody)
+			}
+		})
+	}
+}
+
+func TestClient_NotFound(t *testing.T) {
+	client, _ := newTestServer(t, http.StatusNotFound)
+
+	err := client.DeleteQueue(context.Background(), "orders", "incoming")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v, want ErrNotFound", err)
+	}
+}
+
+func TestClient_ErrorStatus(t *testing.T) {
+	client, _ := newTestServer(t, http.StatusInternalServerError)
+
+	err := client.PutVHost(context.Background(), "orders")
+	if err == nil {
+		t.Fatal("expected an error")
+	} else if errors.Is(err, ErrNotFound) {
+		t.Fatalf("got ErrNotFound for a 500")
+	}
+
+	if !strings.Contains(err.Error(), "500") || !strings.Contains(err.Error(), "error details") {
+		t.Errorf("error %q should include the status and the response body", err)
+	}
+}
+
+func TestClient_Unauthorized(t *testing.T) {
+	client, _ := newTestServer(t, http.StatusNoContent)
+	client.Password = "wrong"
+
+	err := client.PutVHost(context.Background(), "orders")
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("got error %v, want a 401 error", err)
+	}
+}
@@ -1,6 +1,8 @@
 package recipes
 
 import (
+	"encoding/json"
+	"fmt"
 	"log/slog"
 
 	"github.com/go-openapi/jsonpointer"
@@ -22,6 +24,8 @@ type Context struct {
 	Azure *ProviderAzure `json:"azure,omitempty"`
 	// AWS represents AWS provider scope.
 	AWS *ProviderAWS `json:"aws,omitempty"`
+	// Parameters represents the recipe parameters, from the environment's recipe registration and the resource.
+	Parameters map[string]any `json:"parameters,omitempty"`
 }
 
 func (c *Context) LogAttrs() []slog.Attr {
@@ -44,6 +48,39 @@ type Resource struct {
 	Properties map[string]any `json:"properties,omitempty"`
 }
 
+// GetStringParameter returns the value of a string recipe parameter. Returns false if the parameter is not set or
+// is not a string.
+func (c *Context) GetStringParameter(name string) (string, bool) {
+	value, ok := c.Parameters[name].(string)
+	if !ok || value == "" {
+		return "", false
+	}
+
+	return value, true
+}
+
+// DecodeParameter decodes the value of a recipe parameter into v. Returns false if the parameter is not set.
+func (c *Context) DecodeParameter(name string, v any) (bool, error) {
+	value, ok := c.Parameters[name]
+	if !ok || value == nil {
+		return false, nil
+	}
+
+	bs, err := json.Marshal(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid value for parameter %q: %w", name, err)
+	}
+
+	err = json.Unmarshal(bs, v)
+	if err != nil {
+		return false, fmt.Errorf("invalid value for parameter %q: %w", name, err)
+	}
+
+	return true, nil
+}
+
+// GetStringValue returns the string value at the JSON pointer key in the resource's properties. Returns false if the
+// value is missing, empty, or not a string.
 func (r *Resource) GetStringValue(key string) (string, bool) {
 	ptr, err := jsonpointer.New(key)
 	if err != nil {
@@ -55,7 +92,12 @@ func (r *Resource) GetStringValue(key string) (string, bool) {
 		return "", false
 	}
 
-	return value.(string), true
+	s, ok := value.(string)
+	if !ok || s == "" {
+		return "", false
+	}
+
+	return s, true
 }
 
 // ResourceInfo represents name and id of the resource
@@ -0,0 +1,43 @@
+package recipes
+
+import (
+	"github.com/rynowak/workflow-recipe/pkg/backup"
+)
+
+// DeletionReport represents the result of a recipe deletion. It lists everything the recipe knew about, and what
+// happened to it.
+type DeletionReport struct {
+	// Policy is the deletion policy that was applied. Ex. delete, retain-data, abandon
+	Policy string `json:"policy,omitempty"`
+	// Removed lists the items that were deleted.
+	Removed []DeletionItem `json:"removed"`
+	// Retained lists the items that were found but intentionally kept.
+	Retained []DeletionItem `json:"retained"`
+	// NotFound lists the items that could not be located, and so were not deleted.
+	NotFound []DeletionItem `json:"notFound"`
+	// Backups lists the backups that were taken before data was deleted.
+	Backups []backup.Metadata `json:"backups,omitempty"`
+	// Warnings are messages about anything that might need attention, like orphaned data.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// DeletionItem is a single item in a DeletionReport.
+type DeletionItem struct {
+	// Kind is the kind of item. Ex. database, user, kubernetes
+	Kind string `json:"kind"`
+	// Name is the name or ID of the item.
+	Name string `json:"name,omitempty"`
+	// Source is where the recipe learned about the item. Ex. inventory, binding, labels
+	Source string `json:"source,omitempty"`
+	// Reason explains why the item was retained or not found.
+	Reason string `json:"reason,omitempty"`
+}
+
+// NewDeletionReport creates an empty DeletionReport.
+func NewDeletionReport() DeletionReport {
+	return DeletionReport{
+		Removed:  []DeletionItem{},
+		Retained: []DeletionItem{},
+		NotFound: []DeletionItem{},
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+
+	daprclient "github.com/dapr/go-sdk/client"
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/microsoft/durabletask-go/api"
+	"github.com/microsoft/durabletask-go/backend"
+	durabletaskclient "github.com/microsoft/durabletask-go/client"
+)
+
+// WorkflowClient is the set of workflow operations used by the server.
+type WorkflowClient interface {
+	ScheduleNewWorkflow(ctx context.Context, workflow string, opts ...api.NewOrchestrationOptions) (string, error)
+	FetchWorkflowMetadata(ctx context.Context, id string, opts ...api.FetchOrchestrationMetadataOptions) (*daprworkflow.Metadata, error)
+	WaitForWorkflowStart(ctx context.Context, id string, opts ...api.FetchOrchestrationMetadataOptions) (*daprworkflow.Metadata, error)
+	WaitForWorkflowCompletion(ctx context.Context, id string, opts ...api.FetchOrchestrationMetadataOptions) (*daprworkflow.Metadata, error)
+	RaiseEvent(ctx context.Context, id string, eventName string, opts ...api.RaiseEventOptions) error
+	TerminateWorkflow(ctx context.Context, id string, opts ...api.TerminateOptions) error
+	PurgeWorkflow(ctx context.Context, id string) error
+}
+
+// NewWorkflowClient creates a WorkflowClient that talks to the Dapr sidecar.
+//
+// This talks to the durable task client directly rather than going through the Dapr SDK's workflow client. The SDK
+// client dereferences a nil result when a lookup fails, which panics instead of returning api.ErrInstanceNotFound or
+// context.Canceled. We rely on those errors for long-polling and streaming.
+func NewWorkflowClient(dapr daprclient.Client) WorkflowClient {
+	return &workflowClient{
+		inner: durabletaskclient.NewTaskHubGrpcClient(dapr.GrpcClientConn(), backend.DefaultLogger()),
+	}
+}
+
+type workflowClient struct {
+	inner *durabletaskclient.TaskHubGrpcClient
+}
+
+func (c *workflowClient) ScheduleNewWorkflow(ctx context.Context, workflow string, opts ...api.NewOrchestrationOptions) (string, error) {
+	id, err := c.inner.ScheduleNewOrchestration(ctx, workflow, opts...)
+	return string(id), err
+}
+
+func (c *workflowClient) FetchWorkflowMetadata(ctx context.Context, id string, opts ...api.FetchOrchestrationMetadataOptions) (*daprworkflow.Metadata, error) {
+	metadata, err := c.inner.FetchOrchestrationMetadata(ctx, api.InstanceID(id), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return convertMetadata(metadata), nil
+}
+
+func (c *workflowClient) WaitForWorkflowStart(ctx context.Context, id string, opts ...api.FetchOrchestrationMetadataOptions) (*daprworkflow.Metadata, error) {
+	metadata, err := c.inner.WaitForOrchestrationStart(ctx, api.InstanceID(id), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return convertMetadata(metadata), nil
+}
+
+func (c *workflowClient) WaitForWorkflowCompletion(ctx context.Context, id string, opts ...api.FetchOrchestrationMetadataOptions) (*daprworkflow.Metadata, error) {
+	metadata, err := c.inner.WaitForOrchestrationCompletion(ctx, api.InstanceID(id), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return convertMetadata(metadata), nil
+}
+
+func (c *workflowClient) RaiseEvent(ctx context.Context, id string, eventName string, opts ...api.RaiseEventOptions) error {
+	return c.inner.RaiseEvent(ctx, api.InstanceID(id), eventName, opts...)
+}
+
+func (c *workflowClient) TerminateWorkflow(ctx context.Context, id string, opts ...api.TerminateOptions) error {
+	return c.inner.TerminateOrchestration(ctx, api.InstanceID(id), opts...)
+}
+
+func (c *workflowClient) PurgeWorkflow(ctx context.Context, id string) error {
+	return c.inner.PurgeOrchestrationState(ctx, api.InstanceID(id))
+}
+
+func convertMetadata(metadata *api.OrchestrationMetadata) *daprworkflow.Metadata {
+	result := &daprworkflow.Metadata{
+		InstanceID:             string(metadata.InstanceID),
+		Name:                   metadata.Name,
+		RuntimeStatus:          daprworkflow.Status(metadata.RuntimeStatus.Number()),
+		CreatedAt:              metadata.CreatedAt,
+		LastUpdatedAt:          metadata.LastUpdatedAt,
+		SerializedInput:        metadata.SerializedInput,
+		SerializedOutput:       metadata.SerializedOutput,
+		SerializedCustomStatus: metadata.SerializedCustomStatus,
+	}
+
+	current := &result.FailureDetails
+	for failure := metadata.FailureDetails; failure != nil; failure = failure.GetInnerFailure() {
+		*current = &daprworkflow.FailureDetails{
+			Type:           failure.GetErrorType(),
+			Message:        failure.GetErrorMessage(),
+			StackTrace:     failure.GetStackTrace().GetValue(),
+			IsNonRetriable: failure.GetIsNonRetriable(),
+		}
+		current = &(*current).InnerFailure
+	}
+
+	return result
+}
+
+// isTerminal returns true if the workflow will not make any further progress.
+func isTerminal(status daprworkflow.Status) bool {
+	switch status {
+	case daprworkflow.StatusCompleted, daprworkflow.StatusFailed, daprworkflow.StatusCanceled, daprworkflow.StatusTerminated:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,358 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/google/uuid"
+	"github.com/microsoft/durabletask-go/api"
+	"github.com/rynowak/workflow-recipe/pkg/inventory"
+)
+
+// RotateCredentialsWorkflows maps the name of a recipe to the workflow that rotates the credentials of its resources.
+var RotateCredentialsWorkflows = map[string]string{
+	"PostgresSQLDatabases": "PostgresSQLCredentialsRotate",
+}
+
+// LeaseCredentialsWorkflows maps the name of a recipe to the workflow that leases temporary credentials for its
+// resources.
+var LeaseCredentialsWorkflows = map[string]string{
+	"PostgresSQLDatabases": "PostgresSQLCredentialsLease",
+}
+
+const (
+	// LeaseControlEvent is the name of the event that renews or revokes a lease.
+	LeaseControlEvent = "control"
+
+	// LeaseMaxTTL is the longest TTL a lease can be issued or renewed with. It matches the maximum lifetime of a lease
+	// in the lease workflow, which would fail on a longer TTL after the lease was accepted.
+	LeaseMaxTTL = 24 * time.Hour
+
+	// LeaseIssueTimeout is how long POST /resources/{id}/credentials waits for credentials to be issued.
+	LeaseIssueTimeout = time.Minute
+
+	// leaseIssuePollInterval is how often the server checks whether leased credentials have been issued.
+	leaseIssuePollInterval = 250 * time.Millisecond
+)
+
+// LeaseRequest is the request body of POST /resources/{id}/credentials, and of renewing a lease. The body is
+// optional.
+type LeaseRequest struct {
+	// TTL is how long the credentials last. Ex. 15m. Defaults to 1h, and can be at most 24h.
+	TTL string `json:"ttl,omitempty"`
+}
+
+// Lease is the response body of the lease endpoints. The credentials are only returned when the lease is created.
+type Lease struct {
+	LeaseID       string          `json:"leaseId"`
+	ResourceID    string          `json:"resourceId"`
+	RuntimeStatus string          `json:"runtimeStatus,omitempty"`
+	Credentials   json.RawMessage `json:"credentials,omitempty"`
+	State         json.RawMessage `json:"state,omitempty"`
+}
+
+// handleCreateLease issues temporary credentials for a resource. The credentials are dropped when the lease expires
+// unless it is renewed.
+func handleCreateLease(client WorkflowClient, store *inventory.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+
+		decoder := json.NewDecoder(r.Body)
+		defer r.Body.Close()
+
+		request := LeaseRequest{}
+		err := decoder.Decode(&request)
+		if err != nil && !errors.Is(err, io.EOF) {
+			mustWriteError(w, http.StatusBadRequest, "Invalid", err)
+			return
+		}
+
+		err = validateTTL(request.TTL)
+		if err != nil {
+			mustWriteError(w, http.StatusBadRequest, "Invalid", err)
+			return
+		}
+
+		record, err := store.Get(r.Context(), id)
+		if errors.Is(err, inventory.ErrNotFound) {
+			mustWriteError(w, http.StatusNotFound, "NotFound", err)
+			return
+		} else if err != nil {
+			mustWriteError(w, http.StatusInternalServerError, "Internal", err)
+			return
+		}
+
+		workflow, ok := LeaseCredentialsWorkflows[record.Recipe]
+		if !ok {
+			mustWriteError(w, http.StatusBadRequest, "Invalid", fmt.Errorf("recipe %q does not support leased credentials", record.Recipe))
+			return
+		}
+
+		leaseID, err := client.ScheduleNewWorkflow(r.Context(), workflow,
+			daprworkflow.WithInstanceID(uuid.NewString()),
+			daprworkflow.WithInput(map[string]any{
+				"resourceId": id,
+				"ttl":        request.TTL,
+			}))
+		if err != nil {
+			mustWriteError(w, http.StatusInternalServerError, "Internal", err)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Lease started", slog.String("lease.id", leaseID), slog.String("resource.id", id))
+
+		issued, err := waitForLeaseCredentials(r.Context(), client, leaseID)
+		if err != nil {
+			mustWriteError(w, http.StatusInternalServerError, "Internal", fmt.Errorf("error issuing credentials for lease %q: %w", leaseID, err))
+			return
+		}
+
+		// The password is only needed for this response, so don't keep it in the history of the issuing workflow.
+		err = client.PurgeWorkflow(r.Context(), leaseID+"-issue")
+		if err != nil {
+			slog.WarnContext(r.Context(), "Error purging issued credentials", slog.String("lease.id", leaseID), slog.Any("error", err))
+		}
+
+		mustWriteJSON(w, http.StatusCreated, Lease{
+			LeaseID:     leaseID,
+			ResourceID:  id,
+			Credentials: json.RawMessage(issued.SerializedOutput),
+		})
+	}
+}
+
+// waitForLeaseCredentials waits for the workflow that issues the credentials of a lease to complete, and returns its
+// metadata. The issuing workflow is a child of the lease workflow, so it doesn't exist right away.
+func waitForLeaseCredentials(ctx context.Context, client WorkflowClient, leaseID string) (*daprworkflow.Metadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, LeaseIssueTimeout)
+	defer cancel()
+
+	for {
+		issued, err := client.FetchWorkflowMetadata(ctx, leaseID+"-issue", daprworkflow.WithFetchPayloads(true))
+		if err == nil && issued.RuntimeStatus == daprworkflow.StatusCompleted {
+			return issued, nil
+		} else if err == nil && isTerminal(issued.RuntimeStatus) {
+			return nil, workflowFailure(issued)
+		} else if err != nil && !errors.Is(err, api.ErrInstanceNotFound) {
+			return nil, err
+		}
+
+		// The lease can fail before it starts issuing, like when the resource is locked for too long.
+		lease, err := client.FetchWorkflowMetadata(ctx, leaseID)
+		if err != nil && !errors.Is(err, api.ErrInstanceNotFound) {
+			return nil, err
+		} else if err == nil && lease.RuntimeStatus == daprworkflow.StatusFailed {
+			return nil, workflowFailure(lease)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(leaseIssuePollInterval):
+		}
+	}
+}
+
+// workflowFailure returns the error a workflow failed with.
+func workflowFailure(metadata *daprworkflow.Metadata) error {
+	if metadata.FailureDetails != nil {
+		return errors.New(metadata.FailureDetails.Message)
+	}
+
+	return fmt.Errorf("workflow %q is %s", metadata.InstanceID, metadata.RuntimeStatus.String())
+}
+
+// handleGetLease returns the status and expiry of a lease.
+func handleGetLease(client WorkflowClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lease, ok := fetchLease(w, r, client)
+		if !ok {
+			return
+		}
+
+		mustWriteJSON(w, http.StatusOK, lease)
+	}
+}
+
+// handleRenewLease extends a lease by its TTL, or by the TTL in the request.
+func handleRenewLease(client WorkflowClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		decoder := json.NewDecoder(r.Body)
+		defer r.Body.Close()
+
+		request := LeaseRequest{}
+		err := decoder.Decode(&request)
+		if err != nil && !errors.Is(err, io.EOF) {
+			mustWriteError(w, http.StatusBadRequest, "Invalid", err)
+			return
+		}
+
+		err = validateTTL(request.TTL)
+		if err != nil {
+			mustWriteError(w, http.StatusBadRequest, "Invalid", err)
+			return
+		}
+
+		sendLeaseCommand(w, r, client, map[string]any{"action": "renew", "ttl": request.TTL})
+	}
+}
+
+// handleRevokeLease drops the credentials of a lease before it expires.
+func handleRevokeLease(client WorkflowClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sendLeaseCommand(w, r, client, map[string]any{"action": "revoke"})
+	}
+}
+
+func sendLeaseCommand(w http.ResponseWriter, r *http.Request, client WorkflowClient, command map[string]any) {
+	lease, ok := fetchLease(w, r, client)
+	if !ok {
+		return
+	}
+
+	if lease.RuntimeStatus != daprworkflow.StatusRunning.String() {
+		mustWriteError(w, http.StatusConflict, "Conflict", fmt.Errorf("lease %q is not active: status is %s", lease.LeaseID, lease.RuntimeStatus))
+		return
+	}
+
+	err := client.RaiseEvent(r.Context(), lease.LeaseID, LeaseControlEvent, api.WithEventPayload(command))
+	if err != nil {
+		mustWriteError(w, http.StatusInternalServerError, "Internal", err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Sent action to lease", slog.String("lease.id", lease.LeaseID), slog.Any("action", command["action"]))
+	mustWriteJSON(w, http.StatusAccepted, Lease{LeaseID: lease.LeaseID, ResourceID: lease.ResourceID})
+}
+
+// fetchLease looks up the lease in the request path, and writes an error response if it doesn't exist or belongs to
+// another resource.
+func fetchLease(w http.ResponseWriter, r *http.Request, client WorkflowClient) (Lease, bool) {
+	id := r.PathValue("id")
+	leaseID := r.PathValue("leaseId")
+
+	metadata, err := client.FetchWorkflowMetadata(r.Context(), leaseID, daprworkflow.WithFetchPayloads(true))
+	if err != nil {
+		writeFetchError(w, err)
+		return Lease{}, false
+	}
+
+	// Completed leases return their final state as output.
+	state := metadata.SerializedInput
+	if isTerminal(metadata.RuntimeStatus) && metadata.SerializedOutput != "" {
+		state = metadata.SerializedOutput
+	}
+
+	owner := struct {
+		ResourceID string `json:"resourceId"`
+	}{}
+	_ = json.Unmarshal([]byte(state), &owner)
+	if owner.ResourceID != id {
+		mustWriteError(w, http.StatusNotFound, "NotFound", fmt.Errorf("lease %q not found for resource %q", leaseID, id))
+		return Lease{}, false
+	}
+
+	return Lease{
+		LeaseID:       leaseID,
+		ResourceID:    id,
+		RuntimeStatus: metadata.RuntimeStatus.String(),
+		State:         json.RawMessage(state),
+	}, true
+}
+
+// validateTTL returns an error if a TTL is not a valid positive duration of at most LeaseMaxTTL. Empty is valid.
+func validateTTL(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid ttl: %w", err)
+	} else if ttl <= 0 {
+		return errors.New("invalid ttl: must be positive")
+	} else if ttl > LeaseMaxTTL {
+		return fmt.Errorf("invalid ttl: must be at most %s", LeaseMaxTTL)
+	}
+
+	return nil
+}
+
+// RotateCredentialsRequest is the request body of POST /resources/{id}/credentials/rotate. The body is optional.
+type RotateCredentialsRequest struct {
+	// GracePeriod is how long the old credentials keep working. Ex. 30m. Defaults to 1h.
+	GracePeriod string `json:"gracePeriod,omitempty"`
+}
+
+// handleRotateCredentials starts a workflow that rotates the credentials of a resource.
+func handleRotateCredentials(client WorkflowClient, store *inventory.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+
+		decoder := json.NewDecoder(r.Body)
+		defer r.Body.Close()
+
+		request := RotateCredentialsRequest{}
+		err := decoder.Decode(&request)
+		if err != nil && !errors.Is(err, io.EOF) {
+			mustWriteError(w, http.StatusBadRequest, "Invalid", err)
+			return
+		}
+
+		err = validateGracePeriod(request.GracePeriod)
+		if err != nil {
+			mustWriteError(w, http.StatusBadRequest, "Invalid", err)
+			return
+		}
+
+		record, err := store.Get(r.Context(), id)
+		if errors.Is(err, inventory.ErrNotFound) {
+			mustWriteError(w, http.StatusNotFound, "NotFound", err)
+			return
+		} else if err != nil {
+			mustWriteError(w, http.StatusInternalServerError, "Internal", err)
+			return
+		}
+
+		workflow, ok := RotateCredentialsWorkflows[record.Recipe]
+		if !ok {
+			mustWriteError(w, http.StatusBadRequest, "Invalid", fmt.Errorf("recipe %q does not support credential rotation", record.Recipe))
+			return
+		}
+
+		result, err := client.ScheduleNewWorkflow(r.Context(), workflow, daprworkflow.WithInput(map[string]any{
+			"resourceId":  id,
+			"gracePeriod": request.GracePeriod,
+		}))
+		if err != nil {
+			mustWriteError(w, http.StatusInternalServerError, "Internal", err)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Credential rotation started", slog.String("id", result), slog.String("resource.id", id))
+		writeAccepted(w, r, result)
+	}
+}
+
+// validateGracePeriod returns an error if a grace period is not a valid non-negative duration. Empty is valid.
+func validateGracePeriod(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	gracePeriod, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid gracePeriod: %w", err)
+	} else if gracePeriod < 0 {
+		return errors.New("invalid gracePeriod: must not be negative")
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	daprclient "github.com/dapr/go-sdk/client"
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+)
+
+const (
+	// StateStore is the name of the Dapr state store component used by the server.
+	StateStore = "statestore"
+
+	// maxReuseDecisions is the number of ID reuse decisions retained for each workflow ID.
+	maxReuseDecisions = 50
+)
+
+// IDReusePolicy controls what happens when a workflow is started with the ID of an existing instance.
+//
+// In every policy a request with the same workflow name and input as the existing instance is treated as a retry,
+// and returns the existing instance without starting anything.
+type IDReusePolicy string
+
+const (
+	// IDReusePolicyReject rejects a request with different input with 409 Conflict.
+	IDReusePolicyReject IDReusePolicy = "reject"
+	// IDReusePolicyReplaceTerminated replaces the existing instance if it has reached a terminal state, and otherwise
+	// behaves like IDReusePolicyReject.
+	IDReusePolicyReplaceTerminated IDReusePolicy = "replaceTerminated"
+
+	// DefaultIDReusePolicy is used when a request does not specify a policy.
+	DefaultIDReusePolicy = IDReusePolicyReject
+)
+
+func (p IDReusePolicy) IsValid() bool {
+	return p == IDReusePolicyReject || p == IDReusePolicyReplaceTerminated
+}
+
+// ReuseDecision is the outcome of starting a workflow with a given ID.
+type ReuseDecision string
+
+const (
+	// ReuseDecisionCreated means no instance existed with the ID and a new one was started.
+	ReuseDecisionCreated ReuseDecision = "Created"
+	// ReuseDecisionExisting means the request matched the existing instance, which was returned.
+	ReuseDecisionExisting ReuseDecision = "Existing"
+	// ReuseDecisionConflict means the request did not match the existing instance and was rejected.
+	ReuseDecisionConflict ReuseDecision = "Conflict"
+	// ReuseDecisionReplaced means the existing instance was terminal and was replaced by a new one.
+	ReuseDecisionReplaced ReuseDecision = "Replaced"
+)
+
+// WorkflowRecord is the audit record of the requests made for a workflow ID. It is stored in the state store.
+type WorkflowRecord struct {
+	ID        string                `json:"id"`
+	Name      string                `json:"name"`
+	InputHash string                `json:"inputHash"`
+	CreatedAt time.Time             `json:"createdAt"`
+	Decisions []WorkflowReuseRecord `json:"decisions"`
+}
+
+// WorkflowReuseRecord records a single request made for a workflow ID and what was decided.
+type WorkflowReuseRecord struct {
+	Time          time.Time     `json:"time"`
+	Decision      ReuseDecision `json:"decision"`
+	Policy        IDReusePolicy `json:"policy"`
+	Name          string        `json:"name"`
+	InputHash     string        `json:"inputHash"`
+	ExistingHash  string        `json:"existingHash,omitempty"`
+	ExistingState string        `json:"existingState,omitempty"`
+	RemoteAddr    string        `json:"remoteAddr,omitempty"`
+	UserAgent     string        `json:"userAgent,omitempty"`
+}
+
+// hashWorkflowInput computes a stable hash of a workflow name and its input. The input is normalized so that
+// formatting and key order do not affect the hash.
+func hashWorkflowInput(name string, input []byte) (string, error) {
+	var value any
+	decoder := json.NewDecoder(bytes.NewReader(input))
+	decoder.UseNumber()
+	err := decoder.Decode(&value)
+	if err != nil {
+		return "", fmt.Errorf("invalid workflow input: %w", err)
+	}
+
+	normalized, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(name))
+	hash.Write([]byte{0})
+	hash.Write(normalized)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// decideReuse chooses what to do with a request for an ID that already has an instance.
+func decideReuse(policy IDReusePolicy, existing *daprworkflow.Metadata, existingHash string, inputHash string) ReuseDecision {
+	if existingHash == inputHash {
+		return ReuseDecisionExisting
+	}
+
+	if policy == IDReusePolicyReplaceTerminated && isTerminal(existing.RuntimeStatus) {
+		return ReuseDecisionReplaced
+	}
+
+	return ReuseDecisionConflict
+}
+
+func newConflictError(existing *daprworkflow.Metadata, existingHash string, inputHash string) ErrorDetails {
+	return ErrorDetails{
+		Code:    "Conflict",
+		Message: fmt.Sprintf("workflow %q already exists with a different name or input", existing.InstanceID),
+		Target:  existing.InstanceID,
+		AdditionalInfo: []ErrorAdditionalInfo{
+			{
+				Type: "WorkflowInstance",
+				Info: map[string]any{
+					"id":           existing.InstanceID,
+					"name":         existing.Name,
+					"status":       existing.RuntimeStatus.String(),
+					"inputHash":    inputHash,
+					"existingHash": existingHash,
+				},
+			},
+		},
+	}
+}
+
+// recordReuseDecision appends a decision to the audit record for the workflow ID. The name and hash are those of the
+// instance that owns the ID after the decision.
+func recordReuseDecision(ctx context.Context, dapr daprclient.Client, r *http.Request, id string, name string, inputHash string, decision WorkflowReuseRecord) error {
+	key := "workflows||" + id
+	item, err := dapr.GetState(ctx, StateStore, key, nil)
+	if err != nil {
+		return fmt.Errorf("error reading workflow record: %w", err)
+	}
+
+	record := WorkflowRecord{}
+	if len(item.Value) > 0 {
+		err = json.Unmarshal(item.Value, &record)
+		if err != nil {
+			return fmt.Errorf("error reading workflow record: %w", err)
+		}
+	}
+
+	decision.RemoteAddr = r.RemoteAddr
+	decision.UserAgent = r.UserAgent()
+
+	if decision.Decision == ReuseDecisionCreated || decision.Decision == ReuseDecisionReplaced || record.ID == "" {
+		record.ID = id
+		record.Name = name
+		record.InputHash = inputHash
+		record.CreatedAt = decision.Time
+	}
+
+	record.Decisions = append(record.Decisions, decision)
+	if len(record.Decisions) > maxReuseDecisions {
+		record.Decisions = record.Decisions[len(record.Decisions)-maxReuseDecisions:]
+	}
+
+	bs, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return dapr.SaveStateWithETag(ctx, StateStore, key, bs, item.Etag, nil)
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+)
+
+const (
+	// RetryAfter is the polling interval suggested to clients of asynchronous operations.
+	RetryAfter = 5 * time.Second
+)
+
+// OperationState is the ARM provisioning state of an asynchronous operation.
+type OperationState string
+
+const (
+	OperationStateAccepted  OperationState = "Accepted"
+	OperationStateRunning   OperationState = "Running"
+	OperationStateSucceeded OperationState = "Succeeded"
+	OperationStateFailed    OperationState = "Failed"
+	OperationStateCanceled  OperationState = "Canceled"
+)
+
+// IsTerminal returns true if the operation will not make any further progress.
+func (s OperationState) IsTerminal() bool {
+	return s == OperationStateSucceeded || s == OperationStateFailed || s == OperationStateCanceled
+}
+
+// OperationStatus is the ARM asynchronous operation status resource. Each operation is backed by a workflow
+// instance with the same ID.
+//
+// See: https://github.com/Azure/azure-resource-manager-rpc/blob/master/v1.0/async-api-reference.md
+type OperationStatus struct {
+	ID              string         `json:"id"`
+	Name            string         `json:"name"`
+	Status          OperationState `json:"status"`
+	StartTime       *time.Time     `json:"startTime,omitempty"`
+	EndTime         *time.Time     `json:"endTime,omitempty"`
+	PercentComplete float64        `json:"percentComplete"`
+	Error           *ErrorDetails  `json:"error,omitempty"`
+}
+
+// newOperationStatus builds the status of an operation from the workflow instance that backs it.
+func newOperationStatus(metadata *daprworkflow.Metadata) OperationStatus {
+	status := OperationStatus{
+		ID:     operationPath(metadata.InstanceID),
+		Name:   metadata.InstanceID,
+		Status: operationState(metadata.RuntimeStatus),
+	}
+
+	if !metadata.CreatedAt.IsZero() {
+		startTime := metadata.CreatedAt.UTC()
+		status.StartTime = &startTime
+	}
+
+	if status.Status.IsTerminal() {
+		endTime := metadata.LastUpdatedAt.UTC()
+		status.EndTime = &endTime
+		status.PercentComplete = 100
+	} else {
+		status.PercentComplete = percentComplete(metadata.SerializedCustomStatus)
+	}
+
+	if metadata.FailureDetails != nil {
+		details := newErrorDetails(metadata.FailureDetails)
+		status.Error = &details
+	} else if status.Status == OperationStateFailed {
+		status.Error = &ErrorDetails{Code: "OperationFailed", Message: "the operation failed"}
+	} else if status.Status == OperationStateCanceled {
+		status.Error = &ErrorDetails{Code: "Canceled", Message: "the operation was canceled"}
+	}
+
+	return status
+}
+
+func operationState(status daprworkflow.Status) OperationState {
+	switch status {
+	case daprworkflow.StatusPending:
+		return OperationStateAccepted
+	case daprworkflow.StatusCompleted:
+		return OperationStateSucceeded
+	case daprworkflow.StatusFailed:
+		return OperationStateFailed
+	case daprworkflow.StatusCanceled, daprworkflow.StatusTerminated:
+		return OperationStateCanceled
+	default:
+		return OperationStateRunning
+	}
+}
+
+// percentComplete reads progress from the workflow's custom status, if the workflow reports any.
+func percentComplete(customStatus string) float64 {
+	if customStatus == "" {
+		return 0
+	}
+
+	progress := struct {
+		PercentComplete float64 `json:"percentComplete"`
+	}{}
+	err := json.Unmarshal([]byte(customStatus), &progress)
+	if err != nil {
+		return 0
+	}
+
+	return min(max(progress.PercentComplete, 0), 100)
+}
+
+func newErrorDetails(failure *daprworkflow.FailureDetails) ErrorDetails {
+	details := ErrorDetails{
+		Code:    "OperationFailed",
+		Message: failure.Message,
+	}
+	if failure.Type != "" {
+		details.Target = failure.Type
+	}
+	if failure.InnerFailure != nil {
+		details.Details = []ErrorDetails{newErrorDetails(failure.InnerFailure)}
+	}
+
+	return details
+}
+
+func operationPath(id string) string {
+	return "/operations/" + id
+}
+
+func operationResultPath(id string) string {
+	return "/operationResults/" + id
+}
+
+// absoluteURL returns an absolute URL for path on the server handling the request.
+func absoluteURL(r *http.Request, path string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return fmt.Sprintf("%s://%s%s", scheme, r.Host, path)
+}
+
+// writeAsyncHeaders writes the headers ARM clients use to poll an asynchronous operation.
+func writeAsyncHeaders(w http.ResponseWriter, r *http.Request, id string) {
+	w.Header().Set("Azure-AsyncOperation", absoluteURL(r, operationPath(id)))
+	w.Header().Set("Location", absoluteURL(r, operationResultPath(id)))
+	w.Header().Set("Retry-After", strconv.Itoa(int(RetryAfter.Seconds())))
+}
+
+// writeAccepted responds to a request that started an asynchronous operation.
+func writeAccepted(w http.ResponseWriter, r *http.Request, id string) {
+	writeAsyncHeaders(w, r, id)
+	mustWriteJSON(w, http.StatusAccepted, map[string]any{"id": id})
+}
+
+// handleGetOperation returns the status resource of an operation. This is the Azure-AsyncOperation URL.
+func handleGetOperation(client WorkflowClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		metadata, err := client.FetchWorkflowMetadata(r.Context(), id)
+		if err != nil {
+			writeFetchError(w, err)
+			return
+		}
+
+		status := newOperationStatus(metadata)
+		if !status.Status.IsTerminal() {
+			w.Header().Set("Retry-After", strconv.Itoa(int(RetryAfter.Seconds())))
+		}
+
+		mustWriteJSON(w, http.StatusOK, status)
+	}
+}
+
+// handleGetOperationResult returns 202 while an operation is in progress and the output of the workflow once it has
+// completed. This is the Location URL.
+func handleGetOperationResult(client WorkflowClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		metadata, err := client.FetchWorkflowMetadata(r.Context(), id, daprworkflow.WithFetchPayloads(true))
+		if err != nil {
+			writeFetchError(w, err)
+			return
+		}
+
+		status := newOperationStatus(metadata)
+		switch status.Status {
+		case OperationStateSucceeded:
+			if metadata.SerializedOutput == "" {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(metadata.SerializedOutput))
+
+		case OperationStateFailed, OperationStateCanceled:
+			mustWriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: *status.Error})
+
+		default:
+			writeAsyncHeaders(w, r, id)
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/rynowak/workflow-recipe/pkg/inventory"
+)
+
+// RestoreWorkflows maps the name of a recipe to the workflow that restores its resources from a backup.
+var RestoreWorkflows = map[string]string{
+	"PostgresSQLDatabases": "PostgresSQLDatabasesRestore",
+}
+
+// ResourceList is the response body of GET /resources.
+type ResourceList struct {
+	Value []inventory.Record `json:"value"`
+}
+
+// handleListResources returns every resource in the inventory.
+func handleListResources(store *inventory.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		records, err := store.List(r.Context())
+		if err != nil {
+			mustWriteError(w, http.StatusInternalServerError, "Internal", err)
+			return
+		}
+
+		mustWriteJSON(w, http.StatusOK, ResourceList{Value: records})
+	}
+}
+
+// handleGetResource returns a single resource from the inventory. Resource IDs contain slashes, so the ID must be
+// URL-encoded in the path.
+func handleGetResource(store *inventory.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		record, err := store.Get(r.Context(), id)
+		if errors.Is(err, inventory.ErrNotFound) {
+			mustWriteError(w, http.StatusNotFound, "NotFound", err)
+			return
+		} else if err != nil {
+			mustWriteError(w, http.StatusInternalServerError, "Internal", err)
+			return
+		}
+
+		mustWriteJSON(w, http.StatusOK, record)
+	}
+}
+
+// RestoreRequest is the request body of POST /resources/{id}/restore.
+type RestoreRequest struct {
+	// Backup is the ID of the backup to restore.
+	Backup string `json:"backup"`
+	// Recipe is the name of the recipe that provisions the resource. Defaults to the recipe in the inventory.
+	Recipe string `json:"recipe,omitempty"`
+	// Context is the recipe context to provision the resource with. Defaults to the context in the inventory.
+	Context json.RawMessage `json:"context,omitempty"`
+}
+
+// handleRestoreResource starts a workflow that restores a resource from a backup. A resource that is no longer in the
+// inventory can be restored by providing the recipe and context in the request.
+func handleRestoreResource(client WorkflowClient, store *inventory.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+
+		decoder := json.NewDecoder(r.Body)
+		defer r.Body.Close()
+
+		request := RestoreRequest{}
+		err := decoder.Decode(&request)
+		if err != nil {
+			mustWriteError(w, http.StatusBadRequest, "Invalid", err)
+			return
+		}
+
+		if request.Backup == "" {
+			mustWriteError(w, http.StatusBadRequest, "Invalid", errors.New("backup is required"))
+			return
+		}
+
+		if request.Recipe == "" || len(request.Context) == 0 {
+			record, err := store.Get(r.Context(), id)
+			if errors.Is(err, inventory.ErrNotFound) {
+				mustWriteError(w, http.StatusNotFound, "NotFound", fmt.Errorf("%w: recipe and context are required", err))
+				return
+			} else if err != nil {
+				mustWriteError(w, http.StatusInternalServerError, "Internal", err)
+				return
+			}
+
+			if request.Recipe == "" {
+				request.Recipe = record.Recipe
+			}
+			if len(request.Context) == 0 {
+				request.Context = record.Context
+			}
+		}
+
+		workflow, ok := RestoreWorkflows[request.Recipe]
+		if !ok {
+			mustWriteError(w, http.StatusBadRequest, "Invalid", fmt.Errorf("recipe %q does not support restore", request.Recipe))
+			return
+		} else if len(request.Context) == 0 {
+			mustWriteError(w, http.StatusBadRequest, "Invalid", errors.New("context is required: the inventory record does not have one"))
+			return
+		}
+
+		// Only the resource ID is checked here, the workflow validates the rest of the context.
+		resource := struct {
+			Resource struct {
+				ID string `json:"id"`
+			} `json:"resource"`
+		}{}
+		err = json.Unmarshal(request.Context, &resource)
+		if err != nil {
+			mustWriteError(w, http.StatusBadRequest, "Invalid", err)
+			return
+		} else if resource.Resource.ID != id {
+			mustWriteError(w, http.StatusBadRequest, "Invalid", fmt.Errorf("context is for resource %q, not %q", resource.Resource.ID, id))
+			return
+		}
+
+		input, err := json.Marshal(map[string]any{
+			"context": request.Context,
+			"backup":  request.Backup,
+		})
+		if err != nil {
+			mustWriteError(w, http.StatusInternalServerError, "Internal", err)
+			return
+		}
+
+		result, err := client.ScheduleNewWorkflow(r.Context(), workflow, daprworkflow.WithRawInput(string(input)))
+		if err != nil {
+			mustWriteError(w, http.StatusInternalServerError, "Internal", err)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Restore started", slog.String("id", result), slog.String("resource.id", id), slog.String("backup.id", request.Backup))
+		writeAccepted(w, r, result)
+	}
+}
+
+// handleUndeleteResource cancels the deletion of a soft-deleted resource, and restores access to it. The Delete
+// workflow that is waiting to delete the resource fails, so the resource is kept.
+func handleUndeleteResource(client WorkflowClient, store *inventory.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		record, err := store.Get(r.Context(), id)
+		if errors.Is(err, inventory.ErrNotFound) {
+			mustWriteError(w, http.StatusNotFound, "NotFound", err)
+			return
+		} else if err != nil {
+			mustWriteError(w, http.StatusInternalServerError, "Internal", err)
+			return
+		}
+
+		if record.PendingDeletion == nil {
+			mustWriteError(w, http.StatusConflict, "Conflict", fmt.Errorf("resource %q is not pending deletion", id))
+			return
+		}
+
+		// The deletion can't be cancelled once the recovery window has ended.
+		metadata, err := client.FetchWorkflowMetadata(r.Context(), record.PendingDeletion.InstanceID)
+		if err != nil {
+			writeFetchError(w, err)
+			return
+		} else if metadata.RuntimeStatus != daprworkflow.StatusRunning {
+			mustWriteError(w, http.StatusConflict, "Conflict", fmt.Errorf("the deletion of resource %q can't be cancelled: status is %s", id, metadata.RuntimeStatus.String()))
+			return
+		}
+
+		err = client.RaiseEvent(r.Context(), record.PendingDeletion.InstanceID, inventory.UndeleteEvent)
+		if err != nil {
+			mustWriteError(w, http.StatusInternalServerError, "Internal", err)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Undelete requested", slog.String("id", record.PendingDeletion.InstanceID), slog.String("resource.id", id))
+		mustWriteJSON(w, http.StatusAccepted, record)
+	}
+}
@@ -0,0 +1,297 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/microsoft/durabletask-go/api"
+	"github.com/rynowak/workflow-recipe/pkg/backup"
+	"github.com/rynowak/workflow-recipe/pkg/cron"
+)
+
+const (
+	// ScheduleControlEvent is the name of the event that controls a running schedule.
+	ScheduleControlEvent = "control"
+
+	// scheduleTerminateTimeout is how long to wait for a schedule to stop before it is purged.
+	scheduleTerminateTimeout = 30 * time.Second
+)
+
+// scheduleKind describes a kind of schedule. Each schedule is an eternal workflow instance, with an ID derived from
+// the ID of the schedule.
+type scheduleKind struct {
+	// Workflow is the name of the workflow that runs the schedule.
+	Workflow string
+	// InstancePrefix is prepended to the ID of a schedule to get the workflow instance ID.
+	InstancePrefix string
+	// Validate validates the request body of PUT.
+	Validate func(body json.RawMessage) error
+}
+
+var (
+	// BackupSchedules is the kind of schedule that backs up databases.
+	BackupSchedules = scheduleKind{
+		Workflow:       "PostgresSQLDatabasesBackupSchedule",
+		InstancePrefix: "backup-schedule-",
+		Validate: func(body json.RawMessage) error {
+			request := BackupScheduleRequest{}
+			err := json.Unmarshal(body, &request)
+			if err != nil {
+				return err
+			}
+
+			_, err = cron.Parse(request.Schedule)
+			if err != nil {
+				return err
+			}
+
+			if request.Retention != nil {
+				return request.Retention.Validate()
+			}
+
+			return nil
+		},
+	}
+
+	// CredentialRotationSchedules is the kind of schedule that rotates database credentials.
+	CredentialRotationSchedules = scheduleKind{
+		Workflow:       "PostgresSQLCredentialsRotationSchedule",
+		InstancePrefix: "credential-rotation-schedule-",
+		Validate: func(body json.RawMessage) error {
+			request := CredentialRotationScheduleRequest{}
+			err := json.Unmarshal(body, &request)
+			if err != nil {
+				return err
+			}
+
+			if request.Schedule != "" {
+				_, err = cron.Parse(request.Schedule)
+				if err != nil {
+					return err
+				}
+			}
+
+			if request.MaxAgeDays < 0 {
+				return errors.New("maxAgeDays must not be negative")
+			}
+
+			return validateGracePeriod(request.GracePeriod)
+		},
+	}
+)
+
+// BackupScheduleRequest is the request body of PUT /backupSchedules/{id}.
+type BackupScheduleRequest struct {
+	// EnvironmentID limits the schedule to resources in an environment. Empty means every resource.
+	EnvironmentID string `json:"environmentId,omitempty"`
+	// Schedule is a cron expression for when backups are taken, evaluated in UTC.
+	Schedule string `json:"schedule"`
+	// Retention is how long scheduled backups are kept. Defaults to the last 7 backups.
+	Retention *backup.Retention `json:"retention,omitempty"`
+	// Paused creates the schedule without taking backups until it is resumed.
+	Paused bool `json:"paused,omitempty"`
+}
+
+// CredentialRotationScheduleRequest is the request body of PUT /credentialRotationSchedules/{id}.
+type CredentialRotationScheduleRequest struct {
+	// EnvironmentID limits the schedule to resources in an environment. Empty means every resource.
+	EnvironmentID string `json:"environmentId,omitempty"`
+	// Schedule is a cron expression for when to check for credentials that are due, evaluated in UTC. Defaults to
+	// daily.
+	Schedule string `json:"schedule,omitempty"`
+	// MaxAgeDays is how old credentials can get before they are rotated. Defaults to 90.
+	MaxAgeDays int `json:"maxAgeDays,omitempty"`
+	// GracePeriod is how long old credentials keep working after a rotation. Ex. 30m. Defaults to 1h.
+	GracePeriod string `json:"gracePeriod,omitempty"`
+	// Paused creates the schedule without rotating credentials until it is resumed.
+	Paused bool `json:"paused,omitempty"`
+}
+
+// Schedule is the response body of the schedule endpoints.
+type Schedule struct {
+	ID            string          `json:"id"`
+	InstanceID    string          `json:"instanceId"`
+	RuntimeStatus string          `json:"runtimeStatus,omitempty"`
+	State         json.RawMessage `json:"state,omitempty"`
+}
+
+// scheduleActions are the actions that can be sent to a schedule with POST /{kind}/{id}/{action}.
+var scheduleActions = map[string]bool{
+	"pause":  true,
+	"resume": true,
+	"runNow": true,
+}
+
+// handlePutSchedule creates a schedule, or updates the configuration of a running one.
+func handlePutSchedule(client WorkflowClient, kind scheduleKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		instanceID := kind.InstancePrefix + id
+
+		decoder := json.NewDecoder(r.Body)
+		defer r.Body.Close()
+
+		request := json.RawMessage{}
+		err := decoder.Decode(&request)
+		if err != nil {
+			mustWriteError(w, http.StatusBadRequest, "Invalid", err)
+			return
+		}
+
+		err = kind.Validate(request)
+		if err != nil {
+			mustWriteError(w, http.StatusBadRequest, "Invalid", err)
+			return
+		}
+
+		existing, err := client.FetchWorkflowMetadata(r.Context(), instanceID)
+		if err != nil && !errors.Is(err, api.ErrInstanceNotFound) {
+			mustWriteError(w, http.StatusInternalServerError, "Internal", err)
+			return
+		}
+
+		// A running schedule is updated in place, so it keeps its history of runs.
+		if err == nil && !isTerminal(existing.RuntimeStatus) {
+			err = client.RaiseEvent(r.Context(), instanceID, ScheduleControlEvent, api.WithEventPayload(map[string]any{
+				"action": "update",
+				"config": request,
+			}))
+			if err != nil {
+				mustWriteError(w, http.StatusInternalServerError, "Internal", err)
+				return
+			}
+
+			slog.InfoContext(r.Context(), "Updated schedule", slog.String("id", id), slog.String("workflow", kind.Workflow))
+			mustWriteJSON(w, http.StatusAccepted, Schedule{ID: id, InstanceID: instanceID})
+			return
+		}
+
+		// A schedule that failed or was terminated is replaced.
+		if err == nil {
+			err = client.PurgeWorkflow(r.Context(), instanceID)
+			if err != nil && !errors.Is(err, api.ErrInstanceNotFound) {
+				mustWriteError(w, http.StatusInternalServerError, "Internal", err)
+				return
+			}
+		}
+
+		_, err = client.ScheduleNewWorkflow(r.Context(), kind.Workflow,
+			daprworkflow.WithInstanceID(instanceID),
+			daprworkflow.WithRawInput(string(request)))
+		if err != nil {
+			mustWriteError(w, http.StatusInternalServerError, "Internal", err)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Created schedule", slog.String("id", id), slog.String("workflow", kind.Workflow))
+		mustWriteJSON(w, http.StatusCreated, Schedule{ID: id, InstanceID: instanceID})
+	}
+}
+
+// handleGetSchedule returns the configuration, next run, and last run of a schedule.
+func handleGetSchedule(client WorkflowClient, kind scheduleKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		instanceID := kind.InstancePrefix + id
+
+		metadata, err := client.FetchWorkflowMetadata(r.Context(), instanceID, daprworkflow.WithFetchPayloads(true))
+		if err != nil {
+			writeFetchError(w, err)
+			return
+		}
+
+		// Each iteration of the schedule continues as new with its state as the input.
+		schedule := Schedule{
+			ID:            id,
+			InstanceID:    instanceID,
+			RuntimeStatus: metadata.RuntimeStatus.String(),
+		}
+		if json.Valid([]byte(metadata.SerializedInput)) {
+			schedule.State = json.RawMessage(metadata.SerializedInput)
+		}
+
+		mustWriteJSON(w, http.StatusOK, schedule)
+	}
+}
+
+// handleScheduleAction sends an action to a running schedule.
+func handleScheduleAction(client WorkflowClient, kind scheduleKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		instanceID := kind.InstancePrefix + id
+
+		action := r.PathValue("action")
+		if !scheduleActions[action] {
+			mustWriteError(w, http.StatusBadRequest, "Invalid", fmt.Errorf("unsupported action %q: supported actions are pause, resume, and runNow", action))
+			return
+		}
+
+		metadata, err := client.FetchWorkflowMetadata(r.Context(), instanceID)
+		if err != nil {
+			writeFetchError(w, err)
+			return
+		} else if isTerminal(metadata.RuntimeStatus) {
+			mustWriteError(w, http.StatusConflict, "Conflict", fmt.Errorf("schedule %q is not running: status is %s", id, metadata.RuntimeStatus.String()))
+			return
+		}
+
+		err = client.RaiseEvent(r.Context(), instanceID, ScheduleControlEvent, api.WithEventPayload(map[string]any{
+			"action": action,
+		}))
+		if err != nil {
+			mustWriteError(w, http.StatusInternalServerError, "Internal", err)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Sent action to schedule", slog.String("id", id), slog.String("workflow", kind.Workflow), slog.String("action", action))
+		mustWriteJSON(w, http.StatusAccepted, Schedule{ID: id, InstanceID: instanceID})
+	}
+}
+
+// handleDeleteSchedule stops a schedule and removes its history. What the schedule did, like taking backups, is not
+// undone.
+func handleDeleteSchedule(client WorkflowClient, kind scheduleKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		instanceID := kind.InstancePrefix + id
+
+		metadata, err := client.FetchWorkflowMetadata(r.Context(), instanceID)
+		if err != nil {
+			writeFetchError(w, err)
+			return
+		}
+
+		if !isTerminal(metadata.RuntimeStatus) {
+			err = client.TerminateWorkflow(r.Context(), instanceID)
+			if err != nil {
+				mustWriteError(w, http.StatusInternalServerError, "Internal", err)
+				return
+			}
+
+			// Terminating is asynchronous, and a running instance can't be purged.
+			waitCtx, cancel := context.WithTimeout(r.Context(), scheduleTerminateTimeout)
+			defer cancel()
+
+			_, err = client.WaitForWorkflowCompletion(waitCtx, instanceID)
+			if err != nil {
+				mustWriteError(w, http.StatusInternalServerError, "Internal", fmt.Errorf("error waiting for schedule to stop: %w", err))
+				return
+			}
+		}
+
+		err = client.PurgeWorkflow(r.Context(), instanceID)
+		if err != nil && !errors.Is(err, api.ErrInstanceNotFound) {
+			mustWriteError(w, http.StatusInternalServerError, "Internal", err)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Deleted schedule", slog.String("id", id), slog.String("workflow", kind.Workflow))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
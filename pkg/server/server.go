@@ -8,10 +8,12 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
+	"time"
 
 	daprclient "github.com/dapr/go-sdk/client"
 	daprworkflow "github.com/dapr/go-sdk/workflow"
 	"github.com/microsoft/durabletask-go/api"
+	"github.com/rynowak/workflow-recipe/pkg/inventory"
 )
 
 const (
@@ -19,10 +21,9 @@ const (
 )
 
 func Start(ctx context.Context, services map[string]context.CancelFunc, dapr daprclient.Client) error {
-	workflowClient, err := daprworkflow.NewClient(daprworkflow.WithDaprClient(dapr))
-	if err != nil {
-		return fmt.Errorf("error creating Dapr workflow client: %v", err)
-	}
+	workflowClient := NewWorkflowClient(dapr)
+	waiters := newWaiters(MaxWaiters)
+	resources := inventory.NewStore(dapr, StateStore)
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
@@ -33,15 +34,43 @@ func Start(ctx context.Context, services map[string]context.CancelFunc, dapr dap
 		slog.InfoContext(ctx, "Fetching workflow metadata", slog.String("id", r.PathValue("id")))
 
 		id := r.PathValue("id")
-		metadata, err := workflowClient.FetchWorkflowMetadata(r.Context(), id, daprworkflow.WithFetchPayloads(true))
+		wait, err := parseWait(r)
 		if err != nil {
-			mustWriteError(w, http.StatusInternalServerError, "Internal", err)
+			mustWriteError(w, http.StatusBadRequest, "Invalid", err)
+			return
+		}
+
+		if wait == 0 {
+			metadata, err := workflowClient.FetchWorkflowMetadata(r.Context(), id, daprworkflow.WithFetchPayloads(true))
+			if err != nil {
+				writeFetchError(w, err)
+				return
+			}
+
+			mustWriteJSON(w, http.StatusOK, metadata)
+			return
+		}
+
+		if !waiters.tryAcquire() {
+			writeTooManyWaiters(w)
+			return
+		}
+		defer waiters.release()
+
+		metadata, err := waitForWorkflow(r.Context(), workflowClient, id, wait)
+		if r.Context().Err() != nil {
+			slog.InfoContext(ctx, "Client disconnected while waiting for workflow", slog.String("id", id))
+			return
+		} else if err != nil {
+			writeFetchError(w, err)
 			return
 		}
 
 		mustWriteJSON(w, http.StatusOK, metadata)
 	})
 
+	mux.HandleFunc("GET /workflows/{id}/events", handleWorkflowEvents(workflowClient, waiters))
+
 	mux.HandleFunc("PUT /workflows", func(w http.ResponseWriter, r *http.Request) {
 		decoder := json.NewDecoder(r.Body)
 		defer r.Body.Close()
@@ -58,7 +87,78 @@ func Start(ctx context.Context, services map[string]context.CancelFunc, dapr dap
 			return
 		}
 
-		slog.InfoContext(ctx, "Starting new workflow", slog.String("id", r.PathValue("id")), slog.String("name", request.Name))
+		policy := request.IDReusePolicy
+		if policy == "" {
+			policy = DefaultIDReusePolicy
+		} else if !policy.IsValid() {
+			mustWriteError(w, http.StatusBadRequest, "Invalid", fmt.Errorf("unsupported idReusePolicy %q", policy))
+			return
+		}
+
+		inputHash, err := hashWorkflowInput(request.Name, request.Input)
+		if err != nil {
+			mustWriteError(w, http.StatusBadRequest, "Invalid", err)
+			return
+		}
+
+		audit := func(name string, hash string, record WorkflowReuseRecord) {
+			record.Time = time.Now().UTC()
+			record.Policy = policy
+			record.Name = request.Name
+			record.InputHash = inputHash
+			err := recordReuseDecision(r.Context(), dapr, r, request.ID, name, hash, record)
+			if err != nil {
+				slog.WarnContext(ctx, "Error recording workflow request", slog.String("id", request.ID), slog.Any("error", err))
+			}
+		}
+
+		reuse := WorkflowReuseRecord{Decision: ReuseDecisionCreated}
+		if request.ID != "" {
+			existing, err := workflowClient.FetchWorkflowMetadata(r.Context(), request.ID, daprworkflow.WithFetchPayloads(true))
+			if err != nil && !errors.Is(err, api.ErrInstanceNotFound) {
+				mustWriteError(w, http.StatusInternalServerError, "Internal", err)
+				return
+			}
+
+			if err == nil {
+				// An instance we can't hash can never match, so it is treated as different input.
+				existingHash, _ := hashWorkflowInput(existing.Name, []byte(existing.SerializedInput))
+				decision := decideReuse(policy, existing, existingHash, inputHash)
+
+				slog.InfoContext(ctx, "Workflow ID already in use",
+					slog.String("id", request.ID),
+					slog.String("name", request.Name),
+					slog.String("status", existing.RuntimeStatus.String()),
+					slog.String("decision", string(decision)))
+
+				reuse = WorkflowReuseRecord{
+					Decision:      decision,
+					ExistingHash:  existingHash,
+					ExistingState: existing.RuntimeStatus.String(),
+				}
+
+				switch decision {
+				case ReuseDecisionExisting:
+					audit(existing.Name, existingHash, reuse)
+					writeAccepted(w, r, existing.InstanceID)
+					return
+
+				case ReuseDecisionConflict:
+					audit(existing.Name, existingHash, reuse)
+					mustWriteJSON(w, http.StatusConflict, ErrorResponse{Error: newConflictError(existing, existingHash, inputHash)})
+					return
+
+				case ReuseDecisionReplaced:
+					err = workflowClient.PurgeWorkflow(r.Context(), request.ID)
+					if err != nil {
+						mustWriteError(w, http.StatusInternalServerError, "Internal", err)
+						return
+					}
+				}
+			}
+		}
+
+		slog.InfoContext(ctx, "Starting new workflow", slog.String("id", request.ID), slog.String("name", request.Name))
 
 		opts := []api.NewOrchestrationOptions{}
 		opts = append(opts, daprworkflow.WithRawInput(string(request.Input)))
@@ -72,10 +172,37 @@ func Start(ctx context.Context, services map[string]context.CancelFunc, dapr dap
 			return
 		}
 
+		request.ID = result
+		audit(request.Name, inputHash, reuse)
+
 		slog.InfoContext(ctx, "Workflow started", slog.String("id", result), slog.String("name", request.Name))
-		mustWriteJSON(w, http.StatusCreated, map[string]any{"id": result})
+		writeAccepted(w, r, result)
 	})
 
+	mux.HandleFunc("GET /operations/{id}", handleGetOperation(workflowClient))
+	mux.HandleFunc("GET /operationResults/{id}", handleGetOperationResult(workflowClient))
+
+	mux.HandleFunc("GET /resources", handleListResources(resources))
+	mux.HandleFunc("GET /resources/{id}", handleGetResource(resources))
+	mux.HandleFunc("POST /resources/{id}/restore", handleRestoreResource(workflowClient, resources))
+	mux.HandleFunc("POST /resources/{id}/undelete", handleUndeleteResource(workflowClient, resources))
+
+	mux.HandleFunc("POST /resources/{id}/credentials/rotate", handleRotateCredentials(workflowClient, resources))
+	mux.HandleFunc("POST /resources/{id}/credentials", handleCreateLease(workflowClient, resources))
+	mux.HandleFunc("GET /resources/{id}/credentials/{leaseId}", handleGetLease(workflowClient))
+	mux.HandleFunc("POST /resources/{id}/credentials/{leaseId}/renew", handleRenewLease(workflowClient))
+	mux.HandleFunc("DELETE /resources/{id}/credentials/{leaseId}", handleRevokeLease(workflowClient))
+
+	for path, kind := range map[string]scheduleKind{
+		"/backupSchedules":             BackupSchedules,
+		"/credentialRotationSchedules": CredentialRotationSchedules,
+	} {
+		mux.HandleFunc("PUT "+path+"/{id}", handlePutSchedule(workflowClient, kind))
+		mux.HandleFunc("GET "+path+"/{id}", handleGetSchedule(workflowClient, kind))
+		mux.HandleFunc("DELETE "+path+"/{id}", handleDeleteSchedule(workflowClient, kind))
+		mux.HandleFunc("POST "+path+"/{id}/{action}", handleScheduleAction(workflowClient, kind))
+	}
+
 	server := &http.Server{
 		Addr:    Address,
 		Handler: mux,
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/microsoft/durabletask-go/api"
+)
+
+const (
+	// MaxWait is the longest a client can block on GET /workflows/{id}?wait=...
+	MaxWait = 5 * time.Minute
+
+	// MaxWaiters is the maximum number of long-polling and streaming requests that can be active at once.
+	MaxWaiters = 256
+
+	// EventsPollInterval is how often the events stream checks for progress while waiting for completion.
+	EventsPollInterval = time.Second
+)
+
+// waiters limits the number of concurrent requests that are blocked waiting on a workflow.
+type waiters chan struct{}
+
+func newWaiters(limit int) waiters {
+	return make(waiters, limit)
+}
+
+// tryAcquire reserves a slot for a waiting request. The caller must call release if this returns true.
+func (w waiters) tryAcquire() bool {
+	select {
+	case w <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w waiters) release() {
+	<-w
+}
+
+func parseWait(r *http.Request) (time.Duration, error) {
+	value := r.URL.Query().Get("wait")
+	if value == "" {
+		return 0, nil
+	}
+
+	wait, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value for wait: %w", err)
+	}
+	if wait < 0 {
+		return 0, errors.New("invalid value for wait: must not be negative")
+	}
+
+	return min(wait, MaxWait), nil
+}
+
+func writeTooManyWaiters(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "1")
+	mustWriteError(w, http.StatusServiceUnavailable, "TooManyWaiters", errors.New("too many requests are waiting on workflows, try again later"))
+}
+
+func writeFetchError(w http.ResponseWriter, err error) {
+	if errors.Is(err, api.ErrInstanceNotFound) {
+		mustWriteError(w, http.StatusNotFound, "NotFound", err)
+		return
+	}
+
+	mustWriteError(w, http.StatusInternalServerError, "Internal", err)
+}
+
+// waitForWorkflow blocks until the workflow reaches a terminal state or the timeout passes, and then returns the
+// latest metadata.
+func waitForWorkflow(ctx context.Context, client WorkflowClient, id string, timeout time.Duration) (*daprworkflow.Metadata, error) {
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	metadata, err := client.WaitForWorkflowCompletion(waitCtx, id, daprworkflow.WithFetchPayloads(true))
+	if err == nil {
+		return metadata, nil
+	} else if !errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+		return nil, err
+	}
+
+	// The wait timed out, but the caller is still listening. Return the current state.
+	return client.FetchWorkflowMetadata(ctx, id, daprworkflow.WithFetchPayloads(true))
+}
+
+// handleWorkflowEvents streams status and progress changes for a workflow as Server-Sent Events until the workflow
+// reaches a terminal state or the client disconnects.
+func handleWorkflowEvents(client WorkflowClient, waiters waiters) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			mustWriteError(w, http.StatusInternalServerError, "Internal", errors.New("streaming is not supported"))
+			return
+		}
+
+		if !waiters.tryAcquire() {
+			writeTooManyWaiters(w)
+			return
+		}
+		defer waiters.release()
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		metadata, err := client.FetchWorkflowMetadata(ctx, id, daprworkflow.WithFetchPayloads(true))
+		if err != nil {
+			writeFetchError(w, err)
+			return
+		}
+
+		slog.InfoContext(ctx, "Streaming workflow events", slog.String("id", id))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+
+		last := metadata
+		if !writeEvent(w, flusher, "status", metadata) || isTerminal(metadata.RuntimeStatus) {
+			return
+		}
+
+		type completion struct {
+			metadata *daprworkflow.Metadata
+			err      error
+		}
+		completed := make(chan completion, 1)
+		go func() {
+			metadata, err := client.WaitForWorkflowCompletion(ctx, id, daprworkflow.WithFetchPayloads(true))
+			completed <- completion{metadata: metadata, err: err}
+		}()
+
+		ticker := time.NewTicker(EventsPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				slog.InfoContext(ctx, "Client disconnected from workflow events", slog.String("id", id))
+				return
+
+			case result := <-completed:
+				if result.err != nil {
+					if ctx.Err() == nil {
+						writeEvent(w, flusher, "error", ErrorResponse{Error: ErrorDetails{Code: "Internal", Message: result.err.Error()}})
+					}
+					return
+				}
+
+				writeEvent(w, flusher, "status", result.metadata)
+				return
+
+			case <-ticker.C:
+				metadata, err := client.FetchWorkflowMetadata(ctx, id, daprworkflow.WithFetchPayloads(true))
+				if err != nil {
+					if ctx.Err() == nil {
+						slog.WarnContext(ctx, "Error polling workflow for events", slog.String("id", id), slog.Any("error", err))
+					}
+					continue
+				}
+
+				if isTerminal(metadata.RuntimeStatus) {
+					// Let the completion wait deliver the final event so it is only sent once.
+					continue
+				}
+
+				if metadata.RuntimeStatus != last.RuntimeStatus ||
+					metadata.SerializedCustomStatus != last.SerializedCustomStatus ||
+					!metadata.LastUpdatedAt.Equal(last.LastUpdatedAt) {
+					last = metadata
+					if !writeEvent(w, flusher, "status", metadata) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// writeEvent writes a single Server-Sent Event. Returns false if the client can no longer be written to.
+func writeEvent(w http.ResponseWriter, flusher http.Flusher, event string, v any) bool {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("Error serializing event", slog.String("event", event), slog.Any("error", err))
+		return false
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, bs)
+	if err != nil {
+		return false
+	}
+
+	flusher.Flush()
+	return true
+}
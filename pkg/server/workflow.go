@@ -6,4 +6,7 @@ type WorkflowRequest struct {
 	Name  string          `json:"name"`
 	Input json.RawMessage `json:"input"`
 	ID    string          `json:"id,omitempty"`
+
+	// IDReusePolicy controls what happens when ID is already in use. Defaults to DefaultIDReusePolicy.
+	IDReusePolicy IDReusePolicy `json:"idReusePolicy,omitempty"`
 }
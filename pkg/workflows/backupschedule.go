@@ -0,0 +1,221 @@
+package workflows
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/rynowak/workflow-recipe/pkg/activities"
+	"github.com/rynowak/workflow-recipe/pkg/backup"
+	"github.com/rynowak/workflow-recipe/pkg/cron"
+)
+
+var (
+	// DefaultBackupRetention is the retention policy of a backup schedule that does not specify one.
+	DefaultBackupRetention = backup.Retention{Count: 7}
+)
+
+// BackupScheduleConfig is the configuration of a backup schedule.
+type BackupScheduleConfig struct {
+	ScheduleConfig
+
+	// EnvironmentID limits the schedule to resources in an environment. Empty means every resource.
+	EnvironmentID string `json:"environmentId,omitempty"`
+	// Retention is how long scheduled backups are kept. Defaults to DefaultBackupRetention.
+	Retention *backup.Retention `json:"retention,omitempty"`
+}
+
+// validate returns an error if the configuration is invalid.
+func (c BackupScheduleConfig) validate() error {
+	_, err := cron.Parse(c.Schedule)
+	if err != nil {
+		return err
+	}
+
+	if c.Retention != nil {
+		return c.Retention.Validate()
+	}
+
+	return nil
+}
+
+// BackupScheduleInput is the state of a backup schedule. It is carried between iterations of the workflow as the
+// input to continue-as-new.
+type BackupScheduleInput struct {
+	BackupScheduleConfig
+
+	// NextRun is the time of the next scheduled run. Nil when the schedule is paused.
+	NextRun *time.Time `json:"nextRun,omitempty"`
+	// LastRun is the result of the most recent run.
+	LastRun *BackupScheduleRun `json:"lastRun,omitempty"`
+}
+
+// BackupScheduleRun is the result of taking backups.
+type BackupScheduleRun struct {
+	// Trigger is what started the run: schedule or runNow.
+	Trigger string `json:"trigger"`
+	// StartedAt is the time the run started.
+	StartedAt time.Time `json:"startedAt"`
+	// Backups are the IDs of the backups that were taken.
+	Backups []string `json:"backups"`
+	// Pruned are the IDs of the backups that were deleted by the retention policy.
+	Pruned []string `json:"pruned"`
+	// Failures describe the resources that could not be backed up or pruned.
+	Failures []string `json:"failures,omitempty"`
+}
+
+// PostgresSQLDatabasesBackupSchedule is an eternal workflow that backs up every PostgreSQL database in the inventory
+// on a cron schedule, and prunes old backups according to a retention policy.
+//
+// Each iteration waits for the next run or for a ScheduleControlEvent, handles it, and then continues as new so the
+// history does not grow without bound. A failure to back up one resource does not stop the others, or the schedule.
+// The schedule runs until it is terminated.
+func PostgresSQLDatabasesBackupSchedule(ctx *daprworkflow.WorkflowContext) (any, error) {
+	input := BackupScheduleInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default().With(slog.String("instance.id", ctx.InstanceID()))
+
+	if input.Retention == nil {
+		retention := DefaultBackupRetention
+		input.Retention = &retention
+	}
+
+	err = input.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	if input.NextRun == nil && !input.Paused {
+		input.NextRun, err = nextScheduledRun(input.Schedule, ctx.CurrentUTCDateTime())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !ctx.IsReplaying() && !input.Paused {
+		logger.Info("Waiting for next scheduled backup", slog.Time("nextRun", *input.NextRun))
+	}
+
+	command, due, err := awaitSchedule(ctx, input.ScheduleConfig, input.NextRun)
+	if err != nil {
+		return nil, err
+	} else if due {
+		input.LastRun = runBackups(ctx, input, "schedule")
+		input.NextRun = nil
+	} else {
+		if !ctx.IsReplaying() {
+			logger.Info("Received backup schedule command", slog.String("action", string(command.Action)))
+		}
+
+		switch command.Action {
+		case ScheduleActionPause:
+			input.Paused = true
+			input.NextRun = nil
+
+		case ScheduleActionResume:
+			input.Paused = false
+			input.NextRun = nil
+
+		case ScheduleActionRunNow:
+			input.LastRun = runBackups(ctx, input, "runNow")
+
+		case ScheduleActionUpdate:
+			// Ignore an invalid update rather than failing the schedule.
+			config := BackupScheduleConfig{}
+			err = json.Unmarshal(command.Config, &config)
+			if err == nil {
+				err = config.validate()
+			}
+			if err != nil {
+				logger.Warn("Ignoring invalid backup schedule update", slog.Any("error", err))
+				break
+			}
+
+			input.BackupScheduleConfig = config
+			if input.Retention == nil {
+				retention := DefaultBackupRetention
+				input.Retention = &retention
+			}
+			input.NextRun = nil
+
+		default:
+			logger.Warn("Ignoring unknown backup schedule action", slog.String("action", string(command.Action)))
+		}
+	}
+
+	if input.NextRun == nil && !input.Paused {
+		input.NextRun, err = nextScheduledRun(input.Schedule, ctx.CurrentUTCDateTime())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Keep events that arrive while continuing as new, so commands are never lost.
+	ctx.ContinueAsNew(input, true)
+	return nil, nil
+}
+
+// runBackups backs up and prunes every database covered by the schedule.
+func runBackups(ctx *daprworkflow.WorkflowContext, input BackupScheduleInput, trigger string) *BackupScheduleRun {
+	logger := slog.Default().With(slog.String("instance.id", ctx.InstanceID()))
+
+	run := &BackupScheduleRun{
+		Trigger:   trigger,
+		StartedAt: ctx.CurrentUTCDateTime(),
+		Backups:   []string{},
+		Pruned:    []string{},
+	}
+
+	if !ctx.IsReplaying() {
+		logger.Info("Taking scheduled backups", slog.String("trigger", trigger))
+	}
+
+	resources, err := activities.CallListInventoryRecords(ctx, activities.ListInventoryRecordsInput{
+		Recipe:        PostgresSQLDatabasesRecipe,
+		EnvironmentID: input.EnvironmentID,
+	})
+	if err != nil {
+		run.Failures = append(run.Failures, fmt.Sprintf("error listing resources: %v", err))
+		return run
+	}
+
+	for _, record := range resources.Records {
+		if record.Database == "" {
+			continue
+		}
+
+		created, err := activities.CallCreateBackup(ctx, activities.CreateBackupInput{
+			ResourceID: record.ID,
+			Database:   record.Database,
+			Reason:     backup.ReasonScheduled,
+			Server:     recordedPostgresSQLServer(record).id(),
+		})
+		if err != nil {
+			run.Failures = append(run.Failures, fmt.Sprintf("error backing up %q: %v", record.ID, err))
+			continue
+		}
+		run.Backups = append(run.Backups, created.Backup.ID)
+
+		pruned, err := activities.CallPruneBackups(ctx, activities.PruneBackupsInput{
+			ResourceID: record.ID,
+			Retention:  *input.Retention,
+		})
+		if err != nil {
+			run.Failures = append(run.Failures, fmt.Sprintf("error pruning backups of %q: %v", record.ID, err))
+			continue
+		}
+		run.Pruned = append(run.Pruned, pruned.Pruned...)
+	}
+
+	if !ctx.IsReplaying() {
+		logger.Info("Done taking scheduled backups", slog.Int("backups", len(run.Backups)), slog.Int("pruned", len(run.Pruned)), slog.Int("failures", len(run.Failures)))
+	}
+
+	return run
+}
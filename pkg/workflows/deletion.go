@@ -0,0 +1,150 @@
+package workflows
+
+import (
+	"fmt"
+
+	"github.com/rynowak/workflow-recipe/pkg/recipes"
+)
+
+const (
+	// LabelResourceID is the label recipes attach to what they provision, so it can be found again without the
+	// inventory.
+	LabelResourceID = "radapp.io/resource-id"
+)
+
+// MissingDataPolicy controls what Delete does when it can't determine what to delete from the inventory or the
+// resource's binding. It is set with the missingDataPolicy recipe parameter.
+type MissingDataPolicy string
+
+const (
+	// MissingDataPolicyFail fails the deletion.
+	MissingDataPolicyFail MissingDataPolicy = "fail"
+	// MissingDataPolicySkip skips the missing item and reports a warning.
+	MissingDataPolicySkip MissingDataPolicy = "skip"
+	// MissingDataPolicySearchByLabels searches for items labeled with the resource ID.
+	MissingDataPolicySearchByLabels MissingDataPolicy = "searchByLabels"
+
+	// DefaultMissingDataPolicy is used when the missingDataPolicy parameter is not set.
+	DefaultMissingDataPolicy = MissingDataPolicySkip
+)
+
+func getMissingDataPolicy(request recipes.Context) (MissingDataPolicy, error) {
+	value, ok := request.GetStringParameter("missingDataPolicy")
+	if !ok {
+		return DefaultMissingDataPolicy, nil
+	}
+
+	policy := MissingDataPolicy(value)
+	switch policy {
+	case MissingDataPolicyFail, MissingDataPolicySkip, MissingDataPolicySearchByLabels:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unsupported missingDataPolicy %q", value)
+	}
+}
+
+// DeletionPolicy controls what Delete does with what the recipe provisioned. It is set with the deletionPolicy
+// resource property, or the deletionPolicy recipe parameter.
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes everything the recipe provisioned.
+	DeletionPolicyDelete DeletionPolicy = "delete"
+	// DeletionPolicyRetainData keeps the data, and the server it is on, but revokes the credentials applications use
+	// to access it.
+	DeletionPolicyRetainData DeletionPolicy = "retain-data"
+	// DeletionPolicyAbandon leaves everything as it is, and only removes the resource from the inventory.
+	DeletionPolicyAbandon DeletionPolicy = "abandon"
+
+	// DefaultDeletionPolicy is used when the deletionPolicy is not set. It is raised to retain-data when deletion
+	// protection is enabled.
+	DefaultDeletionPolicy = DeletionPolicyDelete
+)
+
+var (
+	// AllowDataDeletion turns off deletion protection, so the delete policy drops data. It is an operator setting,
+	// because the recipe parameters and resource properties can be set by whoever deploys the resource. The
+	// deletionProtection recipe parameter turns protection back on for an environment.
+	AllowDataDeletion = false
+)
+
+// getDeletionPolicy returns the deletion policy of a resource. The resource's deletionPolicy property takes precedence
+// over the recipe parameter. Data is never deleted with a resource unless AllowDataDeletion is set: until then, the
+// delete policy is raised to retain-data, and a warning is reported if delete was asked for.
+func getDeletionPolicy(request recipes.Context, report *recipes.DeletionReport) (DeletionPolicy, error) {
+	value, ok := request.Resource.GetStringValue("/deletionPolicy")
+	if !ok {
+		value, ok = request.GetStringParameter("deletionPolicy")
+	}
+
+	policy := DefaultDeletionPolicy
+	if ok {
+		policy = DeletionPolicy(value)
+	}
+
+	switch policy {
+	case DeletionPolicyDelete, DeletionPolicyRetainData, DeletionPolicyAbandon:
+	default:
+		return "", fmt.Errorf("unsupported deletionPolicy %q", value)
+	}
+
+	// The parameter can only turn protection on, so a resource can't opt out of it.
+	protected := false
+	_, err := request.DecodeParameter("deletionProtection", &protected)
+	if err != nil {
+		return "", err
+	}
+
+	if (protected || !AllowDataDeletion) && policy == DeletionPolicyDelete {
+		policy = DeletionPolicyRetainData
+		if ok {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("the deletionPolicy is %s instead of %s, because deletion protection is enabled", DeletionPolicyRetainData, DeletionPolicyDelete))
+		}
+	}
+
+	return policy, nil
+}
+
+// resolveDeletionTarget determines the name of an item to delete, preferring the inventory over the resource's
+// binding. Returns false if neither has it.
+func resolveDeletionTarget(request recipes.Context, report *recipes.DeletionReport, kind string, fromInventory string, bindingKey string) (recipes.DeletionItem, bool) {
+	fromBinding, _ := request.Resource.GetStringValue(bindingKey)
+	if fromInventory != "" {
+		if fromBinding != "" && fromBinding != fromInventory {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("the resource's binding refers to %s %q, but the inventory refers to %q: using the inventory", kind, fromBinding, fromInventory))
+		}
+
+		return recipes.DeletionItem{Kind: kind, Name: fromInventory, Source: "inventory"}, true
+	}
+
+	if fromBinding != "" {
+		return recipes.DeletionItem{Kind: kind, Name: fromBinding, Source: "binding"}, true
+	}
+
+	return recipes.DeletionItem{}, false
+}
+
+// recipeLabels returns the labels recipes attach to what they provision.
+func recipeLabels(request recipes.Context) map[string]string {
+	return map[string]string{
+		LabelResourceID: request.Resource.ID,
+	}
+}
+
+// kubernetesNamespace returns the namespace the resource is deployed to.
+func kubernetesNamespace(request recipes.Context) string {
+	if request.Runtime.Kubernetes == nil {
+		return ""
+	}
+
+	return request.Runtime.Kubernetes.Namespace
+}
+
+// environmentNamespace returns the namespace of the resource's environment.
+func environmentNamespace(request recipes.Context) string {
+	if request.Runtime.Kubernetes == nil {
+		return ""
+	}
+
+	return request.Runtime.Kubernetes.EnvironmentNamespace
+}
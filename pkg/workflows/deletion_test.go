@@ -0,0 +1,158 @@
+package workflows
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rynowak/workflow-recipe/pkg/recipes"
+)
+
+func TestGetDeletionPolicy(t *testing.T) {
+	tests := []struct {
+		name              string
+		allowDataDeletion bool
+		properties        map[string]any
+		parameters        map[string]any
+		want              DeletionPolicy
+		wantWarning       bool
+		wantErr           string
+	}{
+		{
+			name:              "defaults to delete when data deletion is allowed",
+			allowDataDeletion: true,
+			want:              DeletionPolicyDelete,
+		},
+		{
+			// The default is raised quietly, since nobody asked for delete.
+			name: "default is raised to retain-data without data deletion",
+			want: DeletionPolicyRetainData,
+		},
+		{
+			name:        "delete is raised to retain-data without data deletion",
+			parameters:  map[string]any{"deletionPolicy": "delete"},
+			want:        DeletionPolicyRetainData,
+			wantWarning: true,
+		},
+		{
+			name:              "deletion protection raises delete",
+			allowDataDeletion: true,
+			parameters:        map[string]any{"deletionPolicy": "delete", "deletionProtection": true},
+			want:              DeletionPolicyRetainData,
+			wantWarning:       true,
+		},
+		{
+			name:        "deletion protection can't be turned off by the parameter",
+			parameters:  map[string]any{"deletionPolicy": "delete", "deletionProtection": false},
+			want:        DeletionPolicyRetainData,
+			wantWarning: true,
+		},
+		{
+			name:              "the resource property takes precedence",
+			allowDataDeletion: true,
+			properties:        map[string]any{"deletionPolicy": "abandon"},
+			parameters:        map[string]any{"deletionPolicy": "delete"},
+			want:              DeletionPolicyAbandon,
+		},
+		{
+			name:       "abandon isn't raised",
+			parameters: map[string]any{"deletionPolicy": "abandon", "deletionProtection": true},
+			want:       DeletionPolicyAbandon,
+		},
+		{
+			name:       "retain-data",
+			parameters: map[string]any{"deletionPolicy": "retain-data"},
+			want:       DeletionPolicyRetainData,
+		},
+		{
+			name:       "unsupported",
+			properties: map[string]any{"deletionPolicy": "archive"},
+			wantErr:    `unsupported deletionPolicy "archive"`,
+		},
+		{
+			name:       "invalid deletion protection",
+			parameters: map[string]any{"deletionProtection": "yes"},
+			wantErr:    `invalid value for parameter "deletionProtection"`,
+		},
+	}
+
+	original := AllowDataDeletion
+	t.Cleanup(func() { AllowDataDeletion = original })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			AllowDataDeletion = tt.allowDataDeletion
+			request := recipes.Context{
+				Resource:   recipes.Resource{Properties: tt.properties},
+				Parameters: tt.parameters,
+			}
+			report := recipes.NewDeletionReport()
+
+			got, err := getDeletionPolicy(request, &report)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if warned := len(report.Warnings) > 0; warned != tt.wantWarning {
+				t.Errorf("got warnings %v, want a warning: %v", report.Warnings, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestResolveDeletionTarget(t *testing.T) {
+	tests := []struct {
+		name          string
+		fromInventory string
+		fromBinding   string
+		want          recipes.DeletionItem
+		wantOK        bool
+		wantWarning   bool
+	}{
+		{
+			name:          "inventory",
+			fromInventory: "orders",
+			want:          recipes.DeletionItem{Kind: "database", Name: "orders", Source: "inventory"},
+			wantOK:        true,
+		},
+		{
+			name:        "binding",
+			fromBinding: "orders",
+			want:        recipes.DeletionItem{Kind: "database", Name: "orders", Source: "binding"},
+			wantOK:      true,
+		},
+		{
+			name:          "inventory wins over a different binding",
+			fromInventory: "orders",
+			fromBinding:   "orders_old",
+			want:          recipes.DeletionItem{Kind: "database", Name: "orders", Source: "inventory"},
+			wantOK:        true,
+			wantWarning:   true,
+		},
+		{
+			name: "neither",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := recipes.Context{Resource: recipes.Resource{Properties: map[string]any{"database": tt.fromBinding}}}
+			report := recipes.NewDeletionReport()
+
+			got, ok := resolveDeletionTarget(request, &report, "database", tt.fromInventory, "/database")
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("got %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+			if warned := len(report.Warnings) > 0; warned != tt.wantWarning {
+				t.Errorf("got warnings %v, want a warning: %v", report.Warnings, tt.wantWarning)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package workflows
+
+import (
+	"encoding/json"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/rynowak/workflow-recipe/pkg/inventory"
+	"github.com/rynowak/workflow-recipe/pkg/recipes"
+)
+
+// newInventoryRecord creates an inventory record for the resource in the recipe context. The caller fills in what
+// the recipe provisioned.
+func newInventoryRecord(ctx *daprworkflow.WorkflowContext, request recipes.Context, recipe string, version string) (inventory.Record, error) {
+	// The recipe context is kept so the resource can be operated on later without it, like restoring a backup
+	// after the resource has been deleted.
+	requestContext, err := json.Marshal(request)
+	if err != nil {
+		return inventory.Record{}, err
+	}
+
+	record := inventory.Record{
+		ID:            request.Resource.ID,
+		Name:          request.Resource.Name,
+		Type:          request.Resource.Type,
+		ApplicationID: request.Application.ID,
+		EnvironmentID: request.Environment.ID,
+		Recipe:        recipe,
+		RecipeVersion: version,
+		InstanceID:    ctx.InstanceID(),
+		Context:       requestContext,
+	}
+
+	record.Namespace = kubernetesNamespace(request)
+
+	return record, nil
+}
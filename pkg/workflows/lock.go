@@ -0,0 +1,96 @@
+package workflows
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/rynowak/workflow-recipe/pkg/activities"
+)
+
+var (
+	// ResourceLockQueueTimeout is how long an operation waits for another operation on the same resource to finish
+	// before failing with a ResourceConflictError. Set to zero to fail immediately instead of queueing.
+	ResourceLockQueueTimeout = 30 * time.Minute
+
+	// ResourceLockPollInterval is how often a queued operation checks whether the resource is available.
+	ResourceLockPollInterval = 10 * time.Second
+)
+
+// ResourceConflictError is returned when an operation can't run because another workflow is operating on the
+// same resource.
+type ResourceConflictError struct {
+	ResourceID string
+	InstanceID string
+	Workflow   string
+}
+
+func (e *ResourceConflictError) Error() string {
+	return fmt.Sprintf("resource %q is in use by workflow %s (instance %q): retry after it completes", e.ResourceID, e.Workflow, e.InstanceID)
+}
+
+// withResourceLock runs fn while holding the lock for a resource. Only one workflow can operate on a resource at a
+// time. Other workflows queue behind it until ResourceLockQueueTimeout passes.
+func withResourceLock(ctx *daprworkflow.WorkflowContext, resourceID string, fn func() (any, error)) (any, error) {
+	if resourceID == "" {
+		return nil, errors.New("resource id is required")
+	}
+
+	err := acquireResourceLock(ctx, resourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Don't use defer here, the workflow runtime unwinds through deferred calls while the workflow is blocked.
+	result, err := fn()
+
+	_, releaseErr := activities.CallReleaseResourceLock(ctx, activities.ReleaseResourceLockInput{
+		ResourceID: resourceID,
+		InstanceID: ctx.InstanceID(),
+	})
+	if err != nil {
+		return nil, err
+	} else if releaseErr != nil {
+		return nil, releaseErr
+	}
+
+	return result, nil
+}
+
+func acquireResourceLock(ctx *daprworkflow.WorkflowContext, resourceID string) error {
+	logger := slog.Default()
+	deadline := ctx.CurrentUTCDateTime().Add(ResourceLockQueueTimeout)
+	for {
+		lock, err := activities.CallAcquireResourceLock(ctx, activities.AcquireResourceLockInput{
+			ResourceID: resourceID,
+			InstanceID: ctx.InstanceID(),
+			Workflow:   ctx.Name(),
+		})
+		if err != nil {
+			return err
+		}
+
+		if lock.Acquired {
+			return nil
+		}
+
+		if !ctx.CurrentUTCDateTime().Before(deadline) {
+			return &ResourceConflictError{
+				ResourceID: resourceID,
+				InstanceID: lock.Holder.InstanceID,
+				Workflow:   lock.Holder.Workflow,
+			}
+		}
+
+		if !ctx.IsReplaying() {
+			logger.Info("Waiting for resource to become available", slog.String("resource.id", resourceID), slog.String("holder.id", lock.Holder.InstanceID))
+		}
+
+		err = ctx.CreateTimer(ResourceLockPollInterval).Await(nil)
+		if err != nil {
+			return err
+		}
+	}
+}
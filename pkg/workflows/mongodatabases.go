@@ -0,0 +1,278 @@
+package workflows
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/rynowak/workflow-recipe/pkg/activities"
+	"github.com/rynowak/workflow-recipe/pkg/recipes"
+)
+
+const (
+	// MongoDatabasesRecipe is the name of the MongoDB recipe in the inventory.
+	MongoDatabasesRecipe = "MongoDatabases"
+	// MongoDatabasesVersion is the version of the MongoDB recipe. Increment this when the recipe changes what it
+	// provisions.
+	MongoDatabasesVersion = "1.0.0"
+
+	// MongoImage is the image of the MongoDB server.
+	MongoImage = "mongo:7"
+	// MongoPort is the port of the MongoDB server.
+	MongoPort = 27017
+	// MongoDataPath is where the MongoDB server keeps its data.
+	MongoDataPath = "/data/db"
+)
+
+var (
+	// DefaultMongoRoles are the roles granted to the user when the roles parameter is not set.
+	DefaultMongoRoles = []string{"readWrite"}
+)
+
+func MongoDatabasesPut(ctx *daprworkflow.WorkflowContext) (any, error) {
+	request := recipes.Context{}
+	err := ctx.GetInput(&request)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default()
+	if ctx.IsReplaying() {
+		logger.Info("Resuming MongoDB database creation/update")
+	} else {
+		logger.Info("Creating/Updating MongoDB database")
+	}
+
+	return withResourceLock(ctx, request.Resource.ID, func() (any, error) {
+		return mongoDatabasesPut(ctx, request)
+	})
+}
+
+func mongoDatabasesPut(ctx *daprworkflow.WorkflowContext, request recipes.Context) (any, error) {
+	logger := slog.Default()
+
+	// Decode into a copy, so the parameter can't overwrite the defaults.
+	roles := slices.Clone(DefaultMongoRoles)
+	_, err := request.DecodeParameter("roles", &roles)
+	if err != nil {
+		return nil, err
+	}
+
+	err = activities.ValidateMongoRoles(roles)
+	if err != nil {
+		return nil, fmt.Errorf("invalid roles parameter: %w", err)
+	}
+
+	deployed, err := activities.CallDeployKubernetesResources(ctx, activities.DeployKubernetesResourcesInput{
+		Namespace:        kubernetesNamespace(request),
+		Name:             request.Resource.Name,
+		Image:            MongoImage,
+		Port:             MongoPort,
+		DataPath:         MongoDataPath,
+		Env:              map[string]string{"MONGO_INITDB_ROOT_USERNAME": "admin"},
+		AdminUsername:    "admin",
+		AdminPasswordEnv: "MONGO_INITDB_ROOT_PASSWORD",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	database, err := activities.CallCreateMongoDatabase(ctx, activities.CreateMongoDatabaseInput{
+		DatabasePrefix: request.Resource.Name,
+		Labels:         recipeLabels(request),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := activities.CallCreateMongoUser(ctx, activities.CreateMongoUserInput{
+		Database: database.Database,
+		Roles:    roles,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := newInventoryRecord(ctx, request, MongoDatabasesRecipe, MongoDatabasesVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	record.Resources = deployed.Resources
+	record.Host = deployed.Host
+	record.Port = deployed.Port
+	record.Database = database.Database
+	record.Username = credentials.Username
+	issuedAt := ctx.CurrentUTCDateTime()
+	record.CredentialsIssuedAt = &issuedAt
+	_, err = activities.CallSaveInventoryRecord(ctx, activities.SaveInventoryRecordInput{Record: record})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Done creating/updating MongoDB database")
+	return recipes.Result{
+		Values: map[string]any{
+			"host":     deployed.Host,
+			"port":     deployed.Port,
+			"database": database.Database,
+			"username": credentials.Username,
+		},
+		Secrets: map[string]any{
+			"password":         credentials.Password,
+			"connectionString": mongoConnectionString(deployed.Host, deployed.Port, credentials.Username, credentials.Password, database.Database),
+		},
+		Resources: deployed.Resources,
+	}, nil
+}
+
+// mongoConnectionString returns the connection string for a database. The user authenticates against the database
+// it was created in. The user, password, and database are percent-encoded.
+func mongoConnectionString(host string, port int, username string, password string, database string) string {
+	u := url.URL{
+		Scheme:   "mongodb",
+		User:     url.UserPassword(username, password),
+		Host:     net.JoinHostPort(host, strconv.Itoa(port)),
+		Path:     "/" + database,
+		RawQuery: url.Values{"authSource": []string{database}}.Encode(),
+	}
+	return u.String()
+}
+
+func MongoDatabasesDelete(ctx *daprworkflow.WorkflowContext) (any, error) {
+	request := recipes.Context{}
+	err := ctx.GetInput(&request)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default()
+	if ctx.IsReplaying() {
+		logger.Info("Resuming MongoDB database deletion")
+	} else {
+		logger.Info("Deleting MongoDB database")
+	}
+
+	return withResourceLock(ctx, request.Resource.ID, func() (any, error) {
+		return mongoDatabasesDelete(ctx, request)
+	})
+}
+
+func mongoDatabasesDelete(ctx *daprworkflow.WorkflowContext, request recipes.Context) (any, error) {
+	logger := slog.Default()
+
+	policy, err := getMissingDataPolicy(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Databases are backed up with mongodump before they are dropped unless the backupOnDelete parameter is false.
+	createBackup := true
+	_, err = request.DecodeParameter("backupOnDelete", &createBackup)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := activities.CallGetInventoryRecord(ctx, activities.GetInventoryRecordInput{ResourceID: request.Resource.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	report := recipes.NewDeletionReport()
+	missing := []string{}
+
+	database, ok := resolveDeletionTarget(request, &report, "database", existing.Record.Database, "/status/binding/database")
+	if !ok {
+		missing = append(missing, "database")
+	}
+
+	user, ok := resolveDeletionTarget(request, &report, "user", existing.Record.Username, "/status/binding/username")
+	if !ok {
+		missing = append(missing, "user")
+	}
+
+	if len(missing) > 0 {
+		switch policy {
+		case MissingDataPolicyFail:
+			return nil, fmt.Errorf("cannot determine the %s to delete for resource %q: not found in the inventory or the resource's binding", strings.Join(missing, " and "), request.Resource.ID)
+
+		case MissingDataPolicySearchByLabels:
+			report.Warnings = append(report.Warnings, "searching by label is not supported for MongoDB: skipping what is missing")
+		}
+
+		for _, kind := range missing {
+			report.NotFound = append(report.NotFound, recipes.DeletionItem{Kind: kind, Reason: "not found in the inventory or the resource's binding"})
+			report.Warnings = append(report.Warnings, fmt.Sprintf("no %s was found to delete: if one exists it is orphaned", kind))
+		}
+	}
+
+	// Users belong to the database they were created in, but are not dropped with it.
+	if user.Name != "" && database.Name != "" {
+		_, err = activities.CallDeleteMongoUser(ctx, activities.DeleteMongoUserInput{Database: database.Name, Username: user.Name})
+		if err != nil {
+			return nil, err
+		}
+
+		report.Removed = append(report.Removed, user)
+	} else if user.Name != "" {
+		report.NotFound = append(report.NotFound, recipes.DeletionItem{Kind: "user", Name: user.Name, Reason: "the database the user belongs to is unknown"})
+	}
+
+	if database.Name != "" {
+		deleted, err := activities.CallDeleteMongoDatabase(ctx, activities.DeleteMongoDatabaseInput{
+			Database:     database.Name,
+			CreateBackup: createBackup,
+			ResourceID:   request.Resource.ID,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		report.Removed = append(report.Removed, database)
+		if deleted.Backup != nil {
+			report.Backups = append(report.Backups, *deleted.Backup)
+		}
+	}
+
+	namespace := kubernetesNamespace(request)
+	if existing.Found && existing.Record.Namespace != "" {
+		namespace = existing.Record.Namespace
+	}
+
+	_, err = activities.CallDeleteKubernetesResources(ctx, activities.DeleteKubernetesResourcesInput{
+		Namespace: namespace,
+		Name:      request.Resource.Name,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if existing.Found && len(existing.Record.Resources) > 0 {
+		for _, id := range existing.Record.Resources {
+			report.Removed = append(report.Removed, recipes.DeletionItem{Kind: "kubernetes", Name: id, Source: "inventory"})
+		}
+	} else {
+		report.Removed = append(report.Removed, recipes.DeletionItem{Kind: "kubernetes", Name: namespace + "/" + request.Resource.Name, Source: "name"})
+	}
+
+	if existing.Found {
+		_, err = activities.CallDeleteInventoryRecord(ctx, activities.DeleteInventoryRecordInput{ResourceID: request.Resource.ID})
+		if err != nil {
+			return nil, err
+		}
+
+		report.Removed = append(report.Removed, recipes.DeletionItem{Kind: "inventory", Name: request.Resource.ID, Source: "inventory"})
+	}
+
+	for _, warning := range report.Warnings {
+		logger.Warn(warning, slog.String("resource.id", request.Resource.ID))
+	}
+
+	logger.Info("Done deleting MongoDB database")
+	return report, nil
+}
@@ -0,0 +1,254 @@
+package workflows
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/rynowak/workflow-recipe/pkg/activities"
+	"github.com/rynowak/workflow-recipe/pkg/recipes"
+)
+
+const (
+	// MySQLDatabasesRecipe is the name of the MySQL recipe in the inventory.
+	MySQLDatabasesRecipe = "MySQLDatabases"
+	// MySQLDatabasesVersion is the version of the MySQL recipe. Increment this when the recipe changes what it
+	// provisions.
+	MySQLDatabasesVersion = "1.0.0"
+
+	// MySQLImage is the image of the MySQL server.
+	MySQLImage = "mysql:8.4"
+	// MySQLPort is the port of the MySQL server.
+	MySQLPort = 3306
+	// MySQLDataPath is where the MySQL server keeps its data.
+	MySQLDataPath = "/var/lib/mysql"
+)
+
+func MySQLDatabasesPut(ctx *daprworkflow.WorkflowContext) (any, error) {
+	request := recipes.Context{}
+	err := ctx.GetInput(&request)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default()
+	if ctx.IsReplaying() {
+		logger.Info("Resuming MySQL database creation/update")
+	} else {
+		logger.Info("Creating/Updating MySQL database")
+	}
+
+	return withResourceLock(ctx, request.Resource.ID, func() (any, error) {
+		return mySQLDatabasesPut(ctx, request)
+	})
+}
+
+func mySQLDatabasesPut(ctx *daprworkflow.WorkflowContext, request recipes.Context) (any, error) {
+	logger := slog.Default()
+
+	deployed, err := activities.CallDeployKubernetesResources(ctx, activities.DeployKubernetesResourcesInput{
+		Namespace:        kubernetesNamespace(request),
+		Name:             request.Resource.Name,
+		Image:            MySQLImage,
+		Port:             MySQLPort,
+		DataPath:         MySQLDataPath,
+		AdminUsername:    "root",
+		AdminPasswordEnv: "MYSQL_ROOT_PASSWORD",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := activities.CallCreateMySQLUser(ctx, activities.CreateMySQLUserInput{
+		Labels: recipeLabels(request),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	database, err := activities.CallCreateMySQLDatabase(ctx, activities.CreateMySQLDatabaseInput{
+		Username:       credentials.Username,
+		DatabasePrefix: request.Resource.Name,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := newInventoryRecord(ctx, request, MySQLDatabasesRecipe, MySQLDatabasesVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	record.Resources = deployed.Resources
+	record.Host = deployed.Host
+	record.Port = deployed.Port
+	record.Database = database.Database
+	record.Username = credentials.Username
+	issuedAt := ctx.CurrentUTCDateTime()
+	record.CredentialsIssuedAt = &issuedAt
+	_, err = activities.CallSaveInventoryRecord(ctx, activities.SaveInventoryRecordInput{Record: record})
+	if err != nil {
+		return nil, err
+	}
+
+	// The outputs have the same shape as the PostgreSQL recipe, so the resource can switch recipes.
+	logger.Info("Done creating/updating MySQL database")
+	return recipes.Result{
+		Values: map[string]any{
+			"host":     deployed.Host,
+			"port":     deployed.Port,
+			"username": credentials.Username,
+			"database": database.Database,
+		},
+		Secrets: map[string]any{
+			"password": credentials.Password,
+			"uri":      mySQLURI(deployed.Host, deployed.Port, credentials.Username, credentials.Password, database.Database),
+		},
+		Resources: deployed.Resources,
+	}, nil
+}
+
+// mySQLURI returns the connection URI for a database. The user, password, and database are percent-encoded.
+func mySQLURI(host string, port int, username string, password string, database string) string {
+	u := url.URL{
+		Scheme: "mysql",
+		User:   url.UserPassword(username, password),
+		Host:   net.JoinHostPort(host, strconv.Itoa(port)),
+		Path:   "/" + database,
+	}
+	return u.String()
+}
+
+func MySQLDatabasesDelete(ctx *daprworkflow.WorkflowContext) (any, error) {
+	request := recipes.Context{}
+	err := ctx.GetInput(&request)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default()
+	if ctx.IsReplaying() {
+		logger.Info("Resuming MySQL database deletion")
+	} else {
+		logger.Info("Deleting MySQL database")
+	}
+
+	return withResourceLock(ctx, request.Resource.ID, func() (any, error) {
+		return mySQLDatabasesDelete(ctx, request)
+	})
+}
+
+func mySQLDatabasesDelete(ctx *daprworkflow.WorkflowContext, request recipes.Context) (any, error) {
+	logger := slog.Default()
+
+	policy, err := getMissingDataPolicy(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Databases are backed up before they are dropped unless the backupOnDelete parameter is false.
+	createBackup := true
+	_, err = request.DecodeParameter("backupOnDelete", &createBackup)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := activities.CallGetInventoryRecord(ctx, activities.GetInventoryRecordInput{ResourceID: request.Resource.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	report := recipes.NewDeletionReport()
+	missing := []string{}
+
+	database, ok := resolveDeletionTarget(request, &report, "database", existing.Record.Database, "/status/binding/database")
+	if !ok {
+		missing = append(missing, "database")
+	}
+
+	user, ok := resolveDeletionTarget(request, &report, "user", existing.Record.Username, "/status/binding/username")
+	if !ok {
+		missing = append(missing, "user")
+	}
+
+	if len(missing) > 0 {
+		switch policy {
+		case MissingDataPolicyFail:
+			return nil, fmt.Errorf("cannot determine the %s to delete for resource %q: not found in the inventory or the resource's binding", strings.Join(missing, " and "), request.Resource.ID)
+
+		case MissingDataPolicySearchByLabels:
+			report.Warnings = append(report.Warnings, "searching by label is not supported for MySQL: skipping what is missing")
+		}
+
+		for _, kind := range missing {
+			report.NotFound = append(report.NotFound, recipes.DeletionItem{Kind: kind, Reason: "not found in the inventory or the resource's binding"})
+			report.Warnings = append(report.Warnings, fmt.Sprintf("no %s was found to delete: if one exists it is orphaned", kind))
+		}
+	}
+
+	if database.Name != "" {
+		deleted, err := activities.CallDeleteMySQLDatabase(ctx, activities.DeleteMySQLDatabaseInput{
+			Database:     database.Name,
+			CreateBackup: createBackup,
+			ResourceID:   request.Resource.ID,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		report.Removed = append(report.Removed, database)
+		if deleted.Backup != nil {
+			report.Backups = append(report.Backups, *deleted.Backup)
+		}
+	}
+
+	if user.Name != "" {
+		_, err = activities.CallDeleteMySQLUser(ctx, activities.DeleteMySQLUserInput{Username: user.Name})
+		if err != nil {
+			return nil, err
+		}
+
+		report.Removed = append(report.Removed, user)
+	}
+
+	namespace := kubernetesNamespace(request)
+	if existing.Found && existing.Record.Namespace != "" {
+		namespace = existing.Record.Namespace
+	}
+
+	_, err = activities.CallDeleteKubernetesResources(ctx, activities.DeleteKubernetesResourcesInput{
+		Namespace: namespace,
+		Name:      request.Resource.Name,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if existing.Found && len(existing.Record.Resources) > 0 {
+		for _, id := range existing.Record.Resources {
+			report.Removed = append(report.Removed, recipes.DeletionItem{Kind: "kubernetes", Name: id, Source: "inventory"})
+		}
+	} else {
+		report.Removed = append(report.Removed, recipes.DeletionItem{Kind: "kubernetes", Name: namespace + "/" + request.Resource.Name, Source: "name"})
+	}
+
+	if existing.Found {
+		_, err = activities.CallDeleteInventoryRecord(ctx, activities.DeleteInventoryRecordInput{ResourceID: request.Resource.ID})
+		if err != nil {
+			return nil, err
+		}
+
+		report.Removed = append(report.Removed, recipes.DeletionItem{Kind: "inventory", Name: request.Resource.ID, Source: "inventory"})
+	}
+
+	for _, warning := range report.Warnings {
+		logger.Warn(warning, slog.String("resource.id", request.Resource.ID))
+	}
+
+	logger.Info("Done deleting MySQL database")
+	return report, nil
+}
@@ -0,0 +1,96 @@
+package workflows
+
+import (
+	"errors"
+	"fmt"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/rynowak/workflow-recipe/pkg/activities"
+	"github.com/rynowak/workflow-recipe/pkg/recipes"
+)
+
+// PostgresSQLAdoptSpec is an existing database that a resource adopts with the adopt recipe parameter, instead of
+// creating a new one. Only the users of the resource are created and deleted. The database and its server are never
+// changed, so the owner role can't be used. Ex.
+//
+//	"adopt": { "database": "orders", "server": "pg-prod-1", "username": "orders_app" }
+type PostgresSQLAdoptSpec struct {
+	// Database is the name of the existing database.
+	Database string `json:"database"`
+	// Server is the name of the server in the server pool the database is on.
+	Server string `json:"server"`
+	// Username attaches an existing user as the first user of the resource, instead of creating one. Its password is
+	// reset, so the recipe manages its credentials from then on.
+	Username string `json:"username,omitempty"`
+}
+
+// getPostgresSQLAdopt returns the database declared by the adopt parameter. Returns false if it is not set.
+func getPostgresSQLAdopt(request recipes.Context) (PostgresSQLAdoptSpec, bool, error) {
+	adopt := PostgresSQLAdoptSpec{}
+	ok, err := request.DecodeParameter("adopt", &adopt)
+	if err != nil {
+		return PostgresSQLAdoptSpec{}, false, err
+	} else if !ok {
+		return PostgresSQLAdoptSpec{}, false, nil
+	}
+
+	if adopt.Database == "" {
+		return PostgresSQLAdoptSpec{}, false, errors.New("invalid adopt parameter: database is required")
+	} else if adopt.Server == "" {
+		return PostgresSQLAdoptSpec{}, false, errors.New("invalid adopt parameter: server is required")
+	}
+
+	return adopt, true, nil
+}
+
+// getAdoptedPostgresSQLUsers returns the users to create for an adopted database. Without the users parameter a
+// single readWrite user is created, because the database already has an owner.
+func getAdoptedPostgresSQLUsers(request recipes.Context) ([]PostgresSQLUserSpec, error) {
+	if _, ok := request.Parameters["users"]; !ok {
+		return []PostgresSQLUserSpec{{Name: DefaultPostgresSQLUserName, Role: activities.PostgresRoleReadWrite}}, nil
+	}
+
+	specs, err := getPostgresSQLUsers(request)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, spec := range specs {
+		if spec.Role == activities.PostgresRoleOwner {
+			return nil, fmt.Errorf("invalid users parameter: user %q can't have the %s role, because an adopted database keeps its owner", spec.Name, activities.PostgresRoleOwner)
+		}
+	}
+
+	return specs, nil
+}
+
+// adoptedPostgresSQLUsername returns the database username for a user of an adopted database. The server is shared
+// with databases the recipe doesn't manage, so even the default user includes a hash of the resource ID.
+func adoptedPostgresSQLUsername(request recipes.Context, adopt PostgresSQLAdoptSpec, user PostgresSQLUserSpec, first bool) string {
+	if first && adopt.Username != "" {
+		return adopt.Username
+	}
+
+	return hashedPostgresSQLUsername(request, user.Name)
+}
+
+// findAdoptedPostgresSQLDatabase checks that an adopted database exists, and returns where applications connect to
+// it.
+func findAdoptedPostgresSQLDatabase(ctx *daprworkflow.WorkflowContext, adopt PostgresSQLAdoptSpec) (postgresSQLServer, activities.DeployKubernetesResourcesOutput, error) {
+	found, err := activities.CallGetPostgresDatabase(ctx, activities.GetPostgresDatabaseInput{
+		Database: adopt.Database,
+		Server:   activities.ServerRef(adopt.Server),
+	})
+	if err != nil {
+		return postgresSQLServer{}, activities.DeployKubernetesResourcesOutput{}, err
+	} else if !found.Found {
+		return postgresSQLServer{}, activities.DeployKubernetesResourcesOutput{}, fmt.Errorf("database %q does not exist on server %q", adopt.Database, adopt.Server)
+	}
+
+	// Nothing is deployed to Kubernetes for an adopted database.
+	return postgresSQLServer{mode: PostgresSQLServerModeAdopted, name: adopt.Server}, activities.DeployKubernetesResourcesOutput{
+		Host:      found.Host,
+		Port:      found.Port,
+		Resources: []string{},
+	}, nil
+}
@@ -0,0 +1,481 @@
+package workflows
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/microsoft/durabletask-go/task"
+	"github.com/rynowak/workflow-recipe/pkg/activities"
+	"github.com/rynowak/workflow-recipe/pkg/cron"
+	"github.com/rynowak/workflow-recipe/pkg/inventory"
+)
+
+var (
+	// CredentialsGracePeriod is how long the old credentials keep working after new credentials are delivered, so
+	// applications have time to pick them up.
+	CredentialsGracePeriod = time.Hour
+
+	// CredentialsMaxAgeDays is how old credentials can get before a rotation schedule rotates them. Our compliance
+	// policy requires rotation every 90 days.
+	CredentialsMaxAgeDays = 90
+
+	// DefaultCredentialRotationSchedule is how often a rotation schedule checks for credentials that are due.
+	DefaultCredentialRotationSchedule = "@daily"
+)
+
+// PostgresSQLCredentialsRotateInput is the input of PostgresSQLCredentialsRotate.
+type PostgresSQLCredentialsRotateInput struct {
+	// ResourceID is the ID of the resource whose credentials are rotated.
+	ResourceID string `json:"resourceId"`
+	// GracePeriod is how long the old credentials keep working. Ex. 30m. Defaults to CredentialsGracePeriod.
+	GracePeriod string `json:"gracePeriod,omitempty"`
+}
+
+// PostgresSQLCredentialsRotateOutput is the output of PostgresSQLCredentialsRotate.
+type PostgresSQLCredentialsRotateOutput struct {
+	ResourceID string `json:"resourceId"`
+	// Username is the user that was created.
+	Username string `json:"username"`
+	// Revoked is the user that was deleted.
+	Revoked string `json:"revoked"`
+	// Database is the database of the resource. What the revoked user owns in it is given to the new user.
+	Database string `json:"database,omitempty"`
+	// Server is the server the database is on.
+	Server activities.ServerRef `json:"server,omitempty"`
+	// IssuedAt is the time the new credentials were delivered.
+	IssuedAt time.Time `json:"issuedAt"`
+}
+
+// PostgresSQLCredentialsRotate rotates the credentials of a PostgreSQL database without downtime. It creates a
+// second user with access to the database, delivers the new credentials, waits for the grace period, and then deletes
+// the old user. The new user is a member of the old one until then, so it can use the tables the old user owns, and
+// they are given to the new user when the old user is deleted.
+//
+// The resource is only locked while the new credentials are issued, so other operations are not blocked for the
+// grace period.
+func PostgresSQLCredentialsRotate(ctx *daprworkflow.WorkflowContext) (any, error) {
+	input := PostgresSQLCredentialsRotateInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default().With(slog.String("resource.id", input.ResourceID))
+	if ctx.IsReplaying() {
+		logger.Info("Resuming PostgresSQL credential rotation")
+	} else {
+		logger.Info("Rotating PostgresSQL credentials")
+	}
+
+	gracePeriod := CredentialsGracePeriod
+	if input.GracePeriod != "" {
+		gracePeriod, err = time.ParseDuration(input.GracePeriod)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gracePeriod: %w", err)
+		} else if gracePeriod < 0 {
+			return nil, errors.New("invalid gracePeriod: must not be negative")
+		}
+	}
+
+	result, err := withResourceLock(ctx, input.ResourceID, func() (any, error) {
+		return issuePostgresSQLCredentials(ctx, input.ResourceID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	output := result.(PostgresSQLCredentialsRotateOutput)
+
+	if !ctx.IsReplaying() {
+		logger.Info("Waiting for applications to pick up new credentials", slog.Duration("gracePeriod", gracePeriod))
+	}
+
+	err = ctx.CreateTimer(gracePeriod).Await(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The old user is never the current one, so this doesn't need the lock.
+	_, err = activities.CallDeletePostgresUser(ctx, activities.DeletePostgresUserInput{
+		Username:  output.Revoked,
+		Database:  output.Database,
+		Successor: output.Username,
+		Server:    output.Server,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Done rotating PostgresSQL credentials", slog.String("username", output.Username), slog.String("revoked", output.Revoked))
+	return output, nil
+}
+
+// issuePostgresSQLCredentials creates a new user for a resource, delivers its credentials, and records it as the
+// current user in the inventory.
+func issuePostgresSQLCredentials(ctx *daprworkflow.WorkflowContext, resourceID string) (PostgresSQLCredentialsRotateOutput, error) {
+	existing, err := activities.CallGetInventoryRecord(ctx, activities.GetInventoryRecordInput{ResourceID: resourceID})
+	if err != nil {
+		return PostgresSQLCredentialsRotateOutput{}, err
+	} else if !existing.Found {
+		return PostgresSQLCredentialsRotateOutput{}, fmt.Errorf("resource %q is not in the inventory", resourceID)
+	}
+
+	record := existing.Record
+	err = checkPendingDeletion(record)
+	if err != nil {
+		return PostgresSQLCredentialsRotateOutput{}, err
+	}
+
+	if record.Recipe != PostgresSQLDatabasesRecipe {
+		return PostgresSQLCredentialsRotateOutput{}, fmt.Errorf("resource %q was provisioned by recipe %q, not %q", resourceID, record.Recipe, PostgresSQLDatabasesRecipe)
+	} else if record.Username == "" || record.Database == "" {
+		return PostgresSQLCredentialsRotateOutput{}, fmt.Errorf("resource %q does not have a user and database in the inventory", resourceID)
+	}
+
+	server := recordedPostgresSQLServer(record).id()
+	issuedAt := ctx.CurrentUTCDateTime()
+	credentials, err := activities.CallCreatePostgresUser(ctx, activities.CreatePostgresUserInput{
+		Username: rotatedUsername(record.Username, issuedAt),
+		Labels:   map[string]string{LabelResourceID: resourceID},
+		Server:   server,
+	})
+	if err != nil {
+		return PostgresSQLCredentialsRotateOutput{}, err
+	}
+
+	// The new user gets the same role as the one it replaces. Resources provisioned before roles were recorded get
+	// all privileges, like the user they have.
+	role := activities.PostgresRole("")
+	var grants []string
+	owner := ""
+	for _, user := range record.Users {
+		if user.Username == record.Username {
+			role = activities.PostgresRole(user.Role)
+			grants = user.Grants
+		}
+		if activities.PostgresRole(user.Role) == activities.PostgresRoleOwner {
+			owner = user.Username
+		}
+	}
+	if role == activities.PostgresRoleOwner {
+		owner = credentials.Username
+	}
+
+	_, err = activities.CallGrantPostgresDatabaseAccess(ctx, activities.GrantPostgresDatabaseAccessInput{
+		Database: record.Database,
+		Username: credentials.Username,
+		Role:     role,
+		Grants:   grants,
+		Owner:    owner,
+		Replaces: record.Username,
+		Server:   server,
+	})
+	if err != nil {
+		return PostgresSQLCredentialsRotateOutput{}, err
+	}
+
+	// The other users only see the tables the new owner creates once their default privileges cover it.
+	if role == activities.PostgresRoleOwner {
+		for _, user := range record.Users {
+			if user.Username == record.Username {
+				continue
+			}
+
+			_, err = activities.CallGrantPostgresDatabaseAccess(ctx, activities.GrantPostgresDatabaseAccessInput{
+				Database: record.Database,
+				Username: user.Username,
+				Role:     activities.PostgresRole(user.Role),
+				Grants:   user.Grants,
+				Owner:    owner,
+				Server:   server,
+			})
+			if err != nil {
+				return PostgresSQLCredentialsRotateOutput{}, err
+			}
+		}
+	}
+
+	connection := postgresSQLConnectionInfo{
+		Host:     record.Host,
+		Port:     record.Port,
+		Database: record.Database,
+		Username: credentials.Username,
+		Password: credentials.Password,
+	}
+	data := connection.SecretData(getRecordedPostgresSQLConnectionFormats(record.Context))
+	data["username"] = credentials.Username
+	data["password"] = credentials.Password
+	_, err = activities.CallWriteKubernetesSecret(ctx, activities.WriteKubernetesSecretInput{
+		Namespace: record.Namespace,
+		Name:      record.Name,
+		Data:      data,
+	})
+	if err != nil {
+		return PostgresSQLCredentialsRotateOutput{}, err
+	}
+
+	revoked := record.Username
+	record.Username = credentials.Username
+	for i := range record.Users {
+		if record.Users[i].Username == revoked {
+			record.Users[i].Username = credentials.Username
+		}
+	}
+	record.CredentialsIssuedAt = &issuedAt
+	record.InstanceID = ctx.InstanceID()
+	_, err = activities.CallSaveInventoryRecord(ctx, activities.SaveInventoryRecordInput{Record: record})
+	if err != nil {
+		return PostgresSQLCredentialsRotateOutput{}, err
+	}
+
+	return PostgresSQLCredentialsRotateOutput{
+		ResourceID: resourceID,
+		Username:   credentials.Username,
+		Revoked:    revoked,
+		Database:   record.Database,
+		Server:     server,
+		IssuedAt:   issuedAt,
+	}, nil
+}
+
+// rotatedUsername returns the name of the user that replaces username, with the time it is issued as a suffix. The
+// suffix of an earlier rotation is replaced, and the rest of the name, like its hash of the resource ID, is kept. Ex.
+// app_1a2b3c4d becomes app_1a2b3c4d_20240102030405.
+func rotatedUsername(username string, now time.Time) string {
+	if i := strings.LastIndex(username, "_"); i >= 0 && isRotationTimestamp(username[i+1:]) {
+		username = username[:i]
+	}
+
+	return username + "_" + now.UTC().Format(rotationTimestampLayout)
+}
+
+// rotationTimestampLayout is the layout of the suffix rotatedUsername adds.
+const rotationTimestampLayout = "20060102150405"
+
+// isRotationTimestamp returns true if suffix was added by rotatedUsername.
+func isRotationTimestamp(suffix string) bool {
+	_, err := time.Parse(rotationTimestampLayout, suffix)
+	return err == nil && len(suffix) == len(rotationTimestampLayout)
+}
+
+// CredentialRotationScheduleConfig is the configuration of a credential rotation schedule.
+type CredentialRotationScheduleConfig struct {
+	ScheduleConfig
+
+	// EnvironmentID limits the schedule to resources in an environment. Empty means every resource.
+	EnvironmentID string `json:"environmentId,omitempty"`
+	// MaxAgeDays is how old credentials can get before they are rotated. Defaults to CredentialsMaxAgeDays.
+	MaxAgeDays int `json:"maxAgeDays,omitempty"`
+	// GracePeriod is passed to PostgresSQLCredentialsRotate.
+	GracePeriod string `json:"gracePeriod,omitempty"`
+}
+
+// validate returns an error if the configuration is invalid, and fills in defaults.
+func (c *CredentialRotationScheduleConfig) validate() error {
+	if c.Schedule == "" {
+		c.Schedule = DefaultCredentialRotationSchedule
+	}
+	if c.MaxAgeDays == 0 {
+		c.MaxAgeDays = CredentialsMaxAgeDays
+	}
+
+	_, err := cron.Parse(c.Schedule)
+	if err != nil {
+		return err
+	} else if c.MaxAgeDays < 0 {
+		return errors.New("maxAgeDays must not be negative")
+	}
+
+	if c.GracePeriod != "" {
+		gracePeriod, err := time.ParseDuration(c.GracePeriod)
+		if err != nil {
+			return fmt.Errorf("invalid gracePeriod: %w", err)
+		} else if gracePeriod < 0 {
+			return errors.New("invalid gracePeriod: must not be negative")
+		}
+	}
+
+	return nil
+}
+
+// CredentialRotationScheduleInput is the state of a credential rotation schedule. It is carried between iterations
+// of the workflow as the input to continue-as-new.
+type CredentialRotationScheduleInput struct {
+	CredentialRotationScheduleConfig
+
+	// NextRun is the time of the next scheduled check. Nil when the schedule is paused.
+	NextRun *time.Time `json:"nextRun,omitempty"`
+	// LastRun is the result of the most recent check.
+	LastRun *CredentialRotationRun `json:"lastRun,omitempty"`
+}
+
+// CredentialRotationRun is the result of rotating the credentials that were due.
+type CredentialRotationRun struct {
+	// Trigger is what started the run: schedule or runNow.
+	Trigger string `json:"trigger"`
+	// StartedAt is the time the run started.
+	StartedAt time.Time `json:"startedAt"`
+	// Rotated are the IDs of the resources whose credentials were rotated.
+	Rotated []string `json:"rotated"`
+	// Failures describe the resources whose credentials could not be rotated.
+	Failures []string `json:"failures,omitempty"`
+}
+
+// PostgresSQLCredentialsRotationSchedule is an eternal workflow that rotates the credentials of every PostgreSQL
+// database in the inventory once they are older than the maximum age. It checks on a cron schedule, and is controlled
+// with ScheduleControlEvent like PostgresSQLDatabasesBackupSchedule.
+func PostgresSQLCredentialsRotationSchedule(ctx *daprworkflow.WorkflowContext) (any, error) {
+	input := CredentialRotationScheduleInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default().With(slog.String("instance.id", ctx.InstanceID()))
+
+	err = input.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	if input.NextRun == nil && !input.Paused {
+		input.NextRun, err = nextScheduledRun(input.Schedule, ctx.CurrentUTCDateTime())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !ctx.IsReplaying() && !input.Paused {
+		logger.Info("Waiting for next credential rotation check", slog.Time("nextRun", *input.NextRun))
+	}
+
+	command, due, err := awaitSchedule(ctx, input.ScheduleConfig, input.NextRun)
+	if err != nil {
+		return nil, err
+	} else if due {
+		input.LastRun = rotateDueCredentials(ctx, input, "schedule")
+		input.NextRun = nil
+	} else {
+		if !ctx.IsReplaying() {
+			logger.Info("Received credential rotation schedule command", slog.String("action", string(command.Action)))
+		}
+
+		switch command.Action {
+		case ScheduleActionPause:
+			input.Paused = true
+			input.NextRun = nil
+
+		case ScheduleActionResume:
+			input.Paused = false
+			input.NextRun = nil
+
+		case ScheduleActionRunNow:
+			input.LastRun = rotateDueCredentials(ctx, input, "runNow")
+
+		case ScheduleActionUpdate:
+			// Ignore an invalid update rather than failing the schedule.
+			config := CredentialRotationScheduleConfig{}
+			err = json.Unmarshal(command.Config, &config)
+			if err == nil {
+				err = config.validate()
+			}
+			if err != nil {
+				logger.Warn("Ignoring invalid credential rotation schedule update", slog.Any("error", err))
+				break
+			}
+
+			input.CredentialRotationScheduleConfig = config
+			input.NextRun = nil
+
+		default:
+			logger.Warn("Ignoring unknown credential rotation schedule action", slog.String("action", string(command.Action)))
+		}
+	}
+
+	if input.NextRun == nil && !input.Paused {
+		input.NextRun, err = nextScheduledRun(input.Schedule, ctx.CurrentUTCDateTime())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Keep events that arrive while continuing as new, so commands are never lost.
+	ctx.ContinueAsNew(input, true)
+	return nil, nil
+}
+
+// dueCredentials returns the records whose credentials are at least maxAgeDays old at now. Credentials that were never
+// rotated are as old as the record. Records without a user have no credentials to rotate.
+func dueCredentials(records []inventory.Record, maxAgeDays int, now time.Time) []inventory.Record {
+	due := []inventory.Record{}
+	for _, record := range records {
+		issuedAt := record.CreatedAt
+		if record.CredentialsIssuedAt != nil {
+			issuedAt = *record.CredentialsIssuedAt
+		}
+
+		if record.Username != "" && !issuedAt.AddDate(0, 0, maxAgeDays).After(now) {
+			due = append(due, record)
+		}
+	}
+
+	return due
+}
+
+// rotateDueCredentials rotates the credentials of every resource covered by the schedule whose credentials are older
+// than the maximum age. Rotations run in parallel as child workflows.
+func rotateDueCredentials(ctx *daprworkflow.WorkflowContext, input CredentialRotationScheduleInput, trigger string) *CredentialRotationRun {
+	logger := slog.Default().With(slog.String("instance.id", ctx.InstanceID()))
+
+	run := &CredentialRotationRun{
+		Trigger:   trigger,
+		StartedAt: ctx.CurrentUTCDateTime(),
+		Rotated:   []string{},
+	}
+
+	resources, err := activities.CallListInventoryRecords(ctx, activities.ListInventoryRecordsInput{
+		Recipe:        PostgresSQLDatabasesRecipe,
+		EnvironmentID: input.EnvironmentID,
+	})
+	if err != nil {
+		run.Failures = append(run.Failures, fmt.Sprintf("error listing resources: %v", err))
+		return run
+	}
+
+	due := dueCredentials(resources.Records, input.MaxAgeDays, run.StartedAt)
+
+	if !ctx.IsReplaying() {
+		logger.Info("Rotating credentials that are due", slog.String("trigger", trigger), slog.Int("due", len(due)))
+	}
+
+	// Start every rotation before waiting on any of them, so the grace periods overlap. Child instance IDs have to be
+	// unique across iterations of the schedule.
+	tasks := make([]task.Task, len(due))
+	for i, record := range due {
+		tasks[i] = ctx.CallChildWorkflow(PostgresSQLCredentialsRotate,
+			daprworkflow.ChildWorkflowInput(PostgresSQLCredentialsRotateInput{
+				ResourceID:  record.ID,
+				GracePeriod: input.GracePeriod,
+			}),
+			daprworkflow.ChildWorkflowInstanceID(fmt.Sprintf("%s-%s-%s-%d", ctx.InstanceID(), trigger, run.StartedAt.Format("20060102T150405"), i)))
+	}
+
+	for i, rotation := range tasks {
+		err := rotation.Await(nil)
+		if err != nil {
+			run.Failures = append(run.Failures, fmt.Sprintf("error rotating credentials of %q: %v", due[i].ID, err))
+			continue
+		}
+		run.Rotated = append(run.Rotated, due[i].ID)
+	}
+
+	if !ctx.IsReplaying() {
+		logger.Info("Done rotating credentials", slog.Int("rotated", len(run.Rotated)), slog.Int("failures", len(run.Failures)))
+	}
+
+	return run
+}
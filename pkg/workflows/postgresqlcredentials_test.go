@@ -0,0 +1,184 @@
+package workflows
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rynowak/workflow-recipe/pkg/inventory"
+)
+
+func TestRotatedUsername(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		username string
+		want     string
+	}{
+		{
+			name:     "first rotation keeps the hash",
+			username: "app_1a2b3c4d",
+			want:     "app_1a2b3c4d_20240102030405",
+		},
+		{
+			name:     "later rotations replace the timestamp",
+			username: "app_1a2b3c4d_20231201000000",
+			want:     "app_1a2b3c4d_20240102030405",
+		},
+		{
+			name:     "a suffix that isn't a timestamp is kept",
+			username: "app_2024",
+			want:     "app_2024_20240102030405",
+		},
+		{
+			name:     "no suffix",
+			username: "app",
+			want:     "app_20240102030405",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rotatedUsername(tt.username, now)
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotatedUsername_UsesUTC(t *testing.T) {
+	now := time.Date(2024, 1, 2, 5, 4, 5, 0, time.FixedZone("UTC+2", 2*60*60))
+
+	got := rotatedUsername("app", now)
+	if got != "app_20240102030405" {
+		t.Errorf("got %q, want app_20240102030405", got)
+	}
+}
+
+func TestIsRotationTimestamp(t *testing.T) {
+	tests := []struct {
+		suffix string
+		want   bool
+	}{
+		{suffix: "20240102030405", want: true},
+		{suffix: "2024010203040", want: false},
+		{suffix: "202401020304050", want: false},
+		{suffix: "20241302030405", want: false},
+		{suffix: "1a2b3c4d", want: false},
+		{suffix: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.suffix, func(t *testing.T) {
+			got := isRotationTimestamp(tt.suffix)
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCredentialRotationScheduleConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  CredentialRotationScheduleConfig
+		want    CredentialRotationScheduleConfig
+		wantErr string
+	}{
+		{
+			name:   "defaults",
+			config: CredentialRotationScheduleConfig{},
+			want: CredentialRotationScheduleConfig{
+				ScheduleConfig: ScheduleConfig{Schedule: DefaultCredentialRotationSchedule},
+				MaxAgeDays:     CredentialsMaxAgeDays,
+			},
+		},
+		{
+			name: "explicit values are kept",
+			config: CredentialRotationScheduleConfig{
+				ScheduleConfig: ScheduleConfig{Schedule: "0 2 * * 0"},
+				MaxAgeDays:     30,
+				GracePeriod:    "1h",
+			},
+			want: CredentialRotationScheduleConfig{
+				ScheduleConfig: ScheduleConfig{Schedule: "0 2 * * 0"},
+				MaxAgeDays:     30,
+				GracePeriod:    "1h",
+			},
+		},
+		{
+			name:    "invalid schedule",
+			config:  CredentialRotationScheduleConfig{ScheduleConfig: ScheduleConfig{Schedule: "* * *"}},
+			wantErr: "expected 5 fields",
+		},
+		{
+			name:    "negative max age",
+			config:  CredentialRotationScheduleConfig{MaxAgeDays: -1},
+			wantErr: "maxAgeDays must not be negative",
+		},
+		{
+			name:    "invalid grace period",
+			config:  CredentialRotationScheduleConfig{GracePeriod: "soon"},
+			wantErr: "invalid gracePeriod",
+		},
+		{
+			name:    "negative grace period",
+			config:  CredentialRotationScheduleConfig{GracePeriod: "-5m"},
+			wantErr: "invalid gracePeriod: must not be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			err := config.validate()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if config != tt.want {
+				t.Errorf("got %+v, want %+v", config, tt.want)
+			}
+		})
+	}
+}
+
+func TestDueCredentials(t *testing.T) {
+	now := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) time.Time {
+		return now.AddDate(0, 0, -days)
+	}
+	issued := func(days int) *time.Time {
+		issuedAt := daysAgo(days)
+		return &issuedAt
+	}
+
+	records := []inventory.Record{
+		// Never rotated, so the credentials are as old as the record.
+		{ID: "never-rotated-old", Username: "a", CreatedAt: daysAgo(100)},
+		{ID: "never-rotated-new", Username: "b", CreatedAt: daysAgo(10)},
+		// The rotation is what counts, not when the record was created.
+		{ID: "rotated-recently", Username: "c", CreatedAt: daysAgo(100), CredentialsIssuedAt: issued(10)},
+		{ID: "rotated-long-ago", Username: "d", CreatedAt: daysAgo(200), CredentialsIssuedAt: issued(95)},
+		{ID: "exactly-max-age", Username: "e", CreatedAt: daysAgo(90)},
+		{ID: "no-user", CreatedAt: daysAgo(100)},
+	}
+
+	got := []string{}
+	for _, record := range dueCredentials(records, 90, now) {
+		got = append(got, record.ID)
+	}
+
+	want := []string{"never-rotated-old", "rotated-long-ago", "exactly-max-age"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
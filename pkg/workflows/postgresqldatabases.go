@@ -1,14 +1,26 @@
 package workflows
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
 
 	daprworkflow "github.com/dapr/go-sdk/workflow"
 	"github.com/rynowak/workflow-recipe/pkg/activities"
+	"github.com/rynowak/workflow-recipe/pkg/inventory"
 	"github.com/rynowak/workflow-recipe/pkg/recipes"
 )
 
+const (
+	// PostgresSQLDatabasesRecipe is the name of the PostgreSQL recipe in the inventory.
+	PostgresSQLDatabasesRecipe = "PostgresSQLDatabases"
+	// PostgresSQLDatabasesVersion is the version of the PostgreSQL recipe. Increment this when the recipe changes what
+	// it provisions.
+	PostgresSQLDatabasesVersion = "1.0.0"
+)
+
 func PostgresSQLDatabasesPut(ctx *daprworkflow.WorkflowContext) (any, error) {
 	request := recipes.Context{}
 	err := ctx.GetInput(&request)
@@ -23,45 +35,315 @@ func PostgresSQLDatabasesPut(ctx *daprworkflow.WorkflowContext) (any, error) {
 		logger.Info("Creating/Updating PostgresSQL database")
 	}
 
-	deployed, err := activities.CallDeployKubernetesResources(ctx, activities.DeployKubernetesResourcesInput{
-		Namespace: request.Runtime.Kubernetes.Namespace,
-		Name:      request.Resource.Name,
+	return withResourceLock(ctx, request.Resource.ID, func() (any, error) {
+		return postgresSQLDatabasesPut(ctx, request)
 	})
+}
+
+func postgresSQLDatabasesPut(ctx *daprworkflow.WorkflowContext, request recipes.Context) (any, error) {
+	logger := slog.Default()
+
+	provisioned, err := provisionPostgresSQLDatabase(ctx, request, postgresSQLProvisionOptions{applySchema: true})
 	if err != nil {
 		return nil, err
 	}
 
-	credentials, err := activities.CallCreatePostgresUser(ctx, activities.CreatePostgresUserInput{})
+	err = verifyPostgresSQLDatabase(ctx, request, provisioned)
 	if err != nil {
 		return nil, err
 	}
 
-	database, err := activities.CallCreatePostgresDatabase(ctx, activities.CreatePostgresDatabaseInput{
-		Username:       credentials.Username,
-		Password:       credentials.Password,
-		DatabasePrefix: request.Resource.Name,
-	})
+	err = savePostgresSQLDatabase(ctx, request, provisioned)
 	if err != nil {
 		return nil, err
 	}
 
-	// Return data to Radius
-	result := recipes.Result{
+	logger.Info("Done creating/updating PostgresSQL database")
+	return provisioned.result(), nil
+}
+
+// postgresSQLDatabase is what the recipe provisions for a resource.
+type postgresSQLDatabase struct {
+	server   postgresSQLServer
+	deployed activities.DeployKubernetesResourcesOutput
+	// credentials are the credentials of the primary user: the owner, or the first user if there is no owner.
+	credentials activities.CreatePostgresUserOutput
+	users       []postgresSQLUser
+	database    activities.CreatePostgresDatabaseOutput
+	// formats are the connection string formats returned in the secrets.
+	formats []PostgresSQLConnectionFormat
+}
+
+// postgresSQLProvisionOptions changes what provisionPostgresSQLDatabase does for the database.
+type postgresSQLProvisionOptions struct {
+	// applySchema applies the extensions and migrations from the recipe parameters to the database.
+	applySchema bool
+	// newDatabase creates a new database even if the resource already has one, so it can be swapped in later.
+	newDatabase bool
+}
+
+// postgresSQLUser is a user that was created for the database.
+type postgresSQLUser struct {
+	spec        PostgresSQLUserSpec
+	credentials activities.CreatePostgresUserOutput
+}
+
+// provisionPostgresSQLDatabase deploys the server, and creates the users and database for the resource. A resource
+// that already has a database keeps it, unless options asks for a new one.
+//
+// A resource with the adopt parameter gets users for its existing database instead, and nothing else is created.
+func provisionPostgresSQLDatabase(ctx *daprworkflow.WorkflowContext, request recipes.Context, options postgresSQLProvisionOptions) (postgresSQLDatabase, error) {
+	adopt, adopting, err := getPostgresSQLAdopt(request)
+	if err != nil {
+		return postgresSQLDatabase{}, err
+	}
+
+	specs, err := getPostgresSQLUsers(request)
+	if adopting {
+		specs, err = getAdoptedPostgresSQLUsers(request)
+	}
+	if err != nil {
+		return postgresSQLDatabase{}, err
+	}
+
+	schema, err := getPostgresSQLSchema(request)
+	if err != nil {
+		return postgresSQLDatabase{}, err
+	} else if adopting && (len(schema.Extensions) > 0 || len(schema.Migrations) > 0) {
+		return postgresSQLDatabase{}, errors.New("the extensions and migrations parameters can't be used with the adopt parameter, because an adopted database is never changed")
+	}
+
+	formats, err := getPostgresSQLConnectionFormats(request)
+	if err != nil {
+		return postgresSQLDatabase{}, err
+	}
+
+	mode, err := getPostgresSQLServerMode(request)
+	if err != nil {
+		return postgresSQLDatabase{}, err
+	}
+
+	// Moving a resource to another server would leave its data behind on the old one.
+	existing, err := activities.CallGetInventoryRecord(ctx, activities.GetInventoryRecordInput{ResourceID: request.Resource.ID})
+	if err != nil {
+		return postgresSQLDatabase{}, err
+	} else if recorded := recordedPostgresSQLServer(existing.Record); existing.Found && recorded.mode != mode {
+		return postgresSQLDatabase{}, fmt.Errorf("the serverMode of resource %q can't be changed from %q to %q: delete the resource and create it again", request.Resource.ID, recorded.mode, mode)
+	}
+
+	err = checkPendingDeletion(existing.Record)
+	if err != nil {
+		return postgresSQLDatabase{}, err
+	}
+
+	if adopting && existing.Found && (existing.Record.Database != adopt.Database || existing.Record.Server != adopt.Server) {
+		return postgresSQLDatabase{}, fmt.Errorf("resource %q adopted database %q on server %q, and can't adopt a different one: delete the resource and create it again", request.Resource.ID, existing.Record.Database, existing.Record.Server)
+	}
+
+	var server postgresSQLServer
+	var deployed activities.DeployKubernetesResourcesOutput
+	if adopting {
+		server, deployed, err = findAdoptedPostgresSQLDatabase(ctx, adopt)
+	} else {
+		server, deployed, err = deployPostgresSQLServer(ctx, request, mode)
+	}
+	if err != nil {
+		return postgresSQLDatabase{}, err
+	}
+
+	users := []postgresSQLUser{}
+	primary := 0
+	for i, spec := range specs {
+		username := postgresSQLUsername(request, server.mode, spec)
+		if adopting {
+			username = adoptedPostgresSQLUsername(request, adopt, spec, i == 0)
+		}
+		if recorded, ok := recordedPostgresSQLUsername(existing.Record, spec, i == 0); ok {
+			username = recorded
+		}
+
+		credentials, err := activities.CallCreatePostgresUser(ctx, activities.CreatePostgresUserInput{
+			Username: username,
+			Labels:   recipeLabels(request),
+			Server:   server.id(),
+		})
+		if err != nil {
+			return postgresSQLDatabase{}, err
+		}
+
+		users = append(users, postgresSQLUser{spec: spec, credentials: credentials})
+		if spec.Role == activities.PostgresRoleOwner {
+			primary = i
+		}
+	}
+
+	// The database is created for the owner. Without an owner it belongs to the server admin.
+	owner := activities.CreatePostgresUserOutput{}
+	if users[primary].spec.Role == activities.PostgresRoleOwner {
+		owner = users[primary].credentials
+	}
+
+	// A Put of a resource that exists keeps its database, unless it moved to a different server.
+	recorded := ""
+	if existing.Found && !options.newDatabase && recordedPostgresSQLServer(existing.Record).id() == server.id() {
+		recorded = existing.Record.Database
+	}
+
+	database := activities.CreatePostgresDatabaseOutput{Database: adopt.Database}
+	if !adopting {
+		database, err = activities.CallCreatePostgresDatabase(ctx, activities.CreatePostgresDatabaseInput{
+			Username:       owner.Username,
+			Password:       owner.Password,
+			DatabasePrefix: request.Resource.Name,
+			Labels:         recipeLabels(request),
+			Database:       recorded,
+			Server:         server.id(),
+		})
+		if err != nil {
+			return postgresSQLDatabase{}, err
+		}
+	}
+
+	// Apply the schema before granting access, so the grants cover the tables the migrations create.
+	if options.applySchema && !adopting {
+		err = applyPostgresSQLSchema(ctx, request, server, database.Database, owner.Username, schema)
+		if err != nil {
+			return postgresSQLDatabase{}, err
+		}
+	}
+
+	for _, user := range users {
+		_, err = activities.CallGrantPostgresDatabaseAccess(ctx, activities.GrantPostgresDatabaseAccessInput{
+			Database: database.Database,
+			Username: user.credentials.Username,
+			Role:     user.spec.Role,
+			Grants:   user.spec.Grants,
+			Owner:    owner.Username,
+			Server:   server.id(),
+		})
+		if err != nil {
+			return postgresSQLDatabase{}, err
+		}
+	}
+
+	return postgresSQLDatabase{
+		server:      server,
+		deployed:    deployed,
+		credentials: users[primary].credentials,
+		users:       users,
+		database:    database,
+		formats:     formats,
+	}, nil
+}
+
+// applyPostgresSQLSchema enables the extensions and applies the migrations of a schema. Migrations run as the owner,
+// so the owner can change the objects they create.
+func applyPostgresSQLSchema(ctx *daprworkflow.WorkflowContext, request recipes.Context, server postgresSQLServer, database string, owner string, schema PostgresSQLSchemaSpec) error {
+	logger := slog.Default()
+
+	if len(schema.Extensions) > 0 {
+		_, err := activities.CallEnablePostgresExtensions(ctx, activities.EnablePostgresExtensionsInput{
+			Database:   database,
+			Extensions: schema.Extensions,
+			Server:     server.id(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(schema.Migrations) > 0 {
+		migrated, err := activities.CallApplyPostgresMigrations(ctx, activities.ApplyPostgresMigrationsInput{
+			Database:   database,
+			Namespace:  kubernetesNamespace(request),
+			Username:   owner,
+			Migrations: schema.Migrations,
+			Server:     server.id(),
+		})
+		if err != nil {
+			return err
+		}
+
+		if !ctx.IsReplaying() {
+			logger.Info("Applied migrations", slog.String("database", database), slog.Any("applied", migrated.Applied), slog.Any("skipped", migrated.Skipped))
+		}
+	}
+
+	return nil
+}
+
+// savePostgresSQLDatabase records what was provisioned in the inventory.
+func savePostgresSQLDatabase(ctx *daprworkflow.WorkflowContext, request recipes.Context, provisioned postgresSQLDatabase) error {
+	record, err := newInventoryRecord(ctx, request, PostgresSQLDatabasesRecipe, PostgresSQLDatabasesVersion)
+	if err != nil {
+		return err
+	}
+
+	record.Resources = provisioned.deployed.Resources
+	record.Host = provisioned.deployed.Host
+	record.Port = provisioned.deployed.Port
+	provisioned.server.record(&record)
+	record.Database = provisioned.database.Database
+	record.Username = provisioned.credentials.Username
+	for _, user := range provisioned.users {
+		record.Users = append(record.Users, inventory.User{
+			Name:     user.spec.Name,
+			Username: user.credentials.Username,
+			Role:     string(user.spec.Role),
+			Grants:   user.spec.Grants,
+		})
+	}
+	issuedAt := ctx.CurrentUTCDateTime()
+	record.CredentialsIssuedAt = &issuedAt
+	_, err = activities.CallSaveInventoryRecord(ctx, activities.SaveInventoryRecordInput{Record: record})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// result returns the data to return to Radius. The primary user is returned at the top level, and every user is
+// returned under users, keyed by name.
+func (p postgresSQLDatabase) result() recipes.Result {
+	users := map[string]any{}
+	secrets := map[string]any{}
+	for _, user := range p.users {
+		users[user.spec.Name] = map[string]any{
+			"username": user.credentials.Username,
+			"role":     string(user.spec.Role),
+		}
+		userSecrets := p.connection(user.credentials).Secrets(p.formats)
+		userSecrets["password"] = user.credentials.Password
+		secrets[user.spec.Name] = userSecrets
+	}
+
+	primary := p.connection(p.credentials).Secrets(p.formats)
+	primary["password"] = p.credentials.Password
+	primary["users"] = secrets
+
+	return recipes.Result{
 		Values: map[string]any{
-			"host":     deployed.Host,
-			"port":     deployed.Port,
-			"username": credentials.Username,
-			"database": database.Database,
-		},
-		Secrets: map[string]any{
-			"password": credentials.Password,
-			"uri":      fmt.Sprintf("postgresql://%s:%s@%s:%d/%s", credentials.Username, credentials.Password, deployed.Host, deployed.Port, database.Database),
+			"host":     p.deployed.Host,
+			"port":     p.deployed.Port,
+			"username": p.credentials.Username,
+			"database": p.database.Database,
+			"users":    users,
 		},
-		Resources: deployed.Resources,
+		Secrets:   primary,
+		Resources: p.deployed.Resources,
 	}
+}
 
-	logger.Info("Done creating/updating PostgresSQL database")
-	return result, nil
+// connection returns the connection info for a user of the database.
+func (p postgresSQLDatabase) connection(credentials activities.CreatePostgresUserOutput) postgresSQLConnectionInfo {
+	return postgresSQLConnectionInfo{
+		Host:     p.deployed.Host,
+		Port:     p.deployed.Port,
+		Database: p.database.Database,
+		Username: credentials.Username,
+		Password: credentials.Password,
+	}
 }
 
 func PostgresSQLDatabasesDelete(ctx *daprworkflow.WorkflowContext) (any, error) {
@@ -78,35 +360,401 @@ func PostgresSQLDatabasesDelete(ctx *daprworkflow.WorkflowContext) (any, error)
 		logger.Info("Deleting PostgresSQL database")
 	}
 
-	database, ok := request.Resource.GetStringValue("/status/binding/database")
-	if !ok {
-		_, err = activities.CallDeletePostgresDatabase(ctx, activities.DeletePostgresDatabaseInput{
-			Database:     database,
+	// Only the delete policy drops anything, so it's the only one that needs a recovery window.
+	deletionPolicy, err := getDeletionPolicy(request, &recipes.DeletionReport{})
+	if err != nil {
+		return nil, err
+	}
+
+	window, err := getRecoveryWindow(request)
+	if err != nil {
+		return nil, err
+	} else if window > 0 && deletionPolicy == DeletionPolicyDelete {
+		return softDeletePostgresSQLDatabase(ctx, request, window)
+	}
+
+	return withResourceLock(ctx, request.Resource.ID, func() (any, error) {
+		return postgresSQLDatabasesDelete(ctx, request)
+	})
+}
+
+func postgresSQLDatabasesDelete(ctx *daprworkflow.WorkflowContext, request recipes.Context) (any, error) {
+	logger := slog.Default()
+
+	policy, err := getMissingDataPolicy(request)
+	if err != nil {
+		return nil, err
+	}
+
+	report := recipes.NewDeletionReport()
+	deletionPolicy, err := getDeletionPolicy(request, &report)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Policy = string(deletionPolicy)
+	if !ctx.IsReplaying() {
+		logger.Info("Applying deletion policy", slog.String("policy", report.Policy))
+	}
+
+	// The inventory is the source of truth for what was provisioned. Fall back to the binding for resources that were
+	// provisioned before the inventory existed.
+	existing, err := activities.CallGetInventoryRecord(ctx, activities.GetInventoryRecordInput{ResourceID: request.Resource.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	if deletionPolicy == DeletionPolicyAbandon {
+		return abandonPostgresSQLDatabase(ctx, request, existing, report)
+	}
+
+	// The server is recorded in the inventory. Without a record, the serverMode parameter says where it would be.
+	server := recordedPostgresSQLServer(existing.Record)
+	if !existing.Found {
+		server.mode, err = getPostgresSQLServerMode(request)
+		if err != nil {
+			return nil, err
+		}
+
+		if server.mode == PostgresSQLServerModeDedicated {
+			server.namespace = kubernetesNamespace(request)
+			server.name = request.Resource.Name
+		} else if server.mode == PostgresSQLServerModeShared {
+			server.namespace = environmentNamespace(request)
+			server.name = SharedPostgresSQLServerName
+		} else if server.mode == PostgresSQLServerModeAdopted {
+			adopt, _, err := getPostgresSQLAdopt(request)
+			if err != nil {
+				return nil, err
+			}
+			server.name = adopt.Server
+		}
+	}
+
+	if server.mode == PostgresSQLServerModePool && server.name == "" {
+		placement, err := activities.CallGetPostgresDatabasePlacement(ctx, activities.GetPostgresDatabasePlacementInput{ResourceID: request.Resource.ID})
+		if err != nil {
+			return nil, err
+		} else if !placement.Found {
+			return nil, fmt.Errorf("cannot determine the server in the pool the database of resource %q is on", request.Resource.ID)
+		}
+
+		server.name = placement.Server
+	}
+
+	databases := []recipes.DeletionItem{}
+	users := []recipes.DeletionItem{}
+	missing := []string{}
+
+	if item, ok := resolveDeletionTarget(request, &report, "database", existing.Record.Database, "/status/binding/database"); ok {
+		databases = append(databases, item)
+	} else {
+		missing = append(missing, "database")
+	}
+
+	if item, ok := resolveDeletionTarget(request, &report, "user", existing.Record.Username, "/status/binding/username"); ok {
+		users = append(users, item)
+	} else {
+		missing = append(missing, "user")
+	}
+
+	// Users declared with the users parameter are only in the inventory.
+	if existing.Found {
+		for _, user := range existing.Record.Users {
+			if user.Username != "" && !slices.ContainsFunc(users, func(item recipes.DeletionItem) bool { return item.Name == user.Username }) {
+				users = append(users, recipes.DeletionItem{Kind: "user", Name: user.Username, Source: "inventory"})
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		switch policy {
+		case MissingDataPolicyFail:
+			return nil, fmt.Errorf("cannot determine the %s to delete for resource %q: not found in the inventory or the resource's binding", strings.Join(missing, " and "), request.Resource.ID)
+
+		case MissingDataPolicySearchByLabels:
+			found, err := activities.CallFindPostgresResources(ctx, activities.FindPostgresResourcesInput{
+				Labels: recipeLabels(request),
+				Server: server.id(),
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			if slices.Contains(missing, "database") {
+				for _, name := range found.Databases {
+					databases = append(databases, recipes.DeletionItem{Kind: "database", Name: name, Source: "labels"})
+				}
+			}
+			if slices.Contains(missing, "user") {
+				for _, name := range found.Users {
+					users = append(users, recipes.DeletionItem{Kind: "user", Name: name, Source: "labels"})
+				}
+			}
+		}
+
+		// Anything still missing is skipped, but reported so orphans can be cleaned up.
+		if len(databases) == 0 {
+			report.NotFound = append(report.NotFound, recipes.DeletionItem{Kind: "database", Reason: "not found in the inventory, the resource's binding, or by label"})
+			report.Warnings = append(report.Warnings, "no database was found to delete: if one exists it is orphaned")
+		}
+		if len(users) == 0 {
+			report.NotFound = append(report.NotFound, recipes.DeletionItem{Kind: "user", Reason: "not found in the inventory, the resource's binding, or by label"})
+			report.Warnings = append(report.Warnings, "no user was found to delete: if one exists it is orphaned")
+		}
+	}
+
+	// An adopted database, and a user that was attached to it, existed before the resource, so only the users the
+	// recipe created are deleted.
+	kept := ""
+	if server.mode == PostgresSQLServerModeAdopted {
+		adopt, _, err := getPostgresSQLAdopt(request)
+		if err != nil {
+			return nil, err
+		}
+
+		kept = adopt.Database
+		if existing.Found {
+			kept = existing.Record.Database
+		}
+
+		for _, database := range databases {
+			database.Reason = "the database was adopted, so it is not deleted with the resource"
+			report.Retained = append(report.Retained, database)
+		}
+		databases = nil
+
+		users = slices.DeleteFunc(users, func(user recipes.DeletionItem) bool {
+			if adopt.Username == "" || user.Name != adopt.Username {
+				return false
+			}
+
+			user.Reason = "the user was attached to the adopted database, so it is not deleted with the resource"
+			report.Retained = append(report.Retained, user)
+			return true
+		})
+
+		// Soft delete revoked the login of the attached user with the others, but it is kept, so it can log in again.
+		if adopt.Username != "" && existing.Record.PendingDeletion != nil {
+			_, err = activities.CallRestorePostgresUserLogin(ctx, activities.RestorePostgresUserLoginInput{
+				Username: adopt.Username,
+				Server:   server.id(),
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Outstanding leases end with the resource, whatever happens to its data. Their privileges are dropped from the
+	// database first, in case it is kept.
+	leaseDatabase := existing.Record.Database
+	if leaseDatabase == "" && len(databases) > 0 {
+		leaseDatabase = databases[0].Name
+	} else if leaseDatabase == "" {
+		leaseDatabase = kept
+	}
+
+	exclude := recordedPostgresSQLUsernames(existing.Record)
+	for _, user := range users {
+		exclude = append(exclude, user.Name)
+	}
+
+	leases, err := dropPostgresSQLLeaseUsers(ctx, request.Resource.ID, server.id(), leaseDatabase, exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, username := range leases {
+		report.Removed = append(report.Removed, recipes.DeletionItem{Kind: "user", Name: username, Source: "labels"})
+	}
+
+	// retain-data keeps the database, and the server it is on, but applications can't log in to it anymore.
+	if deletionPolicy == DeletionPolicyRetainData {
+		for _, database := range databases {
+			database.Reason = "the deletionPolicy is " + report.Policy
+			report.Retained = append(report.Retained, database)
+		}
+		databases = nil
+
+		for _, user := range users {
+			_, err := activities.CallRevokePostgresUserLogin(ctx, activities.RevokePostgresUserLoginInput{
+				Username: user.Name,
+				Server:   server.id(),
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			user.Reason = "the user can't log in anymore, but is kept with the data, because the deletionPolicy is " + report.Policy
+			report.Retained = append(report.Retained, user)
+		}
+		users = nil
+	}
+
+	for _, database := range databases {
+		deleted, err := activities.CallDeletePostgresDatabase(ctx, activities.DeletePostgresDatabaseInput{
+			Database:     database.Name,
 			CreateBackup: true,
+			ResourceID:   request.Resource.ID,
+			Server:       server.id(),
 		})
 		if err != nil {
 			return nil, err
 		}
+
+		report.Removed = append(report.Removed, database)
+		if deleted.Backup != nil {
+			report.Backups = append(report.Backups, *deleted.Backup)
+		}
 	}
 
-	username, ok := request.Resource.GetStringValue("/status/binding/username")
-	if !ok {
-		_, err = activities.CallDeletePostgresUser(ctx, activities.DeletePostgresUserInput{
-			Username: username,
+	for _, user := range users {
+		_, err := activities.CallDeletePostgresUser(ctx, activities.DeletePostgresUserInput{
+			Username: user.Name,
+			Database: kept,
+			Server:   server.id(),
 		})
 		if err != nil {
 			return nil, err
 		}
+
+		report.Removed = append(report.Removed, user)
 	}
 
-	_, err = activities.CallDeleteKubernetesResources(ctx, activities.DeleteKubernetesResourcesInput{
-		Namespace: request.Runtime.Kubernetes.Namespace,
-		Name:      request.Resource.Name,
-	})
-	if err != nil {
-		return nil, err
+	if deletionPolicy == DeletionPolicyRetainData {
+		report.Retained = append(report.Retained, retainedPostgresSQLServer(request, existing, server, "the server holds the retained data")...)
+	} else if server.mode == PostgresSQLServerModePool {
+		released, err := activities.CallReleasePostgresDatabasePlacement(ctx, activities.ReleasePostgresDatabasePlacementInput{
+			Server:     server.name,
+			ResourceID: request.Resource.ID,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if released.Found {
+			report.Removed = append(report.Removed, recipes.DeletionItem{Kind: "placement", Name: server.name, Source: "inventory"})
+		}
+	} else if server.mode == PostgresSQLServerModeAdopted {
+		// Nothing was deployed or placed for an adopted database.
+	} else if server.mode == PostgresSQLServerModeShared {
+		if server.namespace == "" {
+			report.NotFound = append(report.NotFound, recipes.DeletionItem{Kind: "kubernetes", Name: server.name, Reason: "the environment's Kubernetes namespace is unknown"})
+			report.Warnings = append(report.Warnings, "the shared server was not released because the environment's Kubernetes namespace is unknown")
+		} else {
+			released, err := releaseSharedPostgresSQLServer(ctx, request.Resource.ID, server)
+			if err != nil {
+				return nil, err
+			}
+
+			reportSharedPostgresSQLServerRelease(&report, server, released)
+		}
+	} else {
+		namespace := kubernetesNamespace(request)
+		if existing.Found && existing.Record.Namespace != "" {
+			namespace = existing.Record.Namespace
+		}
+
+		_, err = activities.CallDeleteKubernetesResources(ctx, activities.DeleteKubernetesResourcesInput{
+			Namespace: namespace,
+			Name:      request.Resource.Name,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if existing.Found && len(existing.Record.Resources) > 0 {
+			for _, id := range existing.Record.Resources {
+				report.Removed = append(report.Removed, recipes.DeletionItem{Kind: "kubernetes", Name: id, Source: "inventory"})
+			}
+		} else {
+			report.Removed = append(report.Removed, recipes.DeletionItem{Kind: "kubernetes", Name: namespace + "/" + request.Resource.Name, Source: "name"})
+		}
+	}
+
+	if existing.Found {
+		_, err = activities.CallDeleteInventoryRecord(ctx, activities.DeleteInventoryRecordInput{ResourceID: request.Resource.ID})
+		if err != nil {
+			return nil, err
+		}
+
+		report.Removed = append(report.Removed, recipes.DeletionItem{Kind: "inventory", Name: request.Resource.ID, Source: "inventory"})
+	}
+
+	for _, warning := range report.Warnings {
+		logger.Warn(warning, slog.String("resource.id", request.Resource.ID))
 	}
 
 	logger.Info("Done deleting PostgresSQL database")
-	return struct{}{}, nil
+	return report, nil
+}
+
+// abandonPostgresSQLDatabase removes a resource from the inventory, and leaves everything that was provisioned for it
+// as it is. What the inventory knew about is reported as retained, so it can be found later.
+func abandonPostgresSQLDatabase(ctx *daprworkflow.WorkflowContext, request recipes.Context, existing activities.GetInventoryRecordOutput, report recipes.DeletionReport) (any, error) {
+	logger := slog.Default()
+
+	if !existing.Found {
+		report.Warnings = append(report.Warnings, "the resource is not in the inventory, so there was nothing to abandon")
+	} else {
+		reason := "the deletionPolicy is " + report.Policy
+		if existing.Record.Database != "" {
+			report.Retained = append(report.Retained, recipes.DeletionItem{Kind: "database", Name: existing.Record.Database, Source: "inventory", Reason: reason})
+		}
+
+		for _, user := range existing.Record.Users {
+			report.Retained = append(report.Retained, recipes.DeletionItem{Kind: "user", Name: user.Username, Source: "inventory", Reason: reason})
+		}
+		if len(existing.Record.Users) == 0 && existing.Record.Username != "" {
+			report.Retained = append(report.Retained, recipes.DeletionItem{Kind: "user", Name: existing.Record.Username, Source: "inventory", Reason: reason})
+		}
+
+		report.Retained = append(report.Retained, retainedPostgresSQLServer(request, existing, recordedPostgresSQLServer(existing.Record), reason)...)
+
+		_, err := activities.CallDeleteInventoryRecord(ctx, activities.DeleteInventoryRecordInput{ResourceID: request.Resource.ID})
+		if err != nil {
+			return nil, err
+		}
+
+		report.Removed = append(report.Removed, recipes.DeletionItem{Kind: "inventory", Name: request.Resource.ID, Source: "inventory"})
+	}
+
+	for _, warning := range report.Warnings {
+		logger.Warn(warning, slog.String("resource.id", request.Resource.ID))
+	}
+
+	logger.Info("Done abandoning PostgresSQL database")
+	return report, nil
+}
+
+// retainedPostgresSQLServer returns the deletion items for the server of a resource that is kept. A shared server
+// keeps its reference to the resource, and a pool server keeps its placement, so neither is deleted or reused while
+// it holds the resource's data.
+func retainedPostgresSQLServer(request recipes.Context, existing activities.GetInventoryRecordOutput, server postgresSQLServer, reason string) []recipes.DeletionItem {
+	switch server.mode {
+	case PostgresSQLServerModeAdopted:
+		return nil
+
+	case PostgresSQLServerModePool:
+		return []recipes.DeletionItem{{Kind: "placement", Name: server.name, Source: "inventory", Reason: reason}}
+
+	case PostgresSQLServerModeShared:
+		return []recipes.DeletionItem{{Kind: "kubernetes", Name: server.namespace + "/" + server.name, Source: "shared", Reason: reason}}
+	}
+
+	if existing.Found && len(existing.Record.Resources) > 0 {
+		items := []recipes.DeletionItem{}
+		for _, id := range existing.Record.Resources {
+			items = append(items, recipes.DeletionItem{Kind: "kubernetes", Name: id, Source: "inventory", Reason: reason})
+		}
+		return items
+	}
+
+	namespace := kubernetesNamespace(request)
+	if existing.Found && existing.Record.Namespace != "" {
+		namespace = existing.Record.Namespace
+	}
+
+	return []recipes.DeletionItem{{Kind: "kubernetes", Name: namespace + "/" + request.Resource.Name, Source: "name", Reason: reason}}
 }
@@ -0,0 +1,332 @@
+package workflows
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/microsoft/durabletask-go/task"
+	"github.com/rynowak/workflow-recipe/pkg/activities"
+)
+
+const (
+	// LeaseControlEvent is the name of the external event that renews or revokes a lease. The payload is a
+	// LeaseCommand.
+	LeaseControlEvent = "control"
+
+	// LeaseStatusActive is the status of a lease whose credentials can be used.
+	LeaseStatusActive = "active"
+	// LeaseStatusExpired is the status of a lease whose TTL passed without being renewed.
+	LeaseStatusExpired = "expired"
+	// LeaseStatusRevoked is the status of a lease that was revoked before it expired.
+	LeaseStatusRevoked = "revoked"
+
+	// leaseUsernamePrefix is the prefix of the names of the temporary users of leases.
+	leaseUsernamePrefix = "lease_"
+)
+
+var (
+	// LeaseDefaultTTL is the TTL of a lease that does not request one.
+	LeaseDefaultTTL = time.Hour
+
+	// LeaseMaxTTL is the longest a lease can last from when it was issued, including renewals.
+	LeaseMaxTTL = 24 * time.Hour
+)
+
+// LeaseAction is an action that can be sent to an active lease.
+type LeaseAction string
+
+const (
+	// LeaseActionRenew extends the lease by its TTL, or by the TTL in the command.
+	LeaseActionRenew LeaseAction = "renew"
+	// LeaseActionRevoke drops the credentials immediately.
+	LeaseActionRevoke LeaseAction = "revoke"
+)
+
+// LeaseCommand is the payload of LeaseControlEvent.
+type LeaseCommand struct {
+	Action LeaseAction `json:"action"`
+	// TTL is the new TTL for LeaseActionRenew. Ex. 30m. Defaults to the TTL of the lease.
+	TTL string `json:"ttl,omitempty"`
+}
+
+// PostgresSQLCredentialsLeaseInput is the state of a lease. It is carried between iterations of the workflow as the
+// input to continue-as-new.
+type PostgresSQLCredentialsLeaseInput struct {
+	// ResourceID is the ID of the resource the credentials can access.
+	ResourceID string `json:"resourceId"`
+	// TTL is how long the lease lasts, and how much each renewal extends it by. Ex. 15m. Defaults to LeaseDefaultTTL.
+	TTL string `json:"ttl,omitempty"`
+
+	// Status is the status of the lease.
+	Status string `json:"status,omitempty"`
+	// Username is the temporary user. Empty until the credentials are issued.
+	Username string `json:"username,omitempty"`
+	// Server is the server the temporary user is on.
+	Server activities.ServerRef `json:"server,omitempty"`
+	// IssuedAt is the time the credentials were issued.
+	IssuedAt *time.Time `json:"issuedAt,omitempty"`
+	// ExpiresAt is the time the credentials will be dropped unless the lease is renewed.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// Renewals is the number of times the lease was renewed.
+	Renewals int `json:"renewals,omitempty"`
+}
+
+// PostgresSQLCredentialsIssueInput is the input of PostgresSQLCredentialsIssue.
+type PostgresSQLCredentialsIssueInput struct {
+	ResourceID string `json:"resourceId"`
+	Username   string `json:"username"`
+}
+
+// PostgresSQLCredentialsIssueOutput is the output of PostgresSQLCredentialsIssue.
+type PostgresSQLCredentialsIssueOutput struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Database string `json:"database"`
+	URI      string `json:"uri"`
+	// Server is the server the user was created on.
+	Server activities.ServerRef `json:"server,omitempty"`
+}
+
+// PostgresSQLCredentialsLease issues temporary credentials for a PostgreSQL database, and drops them when the lease
+// expires. The lease is renewed or revoked with LeaseControlEvent. The ID of the workflow instance is the lease ID.
+//
+// The credentials are issued by the PostgresSQLCredentialsIssue child workflow, whose instance ID is the lease ID with
+// an -issue suffix. The caller reads the password from the output of the child, and this workflow continues as new
+// right after issuing, so the password does not stay in its history.
+func PostgresSQLCredentialsLease(ctx *daprworkflow.WorkflowContext) (any, error) {
+	input := PostgresSQLCredentialsLeaseInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default().With(slog.String("lease.id", ctx.InstanceID()), slog.String("resource.id", input.ResourceID))
+
+	ttl, err := parseLeaseTTL(input.TTL)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Username == "" {
+		if !ctx.IsReplaying() {
+			logger.Info("Issuing leased PostgresSQL credentials", slog.Duration("ttl", ttl))
+		}
+
+		issued := PostgresSQLCredentialsIssueOutput{}
+		err = ctx.CallChildWorkflow(PostgresSQLCredentialsIssue,
+			daprworkflow.ChildWorkflowInput(PostgresSQLCredentialsIssueInput{
+				ResourceID: input.ResourceID,
+				Username:   leaseUsername(ctx.InstanceID()),
+			}),
+			daprworkflow.ChildWorkflowInstanceID(ctx.InstanceID()+"-issue")).Await(&issued)
+		if err != nil {
+			return nil, err
+		}
+
+		issuedAt := ctx.CurrentUTCDateTime()
+		expiresAt := issuedAt.Add(ttl)
+		input.Status = LeaseStatusActive
+		input.Username = issued.Username
+		input.Server = issued.Server
+		input.IssuedAt = &issuedAt
+		input.ExpiresAt = &expiresAt
+
+		ctx.ContinueAsNew(input, true)
+		return nil, nil
+	}
+
+	timeout := max(input.ExpiresAt.Sub(ctx.CurrentUTCDateTime()), 0)
+	if !ctx.IsReplaying() {
+		logger.Info("Waiting for lease to expire", slog.Time("expiresAt", *input.ExpiresAt))
+	}
+
+	command := LeaseCommand{}
+	err = ctx.WaitForExternalEvent(LeaseControlEvent, timeout).Await(&command)
+	if errors.Is(err, task.ErrTaskCanceled) {
+		input.Status = LeaseStatusExpired
+	} else if err != nil {
+		return nil, err
+	} else {
+		switch command.Action {
+		case LeaseActionRevoke:
+			input.Status = LeaseStatusRevoked
+
+		case LeaseActionRenew:
+			extension := ttl
+			if command.TTL != "" {
+				extension, err = parseLeaseTTL(command.TTL)
+				if err != nil {
+					logger.Warn("Ignoring invalid lease renewal", slog.Any("error", err))
+					break
+				}
+			}
+
+			// Renewals can't extend the lease past its maximum lifetime.
+			expiresAt := ctx.CurrentUTCDateTime().Add(extension)
+			if limit := input.IssuedAt.Add(LeaseMaxTTL); expiresAt.After(limit) {
+				expiresAt = limit
+			}
+			input.ExpiresAt = &expiresAt
+			input.Renewals++
+
+			if !ctx.IsReplaying() {
+				logger.Info("Renewed lease", slog.Time("expiresAt", expiresAt))
+			}
+
+		default:
+			logger.Warn("Ignoring unknown lease action", slog.String("action", string(command.Action)))
+		}
+	}
+
+	if input.Status == LeaseStatusActive {
+		ctx.ContinueAsNew(input, true)
+		return nil, nil
+	}
+
+	_, err = activities.CallDeletePostgresUser(ctx, activities.DeletePostgresUserInput{
+		Username: input.Username,
+		Server:   input.Server,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Dropped leased PostgresSQL credentials", slog.String("username", input.Username), slog.String("status", input.Status))
+	return input, nil
+}
+
+// PostgresSQLCredentialsIssue creates a user with access to the database of a resource, and returns its credentials.
+func PostgresSQLCredentialsIssue(ctx *daprworkflow.WorkflowContext) (any, error) {
+	input := PostgresSQLCredentialsIssueInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	return withResourceLock(ctx, input.ResourceID, func() (any, error) {
+		existing, err := activities.CallGetInventoryRecord(ctx, activities.GetInventoryRecordInput{ResourceID: input.ResourceID})
+		if err != nil {
+			return nil, err
+		} else if !existing.Found {
+			return nil, fmt.Errorf("resource %q is not in the inventory", input.ResourceID)
+		}
+
+		record := existing.Record
+		err = checkPendingDeletion(record)
+		if err != nil {
+			return nil, err
+		}
+
+		if record.Recipe != PostgresSQLDatabasesRecipe {
+			return nil, fmt.Errorf("resource %q was provisioned by recipe %q, not %q", input.ResourceID, record.Recipe, PostgresSQLDatabasesRecipe)
+		} else if record.Database == "" {
+			return nil, fmt.Errorf("resource %q does not have a database in the inventory", input.ResourceID)
+		}
+
+		server := recordedPostgresSQLServer(record).id()
+		credentials, err := activities.CallCreatePostgresUser(ctx, activities.CreatePostgresUserInput{
+			Username: input.Username,
+			Labels:   map[string]string{LabelResourceID: input.ResourceID},
+			Server:   server,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = activities.CallGrantPostgresDatabaseAccess(ctx, activities.GrantPostgresDatabaseAccessInput{
+			Database: record.Database,
+			Username: credentials.Username,
+			Server:   server,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return PostgresSQLCredentialsIssueOutput{
+			Username: credentials.Username,
+			Password: credentials.Password,
+			Host:     record.Host,
+			Port:     record.Port,
+			Database: record.Database,
+			URI: postgresSQLConnectionInfo{
+				Host:     record.Host,
+				Port:     record.Port,
+				Database: record.Database,
+				Username: credentials.Username,
+				Password: credentials.Password,
+			}.URI(),
+			Server: server,
+		}, nil
+	})
+}
+
+// parseLeaseTTL parses the TTL of a lease. Empty means LeaseDefaultTTL.
+func parseLeaseTTL(value string) (time.Duration, error) {
+	if value == "" {
+		return LeaseDefaultTTL, nil
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ttl: %w", err)
+	} else if ttl <= 0 || ttl > LeaseMaxTTL {
+		return 0, fmt.Errorf("invalid ttl: must be positive and at most %s", LeaseMaxTTL)
+	}
+
+	return ttl, nil
+}
+
+// leaseUsername returns the name of the temporary user for a lease.
+func leaseUsername(leaseID string) string {
+	return leaseUsernamePrefix + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		default:
+			return -1
+		}
+	}, leaseID)
+}
+
+// dropPostgresSQLLeaseUsers drops the temporary users of the outstanding leases of a resource, so they can't be used
+// once it is deleted. The privileges of the users in the database are dropped first. Users in recorded are the
+// resource's own, and are never dropped. A lease drops its user again when it ends, which is not an error. Returns the
+// usernames that were dropped.
+func dropPostgresSQLLeaseUsers(ctx *daprworkflow.WorkflowContext, resourceID string, server activities.ServerRef, database string, recorded []string) ([]string, error) {
+	found, err := activities.CallFindPostgresResources(ctx, activities.FindPostgresResourcesInput{
+		Labels: map[string]string{LabelResourceID: resourceID},
+		Server: server,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dropped := []string{}
+	for _, username := range found.Users {
+		if !strings.HasPrefix(username, leaseUsernamePrefix) || slices.Contains(recorded, username) {
+			continue
+		}
+
+		_, err = activities.CallDeletePostgresUser(ctx, activities.DeletePostgresUserInput{
+			Username: username,
+			Database: database,
+			Server:   server,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		dropped = append(dropped, username)
+	}
+
+	return dropped, nil
+}
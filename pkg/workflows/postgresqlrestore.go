@@ -0,0 +1,168 @@
+package workflows
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/rynowak/workflow-recipe/pkg/activities"
+	"github.com/rynowak/workflow-recipe/pkg/inventory"
+	"github.com/rynowak/workflow-recipe/pkg/recipes"
+)
+
+// PostgresSQLDatabasesRestoreInput is the input of PostgresSQLDatabasesRestore.
+type PostgresSQLDatabasesRestoreInput struct {
+	// Context is the recipe context of the resource to restore.
+	Context recipes.Context `json:"context"`
+	// Backup is the ID of the backup to restore.
+	Backup string `json:"backup"`
+}
+
+// PostgresSQLDatabasesRestore provisions a database for a resource the same way as PostgresSQLDatabasesPut, and
+// then loads a backup into it. The backup is verified against its recorded checksum before it is loaded.
+//
+// The backup is always loaded into a new database, which replaces the database of the resource once it is verified.
+// The replaced database is backed up and deleted if AllowDataDeletion is set, and kept otherwise.
+func PostgresSQLDatabasesRestore(ctx *daprworkflow.WorkflowContext) (any, error) {
+	input := PostgresSQLDatabasesRestoreInput{}
+	err := ctx.GetInput(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default()
+	if ctx.IsReplaying() {
+		logger.Info("Resuming PostgresSQL database restore")
+	} else {
+		logger.Info("Restoring PostgresSQL database", slog.String("backup.id", input.Backup))
+	}
+
+	if input.Backup == "" {
+		return nil, errors.New("backup is required")
+	}
+
+	return withResourceLock(ctx, input.Context.Resource.ID, func() (any, error) {
+		return postgresSQLDatabasesRestore(ctx, input)
+	})
+}
+
+func postgresSQLDatabasesRestore(ctx *daprworkflow.WorkflowContext, input PostgresSQLDatabasesRestoreInput) (any, error) {
+	logger := slog.Default()
+	request := input.Context
+
+	// Restoring would overwrite a database the recipe doesn't own.
+	_, adopting, err := getPostgresSQLAdopt(request)
+	if err != nil {
+		return nil, err
+	} else if adopting {
+		return nil, errors.New("an adopted database can't be restored from a backup")
+	}
+
+	// Look up the backup first so nothing is provisioned for a backup that doesn't exist.
+	found, err := activities.CallGetBackup(ctx, activities.GetBackupInput{ID: input.Backup})
+	if err != nil {
+		return nil, err
+	}
+
+	if found.Backup.ResourceID != request.Resource.ID {
+		return nil, fmt.Errorf("backup %q belongs to resource %q, not %q", found.Backup.ID, found.Backup.ResourceID, request.Resource.ID)
+	}
+
+	existing, err := activities.CallGetInventoryRecord(ctx, activities.GetInventoryRecordInput{ResourceID: request.Resource.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	// The backup already contains the schema, so the migrations are not applied again. A backup can't be loaded into
+	// a database that has tables, so it gets a new one.
+	provisioned, err := provisionPostgresSQLDatabase(ctx, request, postgresSQLProvisionOptions{newDatabase: true})
+	if err != nil {
+		return nil, err
+	}
+
+	owner := ""
+	for _, user := range provisioned.users {
+		if user.spec.Role == activities.PostgresRoleOwner {
+			owner = user.credentials.Username
+		}
+	}
+
+	restored, err := activities.CallRestorePostgresDatabase(ctx, activities.RestorePostgresDatabaseInput{
+		Database: provisioned.database.Database,
+		Backup:   found.Backup,
+		Owner:    owner,
+		Server:   provisioned.server.id(),
+	})
+	if err != nil {
+		cleanupErr := cleanupPostgresSQLDatabase(ctx, request, provisioned)
+		if cleanupErr != nil {
+			return nil, errors.Join(err, fmt.Errorf("error cleaning up: %w", cleanupErr))
+		}
+		return nil, err
+	}
+
+	// The users were granted access before the restore created the tables, so they are granted access again.
+	for _, user := range provisioned.users {
+		_, err = activities.CallGrantPostgresDatabaseAccess(ctx, activities.GrantPostgresDatabaseAccessInput{
+			Database: provisioned.database.Database,
+			Username: user.credentials.Username,
+			Role:     user.spec.Role,
+			Grants:   user.spec.Grants,
+			Owner:    owner,
+			Server:   provisioned.server.id(),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = verifyPostgresSQLDatabase(ctx, request, provisioned)
+	if err != nil {
+		return nil, err
+	}
+
+	err = savePostgresSQLDatabase(ctx, request, provisioned)
+	if err != nil {
+		return nil, err
+	}
+
+	replaced := existing.Record.Database
+	if existing.Found && replaced != "" && replaced != provisioned.database.Database {
+		err = deleteReplacedPostgresSQLDatabase(ctx, request, existing.Record)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	logger.Info("Done restoring PostgresSQL database", slog.String("database", provisioned.database.Database), slog.String("checksum", restored.Checksum))
+	return provisioned.result(), nil
+}
+
+// deleteReplacedPostgresSQLDatabase deletes the database a restore replaced, after backing it up. The database is kept
+// unless AllowDataDeletion is set.
+func deleteReplacedPostgresSQLDatabase(ctx *daprworkflow.WorkflowContext, request recipes.Context, record inventory.Record) error {
+	logger := slog.Default().With(slog.String("database", record.Database))
+	if !AllowDataDeletion {
+		if !ctx.IsReplaying() {
+			logger.Warn("Keeping the database replaced by the restore, because data deletion is not allowed")
+		}
+		return nil
+	}
+
+	deleted, err := activities.CallDeletePostgresDatabase(ctx, activities.DeletePostgresDatabaseInput{
+		Database:     record.Database,
+		CreateBackup: true,
+		ResourceID:   request.Resource.ID,
+		Server:       recordedPostgresSQLServer(record).id(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if !ctx.IsReplaying() && deleted.Backup != nil {
+		logger.Info("Deleted the database replaced by the restore", slog.String("backup.id", deleted.Backup.ID))
+	}
+
+	return nil
+}
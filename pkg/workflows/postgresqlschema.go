@@ -0,0 +1,63 @@
+package workflows
+
+import (
+	"fmt"
+
+	"github.com/rynowak/workflow-recipe/pkg/activities"
+	"github.com/rynowak/workflow-recipe/pkg/recipes"
+)
+
+// PostgresSQLSchemaSpec is the initial schema of a database, declared with the extensions and migrations recipe
+// parameters. Ex.
+//
+//	"extensions": ["uuid-ossp", "pgcrypto"],
+//	"migrations": [
+//	  { "id": "001_accounts", "sql": "CREATE TABLE accounts (id uuid PRIMARY KEY DEFAULT gen_random_uuid())" },
+//	  { "id": "002_orders", "configMap": { "name": "orders-schema", "key": "002_orders.sql" } }
+//	]
+type PostgresSQLSchemaSpec struct {
+	// Extensions are enabled before the migrations are applied.
+	Extensions []string
+	// Migrations are applied in order. Migrations that were already applied are skipped.
+	Migrations []activities.PostgresMigration
+}
+
+// getPostgresSQLSchema returns the schema declared by the extensions and migrations parameters.
+func getPostgresSQLSchema(request recipes.Context) (PostgresSQLSchemaSpec, error) {
+	schema := PostgresSQLSchemaSpec{}
+	_, err := request.DecodeParameter("extensions", &schema.Extensions)
+	if err != nil {
+		return PostgresSQLSchemaSpec{}, err
+	}
+
+	extensions := map[string]bool{}
+	for _, extension := range schema.Extensions {
+		err = activities.ValidatePostgresExtension(extension)
+		if err != nil {
+			return PostgresSQLSchemaSpec{}, fmt.Errorf("invalid extensions parameter: %w", err)
+		} else if extensions[extension] {
+			return PostgresSQLSchemaSpec{}, fmt.Errorf("invalid extensions parameter: extension %q is listed more than once", extension)
+		}
+		extensions[extension] = true
+	}
+
+	_, err = request.DecodeParameter("migrations", &schema.Migrations)
+	if err != nil {
+		return PostgresSQLSchemaSpec{}, err
+	}
+
+	ids := map[string]bool{}
+	for _, migration := range schema.Migrations {
+		err = migration.Validate()
+		if err != nil {
+			return PostgresSQLSchemaSpec{}, fmt.Errorf("invalid migrations parameter: %w", err)
+		} else if ids[migration.ID] {
+			return PostgresSQLSchemaSpec{}, fmt.Errorf("invalid migrations parameter: id %q is used more than once", migration.ID)
+		} else if migration.ConfigMap != nil && kubernetesNamespace(request) == "" {
+			return PostgresSQLSchemaSpec{}, fmt.Errorf("invalid migrations parameter: migration %q reads a ConfigMap, which requires the resource's Kubernetes namespace", migration.ID)
+		}
+		ids[migration.ID] = true
+	}
+
+	return schema, nil
+}
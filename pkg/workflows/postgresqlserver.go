@@ -0,0 +1,287 @@
+package workflows
+
+import (
+	"errors"
+	"fmt"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/rynowak/workflow-recipe/pkg/activities"
+	"github.com/rynowak/workflow-recipe/pkg/inventory"
+	"github.com/rynowak/workflow-recipe/pkg/recipes"
+)
+
+// PostgresSQLServerMode controls which server the database of a resource is created on. It is set with the
+// serverMode recipe parameter. Set it in the environment's recipe registration to use the same mode for every
+// resource in the environment.
+type PostgresSQLServerMode string
+
+const (
+	// PostgresSQLServerModeDedicated deploys a server for each resource, in the resource's namespace.
+	PostgresSQLServerModeDedicated PostgresSQLServerMode = "dedicated"
+	// PostgresSQLServerModeShared deploys one server per environment, in the environment's namespace. It is created
+	// by the first resource that uses it, and deleted with the last.
+	PostgresSQLServerModeShared PostgresSQLServerMode = "shared"
+	// PostgresSQLServerModePool places the database on one of the pre-existing servers in the server pool, chosen
+	// by the placementPolicy parameter.
+	PostgresSQLServerModePool PostgresSQLServerMode = "pool"
+	// PostgresSQLServerModeAdopted is the mode of a resource that adopted an existing database with the adopt
+	// parameter. It can't be set with the serverMode parameter.
+	PostgresSQLServerModeAdopted PostgresSQLServerMode = "adopted"
+
+	// DefaultPostgresSQLServerMode is used when the serverMode parameter is not set.
+	DefaultPostgresSQLServerMode = PostgresSQLServerModeDedicated
+
+	// SharedPostgresSQLServerName is the name of the shared server in the environment's namespace.
+	SharedPostgresSQLServerName = "postgres-shared"
+
+	// DefaultPostgresSQLPlacementPolicy is used when the placementPolicy parameter is not set.
+	DefaultPostgresSQLPlacementPolicy = activities.PostgresPlacementLeastLoaded
+
+	// PoolLabelEnvironment is the label of pool servers that is matched against the name of the environment by the
+	// labelAffinity placement policy, unless the serverLabels parameter is set.
+	PoolLabelEnvironment = "environment"
+)
+
+func getPostgresSQLServerMode(request recipes.Context) (PostgresSQLServerMode, error) {
+	value, ok := request.GetStringParameter("serverMode")
+
+	_, adopting, err := getPostgresSQLAdopt(request)
+	if err != nil {
+		return "", err
+	} else if adopting && ok {
+		return "", errors.New("the serverMode parameter can't be used with the adopt parameter")
+	} else if adopting {
+		return PostgresSQLServerModeAdopted, nil
+	}
+
+	if !ok {
+		return DefaultPostgresSQLServerMode, nil
+	}
+
+	mode := PostgresSQLServerMode(value)
+	switch mode {
+	case PostgresSQLServerModeDedicated, PostgresSQLServerModeShared, PostgresSQLServerModePool:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unsupported serverMode %q", value)
+	}
+}
+
+// getPostgresSQLPlacement returns the placement of a database in the server pool, from the placementPolicy and
+// serverLabels parameters. Ex.
+//
+//	"serverMode": "pool",
+//	"placementPolicy": "labelAffinity",
+//	"serverLabels": { "region": "east" }
+func getPostgresSQLPlacement(request recipes.Context) (activities.PlacePostgresDatabaseInput, error) {
+	placement := activities.PlacePostgresDatabaseInput{
+		ResourceID:    request.Resource.ID,
+		EnvironmentID: request.Environment.ID,
+		ApplicationID: request.Application.ID,
+		Policy:        DefaultPostgresSQLPlacementPolicy,
+	}
+
+	if value, ok := request.GetStringParameter("placementPolicy"); ok {
+		placement.Policy = activities.PostgresPlacementPolicy(value)
+		if !placement.Policy.IsValid() {
+			return activities.PlacePostgresDatabaseInput{}, fmt.Errorf("unsupported placementPolicy %q", value)
+		}
+	}
+
+	ok, err := request.DecodeParameter("serverLabels", &placement.Labels)
+	if err != nil {
+		return activities.PlacePostgresDatabaseInput{}, err
+	} else if !ok && request.Environment.Name != "" {
+		placement.Labels = map[string]string{PoolLabelEnvironment: request.Environment.Name}
+	}
+
+	return placement, nil
+}
+
+// postgresSQLServer identifies the server a database is on.
+type postgresSQLServer struct {
+	mode PostgresSQLServerMode
+	// namespace and name identify the server. They are empty for a dedicated server of a resource that was recorded
+	// without a namespace, which is managed as the default server.
+	namespace string
+	name      string
+}
+
+// recordedPostgresSQLServer returns the server recorded in the inventory. Records without a server mode were
+// provisioned on a dedicated server, which has the name of the resource.
+func recordedPostgresSQLServer(record inventory.Record) postgresSQLServer {
+	if record.ServerMode == "" {
+		return postgresSQLServer{mode: PostgresSQLServerModeDedicated, namespace: record.Namespace, name: record.Name}
+	}
+
+	return postgresSQLServer{
+		mode:      PostgresSQLServerMode(record.ServerMode),
+		namespace: record.ServerNamespace,
+		name:      record.Server,
+	}
+}
+
+// record records the server in an inventory record.
+func (s postgresSQLServer) record(record *inventory.Record) {
+	if s.mode == PostgresSQLServerModeDedicated {
+		return
+	}
+
+	record.ServerMode = string(s.mode)
+	record.Server = s.name
+	record.ServerNamespace = s.namespace
+}
+
+// id returns the server that activities manage the database on.
+func (s postgresSQLServer) id() activities.ServerRef {
+	if s.mode == PostgresSQLServerModePool || s.mode == PostgresSQLServerModeAdopted {
+		return activities.ServerRef(s.name)
+	} else if s.namespace == "" {
+		return ""
+	}
+
+	return activities.ServerRef(activities.DeploymentID(s.namespace, s.name))
+}
+
+// sharedPostgresSQLServerID returns the ID of the shared server of an environment. It is also the ID of the lock
+// that is held while the server is created or deleted.
+func sharedPostgresSQLServerID(namespace string) string {
+	return activities.DeploymentID(namespace, SharedPostgresSQLServerName)
+}
+
+// deployPostgresSQLServer deploys the server for a resource's database, adds the resource to the environment's
+// shared server, or places the database in the server pool.
+func deployPostgresSQLServer(ctx *daprworkflow.WorkflowContext, request recipes.Context, mode PostgresSQLServerMode) (postgresSQLServer, activities.DeployKubernetesResourcesOutput, error) {
+	if mode == PostgresSQLServerModeDedicated {
+		server := postgresSQLServer{mode: mode, namespace: kubernetesNamespace(request), name: request.Resource.Name}
+		if server.namespace == "" {
+			return postgresSQLServer{}, activities.DeployKubernetesResourcesOutput{}, errors.New("the dedicated server mode requires the resource's Kubernetes namespace")
+		}
+
+		deployed, err := activities.CallDeployKubernetesResources(ctx, activities.DeployKubernetesResourcesInput{
+			Namespace: server.namespace,
+			Name:      server.name,
+		})
+		if err != nil {
+			return postgresSQLServer{}, activities.DeployKubernetesResourcesOutput{}, err
+		}
+
+		return server, deployed, nil
+	}
+
+	if mode == PostgresSQLServerModePool {
+		placement, err := getPostgresSQLPlacement(request)
+		if err != nil {
+			return postgresSQLServer{}, activities.DeployKubernetesResourcesOutput{}, err
+		}
+
+		placed, err := activities.CallPlacePostgresDatabase(ctx, placement)
+		if err != nil {
+			return postgresSQLServer{}, activities.DeployKubernetesResourcesOutput{}, err
+		}
+
+		// Pool servers already exist, so nothing is deployed to Kubernetes.
+		return postgresSQLServer{mode: mode, name: placed.Server}, activities.DeployKubernetesResourcesOutput{
+			Host:      placed.Host,
+			Port:      placed.Port,
+			Resources: []string{},
+		}, nil
+	}
+
+	server := postgresSQLServer{mode: mode, namespace: environmentNamespace(request), name: SharedPostgresSQLServerName}
+	if server.namespace == "" {
+		return postgresSQLServer{}, activities.DeployKubernetesResourcesOutput{}, errors.New("the shared server mode requires the environment's Kubernetes namespace")
+	}
+
+	// The server is locked while the reference is added, so it can't be deleted by the last resource that used it
+	// in the meantime.
+	deployed := activities.DeployKubernetesResourcesOutput{}
+	_, err := withResourceLock(ctx, sharedPostgresSQLServerID(server.namespace), func() (any, error) {
+		var err error
+		deployed, err = activities.CallDeployKubernetesResources(ctx, activities.DeployKubernetesResourcesInput{
+			Namespace: server.namespace,
+			Name:      server.name,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = activities.CallAddSharedServerReference(ctx, activities.AddSharedServerReferenceInput{
+			Server: activities.SharedServer{
+				Namespace: server.namespace,
+				Name:      server.name,
+				Host:      deployed.Host,
+				Port:      deployed.Port,
+				Resources: deployed.Resources,
+			},
+			ResourceID: request.Resource.ID,
+		})
+		return nil, err
+	})
+	if err != nil {
+		return postgresSQLServer{}, activities.DeployKubernetesResourcesOutput{}, err
+	}
+
+	// The server's Kubernetes resources belong to the environment, so they aren't returned to Radius with the
+	// resource's.
+	deployed.Resources = []string{}
+	return server, deployed, nil
+}
+
+// releaseSharedPostgresSQLServer removes a resource from a shared server, and deletes the server if no other
+// resources use it.
+func releaseSharedPostgresSQLServer(ctx *daprworkflow.WorkflowContext, resourceID string, server postgresSQLServer) (activities.RemoveSharedServerReferenceOutput, error) {
+	released := activities.RemoveSharedServerReferenceOutput{}
+	_, err := withResourceLock(ctx, sharedPostgresSQLServerID(server.namespace), func() (any, error) {
+		var err error
+		released, err = activities.CallRemoveSharedServerReference(ctx, activities.RemoveSharedServerReferenceInput{
+			Namespace:  server.namespace,
+			Name:       server.name,
+			ResourceID: resourceID,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if released.Unused {
+			_, err = activities.CallDeleteKubernetesResources(ctx, activities.DeleteKubernetesResourcesInput{
+				Namespace: server.namespace,
+				Name:      server.name,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return nil, nil
+	})
+	if err != nil {
+		return activities.RemoveSharedServerReferenceOutput{}, err
+	}
+
+	return released, nil
+}
+
+// reportSharedPostgresSQLServerRelease adds what happened to a shared server to a deletion report.
+func reportSharedPostgresSQLServerRelease(report *recipes.DeletionReport, server postgresSQLServer, released activities.RemoveSharedServerReferenceOutput) {
+	name := server.namespace + "/" + server.name
+	if !released.Found {
+		report.NotFound = append(report.NotFound, recipes.DeletionItem{Kind: "kubernetes", Name: name, Source: "shared", Reason: "the shared server has no record of the resources that use it"})
+		report.Warnings = append(report.Warnings, fmt.Sprintf("shared server %q was not deleted because it has no record of the resources that use it", name))
+		return
+	}
+
+	if !released.Unused {
+		report.Retained = append(report.Retained, recipes.DeletionItem{
+			Kind:   "kubernetes",
+			Name:   name,
+			Source: "shared",
+			Reason: fmt.Sprintf("the shared server is still used by %d other resources", len(released.Server.References)),
+		})
+		return
+	}
+
+	for _, id := range released.Server.Resources {
+		report.Removed = append(report.Removed, recipes.DeletionItem{Kind: "kubernetes", Name: id, Source: "shared"})
+	}
+}
@@ -0,0 +1,226 @@
+package workflows
+
+import (
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/rynowak/workflow-recipe/pkg/activities"
+	"github.com/rynowak/workflow-recipe/pkg/inventory"
+	"github.com/rynowak/workflow-recipe/pkg/recipes"
+)
+
+func TestGetPostgresSQLServerMode(t *testing.T) {
+	adopt := map[string]any{"database": "orders", "server": "pg-prod-1"}
+
+	tests := []struct {
+		name       string
+		parameters map[string]any
+		want       PostgresSQLServerMode
+		wantErr    string
+	}{
+		{
+			name: "defaults to dedicated",
+			want: PostgresSQLServerModeDedicated,
+		},
+		{
+			name:       "shared",
+			parameters: map[string]any{"serverMode": "shared"},
+			want:       PostgresSQLServerModeShared,
+		},
+		{
+			name:       "pool",
+			parameters: map[string]any{"serverMode": "pool"},
+			want:       PostgresSQLServerModePool,
+		},
+		{
+			name:       "adopting",
+			parameters: map[string]any{"adopt": adopt},
+			want:       PostgresSQLServerModeAdopted,
+		},
+		{
+			name:       "adopted can't be set",
+			parameters: map[string]any{"serverMode": "adopted"},
+			wantErr:    `unsupported serverMode "adopted"`,
+		},
+		{
+			name:       "adopting with a server mode",
+			parameters: map[string]any{"serverMode": "shared", "adopt": adopt},
+			wantErr:    "the serverMode parameter can't be used with the adopt parameter",
+		},
+		{
+			name:       "unsupported",
+			parameters: map[string]any{"serverMode": "serverless"},
+			wantErr:    `unsupported serverMode "serverless"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getPostgresSQLServerMode(recipes.Context{Parameters: tt.parameters})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostgresSQLServer_ID(t *testing.T) {
+	tests := []struct {
+		name   string
+		server postgresSQLServer
+		want   activities.ServerRef
+	}{
+		{
+			name:   "dedicated",
+			server: postgresSQLServer{mode: PostgresSQLServerModeDedicated, namespace: "app", name: "orders"},
+			want:   activities.ServerRef(activities.DeploymentID("app", "orders")),
+		},
+		{
+			name:   "dedicated without a namespace is the default server",
+			server: postgresSQLServer{mode: PostgresSQLServerModeDedicated, name: "orders"},
+			want:   "",
+		},
+		{
+			name:   "shared",
+			server: postgresSQLServer{mode: PostgresSQLServerModeShared, namespace: "env", name: SharedPostgresSQLServerName},
+			want:   activities.ServerRef(sharedPostgresSQLServerID("env")),
+		},
+		{
+			name:   "pool",
+			server: postgresSQLServer{mode: PostgresSQLServerModePool, name: "pg-east-1"},
+			want:   "pg-east-1",
+		},
+		{
+			name:   "adopted",
+			server: postgresSQLServer{mode: PostgresSQLServerModeAdopted, name: "pg-prod-1"},
+			want:   "pg-prod-1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.server.id()
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordedPostgresSQLServer(t *testing.T) {
+	servers := []postgresSQLServer{
+		{mode: PostgresSQLServerModeShared, namespace: "env", name: SharedPostgresSQLServerName},
+		{mode: PostgresSQLServerModePool, name: "pg-east-1"},
+		{mode: PostgresSQLServerModeAdopted, name: "pg-prod-1"},
+	}
+
+	// What is recorded comes back as the same server.
+	for _, server := range servers {
+		t.Run(string(server.mode), func(t *testing.T) {
+			record := inventory.Record{Name: "orders", Namespace: "app"}
+			server.record(&record)
+
+			got := recordedPostgresSQLServer(record)
+			if got != server {
+				t.Errorf("got %+v, want %+v", got, server)
+			}
+		})
+	}
+
+	// Dedicated servers aren't recorded, and records from before server modes don't have one either.
+	t.Run("dedicated", func(t *testing.T) {
+		record := inventory.Record{Name: "orders", Namespace: "app"}
+		postgresSQLServer{mode: PostgresSQLServerModeDedicated, namespace: "app", name: "orders"}.record(&record)
+
+		want := postgresSQLServer{mode: PostgresSQLServerModeDedicated, namespace: "app", name: "orders"}
+		got := recordedPostgresSQLServer(record)
+		if got != want {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	})
+}
+
+func TestGetPostgresSQLPlacement(t *testing.T) {
+	tests := []struct {
+		name        string
+		environment string
+		parameters  map[string]any
+		wantPolicy  activities.PostgresPlacementPolicy
+		wantLabels  map[string]string
+		wantErr     string
+	}{
+		{
+			name:       "defaults",
+			wantPolicy: DefaultPostgresSQLPlacementPolicy,
+		},
+		{
+			name:        "labels default to the environment",
+			environment: "dev",
+			parameters:  map[string]any{"placementPolicy": "labelAffinity"},
+			wantPolicy:  activities.PostgresPlacementLabelAffinity,
+			wantLabels:  map[string]string{PoolLabelEnvironment: "dev"},
+		},
+		{
+			name:        "server labels replace the environment",
+			environment: "dev",
+			parameters:  map[string]any{"placementPolicy": "labelAffinity", "serverLabels": map[string]any{"region": "east"}},
+			wantPolicy:  activities.PostgresPlacementLabelAffinity,
+			wantLabels:  map[string]string{"region": "east"},
+		},
+		{
+			name:       "spread",
+			parameters: map[string]any{"placementPolicy": "spread"},
+			wantPolicy: activities.PostgresPlacementSpread,
+		},
+		{
+			name:       "unsupported policy",
+			parameters: map[string]any{"placementPolicy": "random"},
+			wantErr:    `unsupported placementPolicy "random"`,
+		},
+		{
+			name:       "labels that aren't strings",
+			parameters: map[string]any{"serverLabels": map[string]any{"region": 1}},
+			wantErr:    `invalid value for parameter "serverLabels"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := recipes.Context{
+				Resource:    recipes.Resource{ResourceInfo: recipes.ResourceInfo{ID: "/resources/orders"}},
+				Environment: recipes.ResourceInfo{Name: tt.environment, ID: "/environments/" + tt.environment},
+				Parameters:  tt.parameters,
+			}
+
+			got, err := getPostgresSQLPlacement(request)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got.ResourceID != "/resources/orders" || got.EnvironmentID != request.Environment.ID {
+				t.Errorf("got resource %q and environment %q, want %q and %q", got.ResourceID, got.EnvironmentID, "/resources/orders", request.Environment.ID)
+			}
+			if got.Policy != tt.wantPolicy {
+				t.Errorf("got policy %q, want %q", got.Policy, tt.wantPolicy)
+			}
+			if !maps.Equal(got.Labels, tt.wantLabels) {
+				t.Errorf("got labels %v, want %v", got.Labels, tt.wantLabels)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package workflows
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/microsoft/durabletask-go/task"
+	"github.com/rynowak/workflow-recipe/pkg/activities"
+	"github.com/rynowak/workflow-recipe/pkg/inventory"
+	"github.com/rynowak/workflow-recipe/pkg/recipes"
+)
+
+// getRecoveryWindow returns how long a deleted resource can be undeleted, from the recoveryWindow recipe parameter.
+// Ex. 7d, 12h. Zero if the parameter is not set, and the resource is deleted right away.
+func getRecoveryWindow(request recipes.Context) (time.Duration, error) {
+	value, ok := request.GetStringParameter("recoveryWindow")
+	if !ok {
+		return 0, nil
+	}
+
+	// time.ParseDuration doesn't support days, and windows are usually a number of days.
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid recoveryWindow %q: must be a number of days, like 7d, or a duration, like 12h", value)
+		}
+
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	window, err := time.ParseDuration(value)
+	if err != nil || window < 0 {
+		return 0, fmt.Errorf("invalid recoveryWindow %q: must be a number of days, like 7d, or a duration, like 12h", value)
+	}
+
+	return window, nil
+}
+
+// checkPendingDeletion returns an error if a resource was soft-deleted, so nothing gives access to it again while it
+// waits to be deleted.
+func checkPendingDeletion(record inventory.Record) error {
+	if record.PendingDeletion == nil {
+		return nil
+	}
+
+	return fmt.Errorf("resource %q is pending deletion until %s: undelete it first", record.ID, record.PendingDeletion.DeleteAt.Format(time.RFC3339))
+}
+
+// softDeletePostgresSQLDatabase revokes access to a resource's database right away, and deletes it when the recovery
+// window ends. Sending inventory.UndeleteEvent before then restores access instead, and the workflow fails so the resource is
+// kept.
+//
+// The resource is only locked while it changes, not for the whole window, so the lock doesn't expire while waiting.
+func softDeletePostgresSQLDatabase(ctx *daprworkflow.WorkflowContext, request recipes.Context, window time.Duration) (any, error) {
+	logger := slog.Default()
+
+	var pending *inventory.PendingDeletion
+	_, err := withResourceLock(ctx, request.Resource.ID, func() (any, error) {
+		var err error
+		pending, err = markPostgresSQLDatabasePendingDeletion(ctx, request, window)
+		return nil, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// There's nothing to undelete without an inventory record.
+	if pending == nil {
+		if !ctx.IsReplaying() {
+			logger.Warn("Deleting PostgresSQL database without a recovery window, because it is not in the inventory", slog.String("resource.id", request.Resource.ID))
+		}
+
+		return withResourceLock(ctx, request.Resource.ID, func() (any, error) {
+			return postgresSQLDatabasesDelete(ctx, request)
+		})
+	}
+
+	if !ctx.IsReplaying() {
+		logger.Info("Waiting for recovery window to end", slog.String("resource.id", request.Resource.ID), slog.Time("deleteAt", pending.DeleteAt))
+	}
+
+	timeout := max(pending.DeleteAt.Sub(ctx.CurrentUTCDateTime()), 0)
+	err = ctx.WaitForExternalEvent(inventory.UndeleteEvent, timeout).Await(nil)
+	if err != nil && !errors.Is(err, task.ErrTaskCanceled) {
+		return nil, err
+	}
+	undeleted := err == nil
+
+	return withResourceLock(ctx, request.Resource.ID, func() (any, error) {
+		existing, err := activities.CallGetInventoryRecord(ctx, activities.GetInventoryRecordInput{ResourceID: request.Resource.ID})
+		if err != nil {
+			return nil, err
+		}
+
+		// A Delete that was retried takes over the pending deletion from this one.
+		if !existing.Found || existing.Record.PendingDeletion == nil || existing.Record.PendingDeletion.InstanceID != ctx.InstanceID() {
+			return nil, fmt.Errorf("the deletion of resource %q is no longer pending for this workflow", request.Resource.ID)
+		}
+
+		if !undeleted {
+			return postgresSQLDatabasesDelete(ctx, request)
+		}
+
+		err = undeletePostgresSQLDatabase(ctx, existing.Record)
+		if err != nil {
+			return nil, err
+		}
+
+		logger.Info("Undeleted PostgresSQL database", slog.String("resource.id", request.Resource.ID))
+		return nil, fmt.Errorf("the deletion of resource %q was cancelled by undelete", request.Resource.ID)
+	})
+}
+
+// markPostgresSQLDatabasePendingDeletion revokes the logins of a resource's users, drops the users of its
+// outstanding leases, and records that it is pending deletion. A retried Delete takes over the pending deletion, but the resource is still deleted when the first one
+// would have deleted it. Returns nil if the resource is not in the inventory.
+func markPostgresSQLDatabasePendingDeletion(ctx *daprworkflow.WorkflowContext, request recipes.Context, window time.Duration) (*inventory.PendingDeletion, error) {
+	existing, err := activities.CallGetInventoryRecord(ctx, activities.GetInventoryRecordInput{ResourceID: request.Resource.ID})
+	if err != nil {
+		return nil, err
+	} else if !existing.Found {
+		return nil, nil
+	}
+
+	record := existing.Record
+	if record.PendingDeletion == nil {
+		now := ctx.CurrentUTCDateTime()
+		record.PendingDeletion = &inventory.PendingDeletion{RequestedAt: now, DeleteAt: now.Add(window)}
+	}
+
+	server := recordedPostgresSQLServer(record).id()
+	for _, username := range recordedPostgresSQLUsernames(record) {
+		_, err = activities.CallRevokePostgresUserLogin(ctx, activities.RevokePostgresUserLoginInput{
+			Username: username,
+			Server:   server,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Leases are short-lived, so they are cut short instead of being restored by undelete.
+	_, err = dropPostgresSQLLeaseUsers(ctx, request.Resource.ID, server, record.Database, recordedPostgresSQLUsernames(record))
+	if err != nil {
+		return nil, err
+	}
+
+	record.PendingDeletion.InstanceID = ctx.InstanceID()
+	record.InstanceID = ctx.InstanceID()
+	_, err = activities.CallSaveInventoryRecord(ctx, activities.SaveInventoryRecordInput{Record: record})
+	if err != nil {
+		return nil, err
+	}
+
+	return record.PendingDeletion, nil
+}
+
+// undeletePostgresSQLDatabase restores the logins of a resource's users, and records that it is no longer pending
+// deletion.
+func undeletePostgresSQLDatabase(ctx *daprworkflow.WorkflowContext, record inventory.Record) error {
+	server := recordedPostgresSQLServer(record).id()
+	for _, username := range recordedPostgresSQLUsernames(record) {
+		_, err := activities.CallRestorePostgresUserLogin(ctx, activities.RestorePostgresUserLoginInput{
+			Username: username,
+			Server:   server,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	record.PendingDeletion = nil
+	record.InstanceID = ctx.InstanceID()
+	_, err := activities.CallSaveInventoryRecord(ctx, activities.SaveInventoryRecordInput{Record: record})
+	return err
+}
+
+// recordedPostgresSQLUsernames returns the usernames of every user in an inventory record.
+func recordedPostgresSQLUsernames(record inventory.Record) []string {
+	usernames := []string{}
+	for _, user := range record.Users {
+		usernames = append(usernames, user.Username)
+	}
+
+	if record.Username != "" && !slices.Contains(usernames, record.Username) {
+		usernames = append(usernames, record.Username)
+	}
+
+	return usernames
+}
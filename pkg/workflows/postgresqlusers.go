@@ -0,0 +1,115 @@
+package workflows
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+
+	"github.com/rynowak/workflow-recipe/pkg/activities"
+	"github.com/rynowak/workflow-recipe/pkg/inventory"
+	"github.com/rynowak/workflow-recipe/pkg/recipes"
+)
+
+const (
+	// DefaultPostgresSQLUserName is the name of the user created when the recipe does not declare any users.
+	DefaultPostgresSQLUserName = "default"
+)
+
+var (
+	userNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,30}$`)
+)
+
+// PostgresSQLUserSpec is a user declared with the users recipe parameter. Ex.
+//
+//	"users": [
+//	  { "name": "app", "role": "owner" },
+//	  { "name": "reporting", "role": "readOnly" },
+//	  { "name": "etl", "role": "custom", "grants": ["SELECT", "INSERT"] }
+//	]
+type PostgresSQLUserSpec struct {
+	// Name identifies the user in the recipe output. Lowercase letters, digits, and underscores.
+	Name string `json:"name"`
+	// Role is the role profile of the user.
+	Role activities.PostgresRole `json:"role"`
+	// Grants are the table privileges of a custom role.
+	Grants []string `json:"grants,omitempty"`
+}
+
+// getPostgresSQLUsers returns the users declared by the users parameter. Without the parameter the recipe creates a
+// single owner, like it always has.
+func getPostgresSQLUsers(request recipes.Context) ([]PostgresSQLUserSpec, error) {
+	users := []PostgresSQLUserSpec{}
+	ok, err := request.DecodeParameter("users", &users)
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return []PostgresSQLUserSpec{{Name: DefaultPostgresSQLUserName, Role: activities.PostgresRoleOwner}}, nil
+	}
+
+	if len(users) == 0 {
+		return nil, fmt.Errorf("invalid users parameter: at least one user is required")
+	}
+
+	names := map[string]bool{}
+	owners := 0
+	for _, user := range users {
+		if !userNamePattern.MatchString(user.Name) {
+			return nil, fmt.Errorf("invalid users parameter: name %q must start with a lowercase letter and contain only lowercase letters, digits, and underscores", user.Name)
+		} else if names[user.Name] {
+			return nil, fmt.Errorf("invalid users parameter: name %q is used more than once", user.Name)
+		} else if !user.Role.IsValid() {
+			return nil, fmt.Errorf("invalid users parameter: user %q has unsupported role %q", user.Name, user.Role)
+		}
+
+		err = activities.ValidatePostgresGrants(user.Role, user.Grants)
+		if err != nil {
+			return nil, fmt.Errorf("invalid users parameter: user %q: %w", user.Name, err)
+		}
+
+		names[user.Name] = true
+		if user.Role == activities.PostgresRoleOwner {
+			owners++
+		}
+	}
+
+	if owners > 1 {
+		return nil, fmt.Errorf("invalid users parameter: a database can only have one owner")
+	}
+
+	return users, nil
+}
+
+// postgresSQLUsername returns the database username for a declared user. Usernames are shared by every database on
+// the server, so they include a hash of the resource ID. The default user keeps the name it has always had on a
+// dedicated server, where no other resource can use it.
+func postgresSQLUsername(request recipes.Context, mode PostgresSQLServerMode, user PostgresSQLUserSpec) string {
+	if user.Name == DefaultPostgresSQLUserName && mode == PostgresSQLServerModeDedicated {
+		return ""
+	}
+
+	return hashedPostgresSQLUsername(request, user.Name)
+}
+
+// recordedPostgresSQLUsername returns the database username of a declared user in the inventory record of a resource
+// that exists. Usernames change when credentials are rotated, so the recorded one is kept instead of being derived
+// again. Records from before users were recorded only have the username of the first user.
+func recordedPostgresSQLUsername(record inventory.Record, user PostgresSQLUserSpec, first bool) (string, bool) {
+	for _, recorded := range record.Users {
+		if recorded.Name == user.Name && recorded.Username != "" {
+			return recorded.Username, true
+		}
+	}
+
+	if first && len(record.Users) == 0 && record.Username != "" {
+		return record.Username, true
+	}
+
+	return "", false
+}
+
+// hashedPostgresSQLUsername returns name with a hash of the resource ID, so it is unique on the server.
+func hashedPostgresSQLUsername(request recipes.Context, name string) string {
+	hash := sha256.Sum256([]byte(request.Resource.ID))
+	return name + "_" + hex.EncodeToString(hash[:4])
+}
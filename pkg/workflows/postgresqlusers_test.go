@@ -0,0 +1,178 @@
+package workflows
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rynowak/workflow-recipe/pkg/activities"
+	"github.com/rynowak/workflow-recipe/pkg/inventory"
+	"github.com/rynowak/workflow-recipe/pkg/recipes"
+)
+
+func TestGetPostgresSQLUsers(t *testing.T) {
+	tests := []struct {
+		name    string
+		users   any
+		want    []PostgresSQLUserSpec
+		wantErr string
+	}{
+		{
+			name:  "defaults to a single owner",
+			users: nil,
+			want:  []PostgresSQLUserSpec{{Name: DefaultPostgresSQLUserName, Role: activities.PostgresRoleOwner}},
+		},
+		{
+			name: "every role",
+			users: []any{
+				map[string]any{"name": "app", "role": "owner"},
+				map[string]any{"name": "worker", "role": "readWrite"},
+				map[string]any{"name": "reporting", "role": "readOnly"},
+				map[string]any{"name": "etl", "role": "custom", "grants": []any{"SELECT", "insert"}},
+			},
+			want: []PostgresSQLUserSpec{
+				{Name: "app", Role: activities.PostgresRoleOwner},
+				{Name: "worker", Role: activities.PostgresRoleReadWrite},
+				{Name: "reporting", Role: activities.PostgresRoleReadOnly},
+				{Name: "etl", Role: activities.PostgresRoleCustom, Grants: []string{"SELECT", "insert"}},
+			},
+		},
+		{
+			name:    "empty list",
+			users:   []any{},
+			wantErr: "at least one user is required",
+		},
+		{
+			name:    "invalid name",
+			users:   []any{map[string]any{"name": "App", "role": "owner"}},
+			wantErr: `name "App" must start with a lowercase letter`,
+		},
+		{
+			name: "duplicate name",
+			users: []any{
+				map[string]any{"name": "app", "role": "owner"},
+				map[string]any{"name": "app", "role": "readOnly"},
+			},
+			wantErr: `name "app" is used more than once`,
+		},
+		{
+			name:    "unsupported role",
+			users:   []any{map[string]any{"name": "app", "role": "admin"}},
+			wantErr: `user "app" has unsupported role "admin"`,
+		},
+		{
+			name:    "grants on a role that isn't custom",
+			users:   []any{map[string]any{"name": "app", "role": "readOnly", "grants": []any{"SELECT"}}},
+			wantErr: "grants can only be set for the custom role",
+		},
+		{
+			name:    "custom role without grants",
+			users:   []any{map[string]any{"name": "etl", "role": "custom"}},
+			wantErr: "the custom role requires at least one grant",
+		},
+		{
+			name:    "unsupported grant",
+			users:   []any{map[string]any{"name": "etl", "role": "custom", "grants": []any{"DROP"}}},
+			wantErr: `unsupported grant "DROP"`,
+		},
+		{
+			name: "more than one owner",
+			users: []any{
+				map[string]any{"name": "app", "role": "owner"},
+				map[string]any{"name": "admin", "role": "owner"},
+			},
+			wantErr: "a database can only have one owner",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := recipes.Context{Parameters: map[string]any{"users": tt.users}}
+
+			got, err := getPostgresSQLUsers(request)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostgresSQLUsername(t *testing.T) {
+	request := recipes.Context{Resource: recipes.Resource{ResourceInfo: recipes.ResourceInfo{ID: "/resources/orders"}}}
+	other := recipes.Context{Resource: recipes.Resource{ResourceInfo: recipes.ResourceInfo{ID: "/resources/payments"}}}
+	defaultUser := PostgresSQLUserSpec{Name: DefaultPostgresSQLUserName, Role: activities.PostgresRoleOwner}
+	reporting := PostgresSQLUserSpec{Name: "reporting", Role: activities.PostgresRoleReadOnly}
+
+	// The default user keeps the server's own name on a dedicated server.
+	if got := postgresSQLUsername(request, PostgresSQLServerModeDedicated, defaultUser); got != "" {
+		t.Errorf("got %q for the default user on a dedicated server, want an empty name", got)
+	}
+
+	// Everywhere else the name includes a hash of the resource ID, so resources don't share users.
+	for _, mode := range []PostgresSQLServerMode{PostgresSQLServerModeShared, PostgresSQLServerModePool} {
+		got := postgresSQLUsername(request, mode, defaultUser)
+		if !strings.HasPrefix(got, DefaultPostgresSQLUserName+"_") {
+			t.Errorf("got %q for the default user on a %s server, want a hashed name", got, mode)
+		} else if got == postgresSQLUsername(other, mode, defaultUser) {
+			t.Errorf("got the same name %q for the default user of two resources on a %s server", got, mode)
+		}
+	}
+
+	got := postgresSQLUsername(request, PostgresSQLServerModeDedicated, reporting)
+	if got != hashedPostgresSQLUsername(request, "reporting") {
+		t.Errorf("got %q for a declared user, want %q", got, hashedPostgresSQLUsername(request, "reporting"))
+	}
+}
+
+func TestRecordedPostgresSQLUsername(t *testing.T) {
+	app := PostgresSQLUserSpec{Name: "app", Role: activities.PostgresRoleOwner}
+
+	tests := []struct {
+		name   string
+		record inventory.Record
+		first  bool
+		want   string
+		wantOK bool
+	}{
+		{
+			name:   "recorded user",
+			record: inventory.Record{Users: []inventory.User{{Name: "app", Username: "app_1a2b3c4d_20240102030405"}}},
+			want:   "app_1a2b3c4d_20240102030405",
+			wantOK: true,
+		},
+		{
+			name:   "not recorded",
+			record: inventory.Record{Users: []inventory.User{{Name: "reporting", Username: "reporting_1a2b3c4d"}}},
+			first:  true,
+		},
+		{
+			name:   "record from before users were recorded",
+			record: inventory.Record{Username: "app_1a2b3c4d"},
+			first:  true,
+			want:   "app_1a2b3c4d",
+			wantOK: true,
+		},
+		{
+			name:   "only the first user had a username before users were recorded",
+			record: inventory.Record{Username: "app_1a2b3c4d"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := recordedPostgresSQLUsername(tt.record, app, tt.first)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("got %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package workflows
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/rynowak/workflow-recipe/pkg/activities"
+	"github.com/rynowak/workflow-recipe/pkg/inventory"
+	"github.com/rynowak/workflow-recipe/pkg/recipes"
+)
+
+var (
+	// PostgresSQLVerifyAttempts is how many times the credentials are tried before the database is cleaned up. New
+	// servers take a while before DNS and the Service endpoints are ready.
+	PostgresSQLVerifyAttempts = 6
+
+	// PostgresSQLVerifyInterval is how long to wait after the first failed attempt. The wait doubles after each attempt.
+	PostgresSQLVerifyInterval = 5 * time.Second
+)
+
+// verifyPostgresSQLDatabase connects to the database as each user, and checks the user has the privileges of its
+// role. If a user can't connect, what was provisioned is cleaned up, so Radius never gets a broken binding.
+func verifyPostgresSQLDatabase(ctx *daprworkflow.WorkflowContext, request recipes.Context, provisioned postgresSQLDatabase) error {
+	for _, user := range provisioned.users {
+		err := verifyPostgresSQLUser(ctx, provisioned, user)
+		if err == nil {
+			continue
+		}
+
+		cleanupErr := cleanupPostgresSQLDatabase(ctx, request, provisioned)
+		if cleanupErr != nil {
+			return errors.Join(err, fmt.Errorf("error cleaning up: %w", cleanupErr))
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func verifyPostgresSQLUser(ctx *daprworkflow.WorkflowContext, provisioned postgresSQLDatabase, user postgresSQLUser) error {
+	logger := slog.Default()
+
+	wait := PostgresSQLVerifyInterval
+	for attempt := 1; ; attempt++ {
+		verified, err := activities.CallVerifyPostgresConnection(ctx, activities.VerifyPostgresConnectionInput{
+			Connection: activities.PostgresConnection{
+				Host:     provisioned.deployed.Host,
+				Port:     provisioned.deployed.Port,
+				Database: provisioned.database.Database,
+				Username: user.credentials.Username,
+				Password: user.credentials.Password,
+			},
+			Role: user.spec.Role,
+		})
+		if err != nil {
+			return err
+		}
+
+		if verified.Verified {
+			return nil
+		} else if attempt >= PostgresSQLVerifyAttempts {
+			return fmt.Errorf("user %q could not connect to database %q after %d attempts: %s", user.spec.Name, provisioned.database.Database, attempt, verified.Error)
+		}
+
+		if !ctx.IsReplaying() {
+			logger.Info("Retrying connection verification", slog.String("user", user.spec.Name), slog.Int("attempt", attempt), slog.Duration("wait", wait))
+		}
+
+		err = ctx.CreateTimer(wait).Await(nil)
+		if err != nil {
+			return err
+		}
+		wait *= 2
+	}
+}
+
+// cleanupPostgresSQLDatabase deletes what a failed provisioning created. The database is only deleted if it was
+// created by this provisioning: a database that was kept from the previous binding holds its data. Users and
+// Kubernetes resources that are in the inventory still belong to the previous binding, and are kept too. A new resource
+// releases its reference to a shared server, or its placement in the server pool. An adopted database, and a user
+// that was attached to it, are never deleted.
+func cleanupPostgresSQLDatabase(ctx *daprworkflow.WorkflowContext, request recipes.Context, provisioned postgresSQLDatabase) error {
+	logger := slog.Default()
+	if !ctx.IsReplaying() {
+		logger.Info("Cleaning up PostgresSQL database that failed verification", slog.String("database", provisioned.database.Database))
+	}
+
+	existing, err := activities.CallGetInventoryRecord(ctx, activities.GetInventoryRecordInput{ResourceID: request.Resource.ID})
+	if err != nil {
+		return err
+	}
+
+	adopt, adopting, err := getPostgresSQLAdopt(request)
+	if err != nil {
+		return err
+	}
+
+	recorded := existing.Found && existing.Record.Database == provisioned.database.Database
+	if !adopting && provisioned.database.Created && !recorded {
+		_, err = activities.CallDeletePostgresDatabase(ctx, activities.DeletePostgresDatabaseInput{
+			Database:   provisioned.database.Database,
+			ResourceID: request.Resource.ID,
+			Server:     provisioned.server.id(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, user := range provisioned.users {
+		username := user.credentials.Username
+		inUse := existing.Found && (existing.Record.Username == username ||
+			slices.ContainsFunc(existing.Record.Users, func(u inventory.User) bool { return u.Username == username }))
+		if inUse || (adopting && username == adopt.Username) {
+			continue
+		}
+
+		kept := ""
+		if adopting {
+			kept = adopt.Database
+		}
+
+		_, err = activities.CallDeletePostgresUser(ctx, activities.DeletePostgresUserInput{Username: username, Database: kept, Server: provisioned.server.id()})
+		if err != nil {
+			return err
+		}
+	}
+
+	if existing.Found || adopting {
+		return nil
+	}
+
+	if provisioned.server.mode == PostgresSQLServerModeShared {
+		_, err = releaseSharedPostgresSQLServer(ctx, request.Resource.ID, provisioned.server)
+		return err
+	} else if provisioned.server.mode == PostgresSQLServerModePool {
+		_, err = activities.CallReleasePostgresDatabasePlacement(ctx, activities.ReleasePostgresDatabasePlacementInput{
+			Server:     provisioned.server.name,
+			ResourceID: request.Resource.ID,
+		})
+		return err
+	}
+
+	_, err = activities.CallDeleteKubernetesResources(ctx, activities.DeleteKubernetesResourcesInput{
+		Namespace: provisioned.server.namespace,
+		Name:      provisioned.server.name,
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
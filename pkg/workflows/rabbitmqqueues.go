@@ -0,0 +1,280 @@
+package workflows
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/rynowak/workflow-recipe/pkg/activities"
+	"github.com/rynowak/workflow-recipe/pkg/recipes"
+)
+
+const (
+	// RabbitMQQueuesRecipe is the name of the RabbitMQ recipe in the inventory.
+	RabbitMQQueuesRecipe = "RabbitMQQueues"
+	// RabbitMQQueuesVersion is the version of the RabbitMQ recipe. Increment this when the recipe changes what it
+	// provisions.
+	RabbitMQQueuesVersion = "1.0.0"
+
+	// RabbitMQImage is the image of the RabbitMQ server. The management image includes the management HTTP API.
+	RabbitMQImage = "rabbitmq:3-management"
+	// RabbitMQPort is the AMQP port of the RabbitMQ server.
+	RabbitMQPort = 5672
+	// RabbitMQUsername is the name of the user that can use the vhost, before it is made unique to the resource.
+	RabbitMQUsername = "rabbitmquser"
+	// RabbitMQDataPath is where the RabbitMQ server keeps its data.
+	RabbitMQDataPath = "/var/lib/rabbitmq"
+)
+
+func RabbitMQQueuesPut(ctx *daprworkflow.WorkflowContext) (any, error) {
+	request := recipes.Context{}
+	err := ctx.GetInput(&request)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default()
+	if ctx.IsReplaying() {
+		logger.Info("Resuming RabbitMQ queue creation/update")
+	} else {
+		logger.Info("Creating/Updating RabbitMQ queue")
+	}
+
+	return withResourceLock(ctx, request.Resource.ID, func() (any, error) {
+		return rabbitMQQueuesPut(ctx, request)
+	})
+}
+
+func rabbitMQQueuesPut(ctx *daprworkflow.WorkflowContext, request recipes.Context) (any, error) {
+	logger := slog.Default()
+
+	existing, err := activities.CallGetInventoryRecord(ctx, activities.GetInventoryRecordInput{ResourceID: request.Resource.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	// The queue is named by the resource, like the queues Radius provisions. The vhost can be set with the vhost
+	// parameter, and defaults to the name of the resource made unique to it. A Put of a resource that exists keeps its
+	// vhost and user.
+	queue, ok := request.Resource.GetStringValue("/queue")
+	if !ok {
+		queue = request.Resource.Name
+	}
+
+	vhost, ok := request.GetStringParameter("vhost")
+	if !ok && existing.Found && existing.Record.VHost != "" {
+		vhost = existing.Record.VHost
+	} else if !ok {
+		vhost = hashedRabbitMQName(request, request.Resource.Name)
+	}
+
+	username := hashedRabbitMQName(request, RabbitMQUsername)
+	if existing.Found && existing.Record.Username != "" {
+		username = existing.Record.Username
+	}
+
+	namespace := kubernetesNamespace(request)
+	deployed, err := activities.CallDeployKubernetesResources(ctx, activities.DeployKubernetesResourcesInput{
+		Namespace:        namespace,
+		Name:             request.Resource.Name,
+		Image:            RabbitMQImage,
+		Port:             RabbitMQPort,
+		AdminPort:        activities.RabbitMQManagementPort,
+		DataPath:         RabbitMQDataPath,
+		Env:              map[string]string{"RABBITMQ_DEFAULT_USER": "admin"},
+		AdminUsername:    "admin",
+		AdminPasswordEnv: "RABBITMQ_DEFAULT_PASS",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := activities.CallCreateRabbitMQQueue(ctx, activities.CreateRabbitMQQueueInput{
+		VHost:    vhost,
+		Queue:    queue,
+		Username: username,
+		Server:   activities.DeploymentID(namespace, request.Resource.Name),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := newInventoryRecord(ctx, request, RabbitMQQueuesRecipe, RabbitMQQueuesVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	record.Resources = deployed.Resources
+	record.Host = deployed.Host
+	record.Port = deployed.Port
+	record.VHost = vhost
+	record.Queue = queue
+	record.Username = credentials.Username
+	issuedAt := ctx.CurrentUTCDateTime()
+	record.CredentialsIssuedAt = &issuedAt
+	_, err = activities.CallSaveInventoryRecord(ctx, activities.SaveInventoryRecordInput{Record: record})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Done creating/updating RabbitMQ queue")
+	return recipes.Result{
+		Values: map[string]any{
+			"queue":    queue,
+			"host":     deployed.Host,
+			"port":     deployed.Port,
+			"vHost":    vhost,
+			"username": credentials.Username,
+		},
+		Secrets: map[string]any{
+			"password": credentials.Password,
+			"uri":      amqpURI(deployed.Host, deployed.Port, credentials.Username, credentials.Password, vhost),
+		},
+		Resources: deployed.Resources,
+	}, nil
+}
+
+// hashedRabbitMQName returns a name that is unique to the resource, so resources that share a RabbitMQ server don't
+// share a user or vhost.
+func hashedRabbitMQName(request recipes.Context, name string) string {
+	hash := sha256.Sum256([]byte(request.Resource.ID))
+	return name + "-" + hex.EncodeToString(hash[:4])
+}
+
+// amqpURI returns the AMQP URI for a vhost. The user, password, and vhost are percent-encoded, including any '/' in
+// the vhost.
+func amqpURI(host string, port int, username string, password string, vhost string) string {
+	u := url.URL{
+		Scheme:  "amqp",
+		User:    url.UserPassword(username, password),
+		Host:    net.JoinHostPort(host, strconv.Itoa(port)),
+		Path:    "/" + vhost,
+		RawPath: "/" + url.PathEscape(vhost),
+	}
+	return u.String()
+}
+
+func RabbitMQQueuesDelete(ctx *daprworkflow.WorkflowContext) (any, error) {
+	request := recipes.Context{}
+	err := ctx.GetInput(&request)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default()
+	if ctx.IsReplaying() {
+		logger.Info("Resuming RabbitMQ queue deletion")
+	} else {
+		logger.Info("Deleting RabbitMQ queue")
+	}
+
+	return withResourceLock(ctx, request.Resource.ID, func() (any, error) {
+		return rabbitMQQueuesDelete(ctx, request)
+	})
+}
+
+func rabbitMQQueuesDelete(ctx *daprworkflow.WorkflowContext, request recipes.Context) (any, error) {
+	logger := slog.Default()
+
+	policy, err := getMissingDataPolicy(request)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := activities.CallGetInventoryRecord(ctx, activities.GetInventoryRecordInput{ResourceID: request.Resource.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	report := recipes.NewDeletionReport()
+	missing := []string{}
+
+	vhost, ok := resolveDeletionTarget(request, &report, "vhost", existing.Record.VHost, "/status/binding/vHost")
+	if !ok {
+		missing = append(missing, "vhost")
+	}
+
+	queue, ok := resolveDeletionTarget(request, &report, "queue", existing.Record.Queue, "/status/binding/queue")
+	if !ok {
+		missing = append(missing, "queue")
+	}
+
+	user, ok := resolveDeletionTarget(request, &report, "user", existing.Record.Username, "/status/binding/username")
+	if !ok {
+		missing = append(missing, "user")
+	}
+
+	if len(missing) > 0 {
+		switch policy {
+		case MissingDataPolicyFail:
+			return nil, fmt.Errorf("cannot determine the %s to delete for resource %q: not found in the inventory or the resource's binding", strings.Join(missing, " and "), request.Resource.ID)
+
+		case MissingDataPolicySearchByLabels:
+			report.Warnings = append(report.Warnings, "searching by label is not supported for RabbitMQ: skipping what is missing")
+		}
+
+		for _, kind := range missing {
+			report.NotFound = append(report.NotFound, recipes.DeletionItem{Kind: kind, Reason: "not found in the inventory or the resource's binding"})
+			report.Warnings = append(report.Warnings, fmt.Sprintf("no %s was found to delete: if one exists it is orphaned", kind))
+		}
+	}
+
+	namespace := kubernetesNamespace(request)
+	if existing.Found && existing.Record.Namespace != "" {
+		namespace = existing.Record.Namespace
+	}
+
+	_, err = activities.CallDeleteRabbitMQQueue(ctx, activities.DeleteRabbitMQQueueInput{
+		VHost:    vhost.Name,
+		Queue:    queue.Name,
+		Username: user.Name,
+		Server:   activities.DeploymentID(namespace, request.Resource.Name),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range []recipes.DeletionItem{queue, user, vhost} {
+		if item.Name != "" {
+			report.Removed = append(report.Removed, item)
+		}
+	}
+
+	_, err = activities.CallDeleteKubernetesResources(ctx, activities.DeleteKubernetesResourcesInput{
+		Namespace: namespace,
+		Name:      request.Resource.Name,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if existing.Found && len(existing.Record.Resources) > 0 {
+		for _, id := range existing.Record.Resources {
+			report.Removed = append(report.Removed, recipes.DeletionItem{Kind: "kubernetes", Name: id, Source: "inventory"})
+		}
+	} else {
+		report.Removed = append(report.Removed, recipes.DeletionItem{Kind: "kubernetes", Name: namespace + "/" + request.Resource.Name, Source: "name"})
+	}
+
+	if existing.Found {
+		_, err = activities.CallDeleteInventoryRecord(ctx, activities.DeleteInventoryRecordInput{ResourceID: request.Resource.ID})
+		if err != nil {
+			return nil, err
+		}
+
+		report.Removed = append(report.Removed, recipes.DeletionItem{Kind: "inventory", Name: request.Resource.ID, Source: "inventory"})
+	}
+
+	for _, warning := range report.Warnings {
+		logger.Warn(warning, slog.String("resource.id", request.Resource.ID))
+	}
+
+	logger.Info("Done deleting RabbitMQ queue")
+	return report, nil
+}
@@ -0,0 +1,205 @@
+package workflows
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/rynowak/workflow-recipe/pkg/activities"
+	"github.com/rynowak/workflow-recipe/pkg/recipes"
+)
+
+const (
+	// RedisCachesRecipe is the name of the Redis recipe in the inventory.
+	RedisCachesRecipe = "RedisCaches"
+	// RedisCachesVersion is the version of the Redis recipe. Increment this when the recipe changes what it provisions.
+	RedisCachesVersion = "1.0.0"
+
+	// RedisImage is the image of the Redis server.
+	RedisImage = "redis:7"
+	// RedisPort is the port of the Redis server.
+	RedisPort = 6379
+	// RedisDataPath is where the Redis server keeps its data.
+	RedisDataPath = "/data"
+
+	// redisStartScript starts the Redis server with its ACLs in a file on the volume, so the users survive a restart.
+	// The admin user is added the first time, with the password from the environment.
+	redisStartScript = `touch /data/users.acl && ` +
+		`(grep -q '^user admin ' /data/users.acl || echo "user admin on >$REDIS_ADMIN_PASSWORD ~* &* +@all" >> /data/users.acl) && ` +
+		`exec redis-server --aclfile /data/users.acl --appendonly yes --dir /data`
+)
+
+func RedisCachesPut(ctx *daprworkflow.WorkflowContext) (any, error) {
+	request := recipes.Context{}
+	err := ctx.GetInput(&request)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default()
+	if ctx.IsReplaying() {
+		logger.Info("Resuming Redis cache creation/update")
+	} else {
+		logger.Info("Creating/Updating Redis cache")
+	}
+
+	return withResourceLock(ctx, request.Resource.ID, func() (any, error) {
+		return redisCachesPut(ctx, request)
+	})
+}
+
+func redisCachesPut(ctx *daprworkflow.WorkflowContext, request recipes.Context) (any, error) {
+	logger := slog.Default()
+
+	// TLS is off, like the Redis caches Radius provisions for local development. The deployed server has no
+	// certificate, so asking for TLS fails instead of returning connection details that don't use it.
+	tls := false
+	_, err := request.DecodeParameter("tls", &tls)
+	if err != nil {
+		return nil, err
+	} else if tls {
+		return nil, errors.New("the tls parameter is not supported: the Redis server is deployed without a certificate")
+	}
+
+	namespace := kubernetesNamespace(request)
+	deployed, err := activities.CallDeployKubernetesResources(ctx, activities.DeployKubernetesResourcesInput{
+		Namespace:        namespace,
+		Name:             request.Resource.Name,
+		Image:            RedisImage,
+		Command:          []string{"sh", "-c", redisStartScript},
+		Port:             RedisPort,
+		DataPath:         RedisDataPath,
+		AdminUsername:    "admin",
+		AdminPasswordEnv: "REDIS_ADMIN_PASSWORD",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := activities.CallCreateRedisUser(ctx, activities.CreateRedisUserInput{
+		Server: activities.DeploymentID(namespace, request.Resource.Name),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := newInventoryRecord(ctx, request, RedisCachesRecipe, RedisCachesVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	record.Resources = deployed.Resources
+	record.Host = deployed.Host
+	record.Port = deployed.Port
+	record.Username = credentials.Username
+	issuedAt := ctx.CurrentUTCDateTime()
+	record.CredentialsIssuedAt = &issuedAt
+	_, err = activities.CallSaveInventoryRecord(ctx, activities.SaveInventoryRecordInput{Record: record})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Done creating/updating Redis cache")
+	return recipes.Result{
+		Values: map[string]any{
+			"host":     deployed.Host,
+			"port":     deployed.Port,
+			"username": credentials.Username,
+			"tls":      tls,
+		},
+		Secrets: map[string]any{
+			"password":         credentials.Password,
+			"connectionString": redisConnectionString(deployed.Host, deployed.Port, credentials.Username, credentials.Password, tls),
+			"url":              redisURL(deployed.Host, deployed.Port, credentials.Username, credentials.Password, tls),
+		},
+		Resources: deployed.Resources,
+	}, nil
+}
+
+// redisConnectionString returns a StackExchange.Redis connection string, which is what Radius returns for Redis
+// caches.
+func redisConnectionString(host string, port int, username string, password string, tls bool) string {
+	return fmt.Sprintf("%s,abortConnect=False,ssl=%t,user=%s,password=%s", net.JoinHostPort(host, strconv.Itoa(port)), tls, username, password)
+}
+
+// redisURL returns a redis:// URL, or a rediss:// URL if TLS is enabled. The credentials are percent-encoded.
+func redisURL(host string, port int, username string, password string, tls bool) string {
+	u := url.URL{
+		Scheme: "redis",
+		User:   url.UserPassword(username, password),
+		Host:   net.JoinHostPort(host, strconv.Itoa(port)),
+		Path:   "/0",
+	}
+	if tls {
+		u.Scheme = "rediss"
+	}
+	return u.String()
+}
+
+func RedisCachesDelete(ctx *daprworkflow.WorkflowContext) (any, error) {
+	request := recipes.Context{}
+	err := ctx.GetInput(&request)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default()
+	if ctx.IsReplaying() {
+		logger.Info("Resuming Redis cache deletion")
+	} else {
+		logger.Info("Deleting Redis cache")
+	}
+
+	return withResourceLock(ctx, request.Resource.ID, func() (any, error) {
+		return redisCachesDelete(ctx, request)
+	})
+}
+
+func redisCachesDelete(ctx *daprworkflow.WorkflowContext, request recipes.Context) (any, error) {
+	logger := slog.Default()
+
+	existing, err := activities.CallGetInventoryRecord(ctx, activities.GetInventoryRecordInput{ResourceID: request.Resource.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	report := recipes.NewDeletionReport()
+
+	namespace := kubernetesNamespace(request)
+	if existing.Found && existing.Record.Namespace != "" {
+		namespace = existing.Record.Namespace
+	}
+
+	// The ACL user is stored by the server, so it is deleted with it.
+	_, err = activities.CallDeleteKubernetesResources(ctx, activities.DeleteKubernetesResourcesInput{
+		Namespace: namespace,
+		Name:      request.Resource.Name,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if existing.Found && len(existing.Record.Resources) > 0 {
+		for _, id := range existing.Record.Resources {
+			report.Removed = append(report.Removed, recipes.DeletionItem{Kind: "kubernetes", Name: id, Source: "inventory"})
+		}
+	} else {
+		report.Removed = append(report.Removed, recipes.DeletionItem{Kind: "kubernetes", Name: namespace + "/" + request.Resource.Name, Source: "name"})
+	}
+
+	if existing.Found {
+		_, err = activities.CallDeleteInventoryRecord(ctx, activities.DeleteInventoryRecordInput{ResourceID: request.Resource.ID})
+		if err != nil {
+			return nil, err
+		}
+
+		report.Removed = append(report.Removed, recipes.DeletionItem{Kind: "inventory", Name: request.Resource.ID, Source: "inventory"})
+	}
+
+	logger.Info("Done deleting Redis cache")
+	return report, nil
+}
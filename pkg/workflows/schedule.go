@@ -0,0 +1,85 @@
+package workflows
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	daprworkflow "github.com/dapr/go-sdk/workflow"
+	"github.com/microsoft/durabletask-go/task"
+	"github.com/rynowak/workflow-recipe/pkg/cron"
+)
+
+const (
+	// ScheduleControlEvent is the name of the external event that controls a running schedule. The payload is a
+	// ScheduleCommand.
+	ScheduleControlEvent = "control"
+)
+
+// ScheduleAction is an action that can be sent to a running schedule.
+type ScheduleAction string
+
+const (
+	// ScheduleActionPause stops scheduled runs until the schedule is resumed.
+	ScheduleActionPause ScheduleAction = "pause"
+	// ScheduleActionResume resumes a paused schedule. Runs that were missed while paused are skipped.
+	ScheduleActionResume ScheduleAction = "resume"
+	// ScheduleActionRunNow runs immediately without changing when the next scheduled run is.
+	ScheduleActionRunNow ScheduleAction = "runNow"
+	// ScheduleActionUpdate replaces the configuration of the schedule.
+	ScheduleActionUpdate ScheduleAction = "update"
+)
+
+// ScheduleCommand is the payload of ScheduleControlEvent.
+type ScheduleCommand struct {
+	Action ScheduleAction `json:"action"`
+	// Config is the new configuration for ScheduleActionUpdate. The format depends on the schedule.
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+// ScheduleConfig is the configuration shared by every schedule.
+type ScheduleConfig struct {
+	// Schedule is the cron expression for when the schedule runs, evaluated in UTC. Ex. @daily or 30 2 * * *
+	Schedule string `json:"schedule"`
+	// Paused is true if scheduled runs are not happening.
+	Paused bool `json:"paused,omitempty"`
+}
+
+// awaitSchedule waits until nextRun, or until a ScheduleControlEvent arrives. Returns true if the wait ended because
+// the run is due, and otherwise returns the command. A paused schedule waits only for commands.
+func awaitSchedule(ctx *daprworkflow.WorkflowContext, config ScheduleConfig, nextRun *time.Time) (ScheduleCommand, bool, error) {
+	// A negative timeout waits indefinitely, a zero timeout only sees events that have already arrived.
+	timeout := time.Duration(-1)
+	if !config.Paused {
+		if nextRun == nil {
+			return ScheduleCommand{}, false, errors.New("next run is required when the schedule is not paused")
+		}
+		timeout = max(nextRun.Sub(ctx.CurrentUTCDateTime()), 0)
+	}
+
+	command := ScheduleCommand{}
+	err := ctx.WaitForExternalEvent(ScheduleControlEvent, timeout).Await(&command)
+	if errors.Is(err, task.ErrTaskCanceled) {
+		return ScheduleCommand{}, true, nil
+	} else if err != nil {
+		return ScheduleCommand{}, false, err
+	}
+
+	return command, false, nil
+}
+
+// nextScheduledRun returns the first time after now that matches the schedule.
+func nextScheduledRun(schedule string, now time.Time) (*time.Time, error) {
+	parsed, err := cron.Parse(schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	next := parsed.Next(now)
+	if next.IsZero() {
+		return nil, fmt.Errorf("schedule %q never runs", schedule)
+	}
+
+	return &next, nil
+}
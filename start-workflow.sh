@@ -29,7 +29,7 @@ echo "Started workflow with id: $ID"
 while true; do
   echo "Checking workflow status..."
 
-  RESULT=$(curl "http://localhost:7999/workflows/$ID" \
+  RESULT=$(curl "http://localhost:7999/workflows/$ID?wait=60s" \
     --silent \
     --fail-with-body \
     -X GET)
@@ -69,6 +69,4 @@ while true; do
     echo "Workflow terminated!"
     break
   fi
-
-  sleep 3
 done
\ No newline at end of file